@@ -3,10 +3,15 @@ package collection
 import (
 	"container/heap"
 	"container/list"
+	"fmt"
+	"time"
 
 	"golang.org/x/exp/constraints"
 )
 
+// MinHeap is a heap.Interface of keys ordered from the minimum.
+//
+// Deprecated: LRU no longer uses it and keeps its entries in heaps of its own; use container/heap directly.
 type MinHeap[K constraints.Ordered] []K
 
 func (h MinHeap[K]) Len() int {
@@ -26,7 +31,6 @@ func (h *MinHeap[K]) Push(x any) {
 }
 
 func (h *MinHeap[K]) Pop() any {
-
 	old := *h
 	n := len(old)
 	x := old[n-1]
@@ -39,32 +43,118 @@ type Pair[K, V any] struct {
 	Val V
 }
 
+const (
+	minSlot = 0
+	maxSlot = 1
+)
+
+// entry is the element of the list and the heaps of an LRU.
+type entry[K, V any] struct {
+	Pair[K, V]
+	// expiresAt is the time the entry expires at, zero if it does not expire.
+	expiresAt time.Time
+	// heapIndex is the index of the entry in the min-heap and in the max-heap.
+	heapIndex [2]int
+}
+
+func (e *entry[K, V]) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// indexedHeap is a heap of the entries of an LRU, ordered by their keys. The entries keep their index
+// in it up to date, so that any entry can be removed or fixed in O(log n).
+type indexedHeap[K constraints.Ordered, V any] struct {
+	entries []*entry[K, V]
+	// slot is minSlot for a min-heap and maxSlot for a max-heap, and the index of the heapIndex of the entries.
+	slot int
+}
+
+func (h *indexedHeap[K, V]) Len() int {
+	return len(h.entries)
+}
+
+func (h *indexedHeap[K, V]) Less(i, j int) bool {
+	if h.slot == maxSlot {
+		return h.entries[i].Key > h.entries[j].Key
+	}
+	return h.entries[i].Key < h.entries[j].Key
+}
+
+func (h *indexedHeap[K, V]) Swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+	h.entries[i].heapIndex[h.slot] = i
+	h.entries[j].heapIndex[h.slot] = j
+}
+
+func (h *indexedHeap[K, V]) Push(x any) {
+	e := x.(*entry[K, V])
+	e.heapIndex[h.slot] = len(h.entries)
+	h.entries = append(h.entries, e)
+}
+
+func (h *indexedHeap[K, V]) Pop() any {
+	old := h.entries
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	e.heapIndex[h.slot] = -1
+	h.entries = old[0 : n-1]
+	return e
+}
+
+// remove removes the entry from the heap.
+func (h *indexedHeap[K, V]) remove(e *entry[K, V]) {
+	heap.Remove(h, e.heapIndex[h.slot])
+}
+
+// LRU is a Collection that can serve as a cache. The list holds the entries from the least to the most
+// recently used one: entries are added to its back and At and Upsert move the entry they find back there,
+// so without them it is the insertion order. The min-heap and the max-heap hold the entries for DelMin
+// and DelMax, every entry knows its index in both, so Delete removes it from them in O(log n).
+//
+// An LRU created with a capacity evicts the least recently used entry when an entry is added to it while full.
+// Entries added with a TTL are evicted once it passes, when they are met by At, Add, Upsert or at the top of
+// a heap. Iterators skip them but do not evict them, so Len counts the expired entries that are not evicted yet.
 type LRU[K constraints.Ordered, V any] struct {
-	Dict map[K]*list.Element
-	List *list.List
-	Heap *MinHeap[K]
+	dict    map[K]*list.Element
+	list    *list.List
+	minHeap *indexedHeap[K, V]
+	maxHeap *indexedHeap[K, V]
+	// capacity is the maximum number of entries, 0 if it is unbounded.
+	capacity int
+	// onEvict is called with the entries evicted due to the capacity or a TTL, nil if not needed.
+	onEvict func(K, V)
+	// version is bumped by every modification, including the moves of At, so that
+	// the iterators obtained before it detect it.
+	version uint64
+	// now is replaced in tests to control the clock.
+	now func() time.Time
 }
 
 type ListIterator[K comparable, V any] struct {
 	List  *list.List
 	Order IterationOrder
 	Head  *list.Element
+	// now is the time the iterator was created at, the entries expired by then are skipped.
+	now time.Time
+	// version points to the version of the collection, which must stay at expected.
+	version  *uint64
+	expected uint64
 }
 
 func (lst *ListIterator[K, V]) Next() (K, V, error) {
 	var key K
 	var val V
+	if lst.version != nil && *lst.version != lst.expected {
+		return key, val, ErrModifiedCollection
+	}
 	if lst.Head == nil {
 		return key, val, ErrEmptyIterator
 	} else {
-		pair := lst.Head.Value.(Pair[K, V])
-		key = pair.Key
-		val = pair.Val
-		if lst.Order == ByInsertion {
-			lst.Head = lst.Head.Next()
-		} else if lst.Order == ByInsertionRev {
-			lst.Head = lst.Head.Prev()
-		}
+		e := lst.Head.Value.(*entry[K, V])
+		key = e.Key
+		val = e.Val
+		lst.advance()
 		return key, val, nil
 	}
 }
@@ -76,62 +166,204 @@ func (lst *ListIterator[K, V]) HasNext() bool {
 	return false
 }
 
+// advance moves the head to the next entry that is not expired.
+func (lst *ListIterator[K, V]) advance() {
+	for {
+		if lst.Order == ByInsertion {
+			lst.Head = lst.Head.Next()
+		} else if lst.Order == ByInsertionRev {
+			lst.Head = lst.Head.Prev()
+		}
+		if lst.Head == nil || !lst.Head.Value.(*entry[K, V]).expired(lst.now) {
+			return
+		}
+	}
+}
+
+// NewCollection creates an unbounded collection.
 func NewCollection[K constraints.Ordered, V any]() *LRU[K, V] {
-	col := LRU[K, V]{}
-	col.Dict = make(map[K]*list.Element)
-	col.List = list.New()
-	h := &MinHeap[K]{}
-	heap.Init(h)
-	col.Heap = h
+	return NewLRU[K, V](0, nil)
+}
+
+// NewLRU creates a collection holding at most capacity entries, or an unbounded one if capacity is 0.
+// onEvict, unless nil, is called with every entry evicted due to the capacity or a TTL, and must not
+// modify the collection. Entries removed by DelMin, DelMax, Delete or Purge are not passed to it.
+func NewLRU[K constraints.Ordered, V any](capacity int, onEvict func(K, V)) *LRU[K, V] {
+	if capacity < 0 {
+		panic(fmt.Sprintf("negative capacity %d", capacity))
+	}
+	col := LRU[K, V]{capacity: capacity, onEvict: onEvict, now: time.Now}
+	col.dict = make(map[K]*list.Element)
+	col.list = list.New()
+	col.minHeap = &indexedHeap[K, V]{slot: minSlot}
+	col.maxHeap = &indexedHeap[K, V]{slot: maxSlot}
 	return &col
 }
 
 func (col *LRU[K, V]) Len() int {
-	return col.List.Len()
+	return col.list.Len()
 }
 
 func (col *LRU[K, V]) Add(key K, value V) error {
-	if _, ok := col.Dict[key]; ok {
-		return ErrDuplicateKey
-	} else {
-		el := col.List.PushBack(Pair[K, V]{key, value})
-		col.Dict[key] = el
-		heap.Push(col.Heap, key)
+	return col.AddWithTTL(key, value, 0)
+}
+
+// AddWithTTL adds the value like Add, but the entry expires after ttl. A ttl that is not positive
+// means that the entry does not expire. An expired entry with the same key is replaced.
+func (col *LRU[K, V]) AddWithTTL(key K, value V, ttl time.Duration) error {
+	if el, ok := col.dict[key]; ok {
+		if !col.expired(el) {
+			return ErrDuplicateKey
+		}
+		col.evict(el)
+	}
+	e := &entry[K, V]{Pair: Pair[K, V]{key, value}, expiresAt: col.expiration(ttl)}
+	col.dict[key] = col.list.PushBack(e)
+	heap.Push(col.minHeap, e)
+	heap.Push(col.maxHeap, e)
+	col.version++
+	if col.capacity > 0 && col.Len() > col.capacity {
+		col.evict(col.list.Front())
 	}
 	return nil
 }
 
+func (col *LRU[K, V]) Upsert(key K, value V) bool {
+	return col.UpsertWithTTL(key, value, 0)
+}
+
+// UpsertWithTTL upserts the value like Upsert, but the entry expires after ttl, like for AddWithTTL.
+func (col *LRU[K, V]) UpsertWithTTL(key K, value V, ttl time.Duration) bool {
+	el, ok := col.dict[key]
+	if !ok || col.expired(el) {
+		_ = col.AddWithTTL(key, value, ttl)
+		return false
+	}
+	e := el.Value.(*entry[K, V])
+	e.Val = value
+	e.expiresAt = col.expiration(ttl)
+	col.list.MoveToBack(el)
+	col.version++
+	return true
+}
+
+func (col *LRU[K, V]) expiration(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return col.now().Add(ttl)
+}
+
 func (col *LRU[K, V]) DelMin() (K, V, error) {
-	var v V
-	var key K
-	if col.Len() == 0 {
+	return col.delFirst(col.minHeap)
+}
+
+func (col *LRU[K, V]) DelMax() (K, V, error) {
+	return col.delFirst(col.maxHeap)
+}
+
+func (col *LRU[K, V]) PeekMin() (K, V, error) {
+	e := col.first(col.minHeap)
+	if e == nil {
+		var key K
+		var v V
 		return key, v, ErrEmptyCollection
 	}
-	key = heap.Pop(col.Heap).(K)
-	v = col.Dict[key].Value.(Pair[K, V]).Val
-	col.List.Remove(col.Dict[key])
-	delete(col.Dict, key)
-	return key, v, nil
+	return e.Key, e.Val, nil
 }
 
+func (col *LRU[K, V]) delFirst(h *indexedHeap[K, V]) (K, V, error) {
+	e := col.first(h)
+	if e == nil {
+		var key K
+		var v V
+		return key, v, ErrEmptyCollection
+	}
+	col.unlink(col.dict[e.Key])
+	return e.Key, e.Val, nil
+}
+
+// first evicts the expired entries off the top of the heap and returns the top entry, nil if there is none.
+func (col *LRU[K, V]) first(h *indexedHeap[K, V]) *entry[K, V] {
+	for h.Len() > 0 {
+		e := h.entries[0]
+		if !e.expired(col.now()) {
+			return e
+		}
+		col.evict(col.dict[e.Key])
+	}
+	return nil
+}
+
+// At returns the value associated with the key and marks the entry as the most recently used one.
 func (col *LRU[K, V]) At(key K) (V, bool) {
 	var v V
-	el, ok := col.Dict[key]
-	if ok {
-		pair := el.Value.(Pair[K, V])
-		return pair.Val, ok
+	el, ok := col.dict[key]
+	if !ok {
+		return v, false
+	}
+	if col.expired(el) {
+		col.evict(el)
+		return v, false
+	}
+	col.list.MoveToBack(el)
+	col.version++
+	return el.Value.(*entry[K, V]).Val, true
+}
+
+func (col *LRU[K, V]) Delete(key K) bool {
+	el, ok := col.dict[key]
+	if !ok {
+		return false
 	}
-	return v, ok
+	col.unlink(el)
+	return true
+}
+
+// Purge removes all the entries.
+func (col *LRU[K, V]) Purge() {
+	clear(col.dict)
+	col.list.Init()
+	col.minHeap.entries = nil
+	col.maxHeap.entries = nil
+	col.version++
 }
 
 func (col *LRU[K, V]) IterateBy(order IterationOrder) Iterator[K, V] {
 	var it ListIterator[K, V]
 	if order == ByInsertion {
-		it = ListIterator[K, V]{col.List, order, col.List.Front()}
+		it = ListIterator[K, V]{List: col.list, Order: order, Head: col.list.Front()}
 	} else if order == ByInsertionRev {
-		it = ListIterator[K, V]{col.List, order, col.List.Back()}
+		it = ListIterator[K, V]{List: col.list, Order: order, Head: col.list.Back()}
 	} else {
 		panic(ErrUnknownOrder)
 	}
+	it.now = col.now()
+	it.version, it.expected = &col.version, col.version
+	if it.Head != nil && it.Head.Value.(*entry[K, V]).expired(it.now) {
+		it.advance()
+	}
 	return &it
 }
+
+func (col *LRU[K, V]) expired(el *list.Element) bool {
+	return el.Value.(*entry[K, V]).expired(col.now())
+}
+
+// evict removes the entry and passes it to the eviction callback.
+func (col *LRU[K, V]) evict(el *list.Element) {
+	e := col.unlink(el)
+	if col.onEvict != nil {
+		col.onEvict(e.Key, e.Val)
+	}
+}
+
+// unlink removes the entry from the dict, the list and the heaps.
+func (col *LRU[K, V]) unlink(el *list.Element) *entry[K, V] {
+	e := col.list.Remove(el).(*entry[K, V])
+	delete(col.dict, e.Key)
+	col.minHeap.remove(e)
+	col.maxHeap.remove(e)
+	col.version++
+	return e
+}
@@ -0,0 +1,288 @@
+package collection
+
+import (
+	"container/heap"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fixedClock makes the collection see the given time until it is changed.
+func fixedClock[K string | int, V any](col *LRU[K, V], t time.Time) *time.Time {
+	clock := &t
+	col.now = func() time.Time { return *clock }
+	return clock
+}
+
+// evictions records the entries passed to the eviction callback.
+type evictions[K comparable, V any] struct {
+	pairs []Pair[K, V]
+}
+
+func (e *evictions[K, V]) onEvict(key K, val V) {
+	e.pairs = append(e.pairs, Pair[K, V]{key, val})
+}
+
+func collect[K comparable, V any](it Iterator[K, V]) []K {
+	var keys []K
+	for it.HasNext() {
+		key, _, err := it.Next()
+		if err != nil {
+			panic(err)
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func TestCollection(t *testing.T) {
+	col := NewCollection[int, string]()
+	for _, key := range []int{3, 1, 2} {
+		require.NoError(t, col.Add(key, "v"+string(rune('0'+key))))
+	}
+	require.ErrorIs(t, col.Add(1, "again"), ErrDuplicateKey)
+	require.Equal(t, 3, col.Len())
+	require.Equal(t, []int{3, 1, 2}, collect(col.IterateBy(ByInsertion)))
+	require.Equal(t, []int{2, 1, 3}, collect(col.IterateBy(ByInsertionRev)))
+
+	for _, want := range []int{1, 2, 3} {
+		key, val, err := col.DelMin()
+		require.NoError(t, err)
+		require.Equal(t, want, key)
+		require.Equal(t, "v"+string(rune('0'+want)), val)
+	}
+	_, _, err := col.DelMin()
+	require.ErrorIs(t, err, ErrEmptyCollection)
+	require.Panics(t, func() { col.IterateBy(IterationOrder(0)) })
+}
+
+func TestLRU_EvictsLeastRecentlyUsed(t *testing.T) {
+	var evicted evictions[string, int]
+	col := NewLRU[string, int](2, evicted.onEvict)
+	require.NoError(t, col.Add("a", 1))
+	require.NoError(t, col.Add("b", 2))
+	val, ok := col.At("a")
+	require.True(t, ok)
+	require.Equal(t, 1, val)
+	require.Equal(t, []string{"b", "a"}, collect(col.IterateBy(ByInsertion)))
+
+	require.NoError(t, col.Add("c", 3))
+	require.Equal(t, []Pair[string, int]{{"b", 2}}, evicted.pairs)
+	require.Equal(t, 2, col.Len())
+	_, ok = col.At("b")
+	require.False(t, ok)
+	require.Equal(t, []string{"a", "c"}, collect(col.IterateBy(ByInsertion)))
+}
+
+func TestLRU_ExpiresEntries(t *testing.T) {
+	var evicted evictions[string, int]
+	col := NewLRU[string, int](0, evicted.onEvict)
+	clock := fixedClock(col, time.Unix(1000, 0))
+	require.NoError(t, col.AddWithTTL("short", 1, time.Second))
+	require.NoError(t, col.AddWithTTL("long", 2, time.Minute))
+	require.NoError(t, col.Add("forever", 3))
+
+	*clock = clock.Add(time.Second)
+	require.Equal(t, []string{"long", "forever"}, collect(col.IterateBy(ByInsertion)))
+	require.Equal(t, 3, col.Len())
+	_, ok := col.At("short")
+	require.False(t, ok)
+	require.Equal(t, []Pair[string, int]{{"short", 1}}, evicted.pairs)
+	require.Equal(t, 2, col.Len())
+
+	*clock = clock.Add(time.Hour)
+	require.NoError(t, col.AddWithTTL("long", 4, time.Minute))
+	val, ok := col.At("long")
+	require.True(t, ok)
+	require.Equal(t, 4, val)
+	require.Equal(t, []Pair[string, int]{{"short", 1}, {"long", 2}}, evicted.pairs)
+}
+
+func TestLRU_DelMinSkipsRemovedEntries(t *testing.T) {
+	var evicted evictions[int, int]
+	col := NewLRU[int, int](3, evicted.onEvict)
+	clock := fixedClock(col, time.Unix(1000, 0))
+	for key := range 6 {
+		require.NoError(t, col.Add(key, key))
+	}
+	require.True(t, col.Delete(4))
+	require.False(t, col.Delete(4))
+	require.NoError(t, col.AddWithTTL(1, 1, time.Second))
+	require.NoError(t, col.Add(2, 2))
+	*clock = clock.Add(time.Second)
+
+	// 0, 1, 2 and 3 were evicted, 4 deleted and the second 1 expired
+	key, _, err := col.DelMin()
+	require.NoError(t, err)
+	require.Equal(t, 2, key)
+	key, _, err = col.DelMin()
+	require.NoError(t, err)
+	require.Equal(t, 5, key)
+	_, _, err = col.DelMin()
+	require.ErrorIs(t, err, ErrEmptyCollection)
+	require.Equal(t, []Pair[int, int]{{0, 0}, {1, 1}, {2, 2}, {3, 3}, {1, 1}}, evicted.pairs)
+}
+
+func TestLRU_HeapsHoldOnlyEntries(t *testing.T) {
+	col := NewLRU[int, int](10, nil)
+	for key := range 1000 {
+		require.NoError(t, col.Add(key, key))
+	}
+	requireIndexed(t, col)
+	for want := 990; want < 1000; want++ {
+		key, _, err := col.DelMin()
+		require.NoError(t, err)
+		require.Equal(t, want, key)
+	}
+}
+
+// requireIndexed checks that the heaps hold exactly the entries of the collection at their indexes.
+func requireIndexed[K string | int, V any](t *testing.T, col *LRU[K, V]) {
+	for _, h := range []*indexedHeap[K, V]{col.minHeap, col.maxHeap} {
+		require.Equal(t, col.Len(), h.Len())
+		for i, e := range h.entries {
+			require.Equal(t, i, e.heapIndex[h.slot])
+			require.Same(t, e, col.dict[e.Key].Value)
+			if i > 0 {
+				require.False(t, h.Less(i, (i-1)/2))
+			}
+		}
+	}
+}
+
+func TestLRU_Upsert(t *testing.T) {
+	var evicted evictions[string, int]
+	col := NewLRU[string, int](2, evicted.onEvict)
+	clock := fixedClock(col, time.Unix(1000, 0))
+	require.False(t, col.Upsert("a", 1))
+	require.False(t, col.UpsertWithTTL("b", 2, time.Second))
+	require.True(t, col.Upsert("a", 10))
+	require.Equal(t, []string{"b", "a"}, collect(col.IterateBy(ByInsertion)))
+
+	// replacing a value resets its TTL
+	require.True(t, col.Upsert("b", 20))
+	*clock = clock.Add(time.Second)
+	val, ok := col.At("b")
+	require.True(t, ok)
+	require.Equal(t, 20, val)
+	require.NoError(t, col.AddWithTTL("c", 3, time.Second))
+	require.Equal(t, []Pair[string, int]{{"a", 10}}, evicted.pairs)
+
+	// an expired value is evicted rather than replaced
+	*clock = clock.Add(time.Second)
+	require.False(t, col.Upsert("c", 30))
+	require.Equal(t, []Pair[string, int]{{"a", 10}, {"c", 3}}, evicted.pairs)
+	requireIndexed(t, col)
+}
+
+func TestLRU_PeekMinAndDelMax(t *testing.T) {
+	col := NewCollection[int, string]()
+	clock := fixedClock(col, time.Unix(1000, 0))
+	_, _, err := col.PeekMin()
+	require.ErrorIs(t, err, ErrEmptyCollection)
+	_, _, err = col.DelMax()
+	require.ErrorIs(t, err, ErrEmptyCollection)
+
+	for _, key := range []int{5, 1, 9, 3} {
+		require.NoError(t, col.Add(key, "v"))
+	}
+	require.NoError(t, col.AddWithTTL(0, "short", time.Second))
+	require.NoError(t, col.AddWithTTL(10, "short", time.Second))
+	*clock = clock.Add(time.Second)
+
+	key, _, err := col.PeekMin()
+	require.NoError(t, err)
+	require.Equal(t, 1, key)
+	require.Equal(t, 5, col.Len())
+	for _, want := range []int{9, 5} {
+		key, _, err = col.DelMax()
+		require.NoError(t, err)
+		require.Equal(t, want, key)
+	}
+	require.True(t, col.Delete(1))
+	key, _, err = col.PeekMin()
+	require.NoError(t, err)
+	require.Equal(t, 3, key)
+	requireIndexed(t, col)
+}
+
+func TestLRU_ArbitraryRemovalsKeepHeapsConsistent(t *testing.T) {
+	col := NewCollection[int, int]()
+	model := make(map[int]int)
+	rnd := rand.New(rand.NewPCG(1, 2))
+	for range 5000 {
+		key := rnd.IntN(200)
+		switch rnd.IntN(5) {
+		case 0:
+			if _, exists := model[key]; exists {
+				require.ErrorIs(t, col.Add(key, key), ErrDuplicateKey)
+			} else {
+				require.NoError(t, col.Add(key, key))
+				model[key] = key
+			}
+		case 1:
+			_, exists := model[key]
+			require.Equal(t, exists, col.Upsert(key, -key))
+			model[key] = -key
+		case 2:
+			_, exists := model[key]
+			require.Equal(t, exists, col.Delete(key))
+			delete(model, key)
+		case 3:
+			key, val, err := col.DelMin()
+			if len(model) == 0 {
+				require.ErrorIs(t, err, ErrEmptyCollection)
+				continue
+			}
+			require.NoError(t, err)
+			require.Equal(t, slices.Min(slices.Collect(maps.Keys(model))), key)
+			require.Equal(t, model[key], val)
+			delete(model, key)
+		case 4:
+			key, val, err := col.DelMax()
+			if len(model) == 0 {
+				require.ErrorIs(t, err, ErrEmptyCollection)
+				continue
+			}
+			require.NoError(t, err)
+			require.Equal(t, slices.Max(slices.Collect(maps.Keys(model))), key)
+			require.Equal(t, model[key], val)
+			delete(model, key)
+		}
+	}
+	requireIndexed(t, col)
+	require.Equal(t, slices.Sorted(maps.Keys(model)), keys(col.Ascending()))
+}
+
+func TestLRU_Purge(t *testing.T) {
+	var evicted evictions[int, int]
+	col := NewLRU[int, int](2, evicted.onEvict)
+	require.NoError(t, col.Add(1, 1))
+	require.NoError(t, col.Add(2, 2))
+	col.Purge()
+	require.Zero(t, col.Len())
+	require.Empty(t, evicted.pairs)
+	_, _, err := col.DelMin()
+	require.ErrorIs(t, err, ErrEmptyCollection)
+	require.NoError(t, col.Add(1, 1))
+	require.Equal(t, []int{1}, collect(col.IterateBy(ByInsertion)))
+}
+
+func TestLRU_NegativeCapacity(t *testing.T) {
+	require.Panics(t, func() { NewLRU[int, int](-1, nil) })
+}
+
+func TestMinHeap(t *testing.T) {
+	h := &MinHeap[int]{5, 2, 8}
+	heap.Init(h)
+	heap.Push(h, 1)
+	var popped []int
+	for h.Len() > 0 {
+		popped = append(popped, heap.Pop(h).(int))
+	}
+	require.Equal(t, []int{1, 2, 5, 8}, popped)
+}
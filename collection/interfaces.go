@@ -2,6 +2,7 @@ package collection
 
 import (
 	"errors"
+	"iter"
 
 	"golang.org/x/exp/constraints"
 )
@@ -10,6 +11,7 @@ var ErrDuplicateKey = errors.New("duplicate_key")
 var ErrEmptyIterator = errors.New("empty_iterator")
 var ErrEmptyCollection = errors.New("empty_collection")
 var ErrUnknownOrder = errors.New("unknown_order")
+var ErrModifiedCollection = errors.New("modified_collection")
 
 type IterationOrder int
 
@@ -21,6 +23,7 @@ const (
 type Iterator[K comparable, V any] interface {
 	HasNext() bool
 	// Next returns ErrEmptyIterator if there is no more elements (HasNext() is false)
+	// and ErrModifiedCollection if the collection was modified since the iterator was obtained.
 	Next() (K, V, error)
 }
 
@@ -29,18 +32,41 @@ type Collection[K constraints.Ordered, V any] interface {
 	//
 	// If there already is a value associated with the same key, ErrDuplicateKey is returned.
 	Add(key K, value V) error
+	// Upsert associates the specified value with the specified key, replacing the value already associated
+	// with it, if any. It reports whether a value was replaced.
+	Upsert(key K, value V) bool
+	// Delete removes the value associated with the specified key and reports whether there was one.
+	Delete(key K) bool
 	// DelMin removes the value associated with the minimum key from the collection and returns it.
 	//
 	// If the collection is empty, ErrEmptyCollection is returned.
 	DelMin() (K, V, error)
+	// DelMax removes the value associated with the maximum key from the collection and returns it.
+	//
+	// If the collection is empty, ErrEmptyCollection is returned.
+	DelMax() (K, V, error)
+	// PeekMin returns the value associated with the minimum key without removing it.
+	//
+	// If the collection is empty, ErrEmptyCollection is returned.
+	PeekMin() (K, V, error)
 	// Len returns the number of elements in the collection.
 	Len() int
 
 	// IterateBy returns an iterator over the elements of the collection in the specified order.
-	// Any modification of the collection corrupts all the iterators obtained prior the modification.
+	// Any modification of the collection invalidates all the iterators obtained prior the modification,
+	// unless the collection iterates over snapshots.
 	//
 	// If invalid order is passed, the function panics with ErrUnknownOrder
 	IterateBy(order IterationOrder) Iterator[K, V]
+
+	// All, Backward, Ascending and Descending return the sequences of the elements of the collection
+	// in the insertion order, its reverse, the ascending and the descending order of the keys.
+	// A sequence panics with ErrModifiedCollection if the collection is modified while it is ranged over,
+	// unless the collection iterates over snapshots.
+	All() iter.Seq2[K, V]
+	Backward() iter.Seq2[K, V]
+	Ascending() iter.Seq2[K, V]
+	Descending() iter.Seq2[K, V]
 	// At returns the value associated with the specified key.
 	At(key K) (V, bool)
 }
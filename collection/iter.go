@@ -0,0 +1,111 @@
+package collection
+
+import (
+	"container/heap"
+	"container/list"
+	"iter"
+
+	"golang.org/x/exp/constraints"
+)
+
+// All returns the sequence of the entries from the least to the most recently used one, like IterateBy(ByInsertion).
+// Expired entries are skipped. It panics with ErrModifiedCollection if the collection is modified by the loop body.
+func (col *LRU[K, V]) All() iter.Seq2[K, V] {
+	return col.walk((*list.List).Front, (*list.Element).Next)
+}
+
+// Backward returns the sequence of the entries from the most to the least recently used one, like All.
+func (col *LRU[K, V]) Backward() iter.Seq2[K, V] {
+	return col.walk((*list.List).Back, (*list.Element).Prev)
+}
+
+func (col *LRU[K, V]) walk(first func(*list.List) *list.Element, next func(*list.Element) *list.Element) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		version, now := col.version, col.now()
+		for el := first(col.list); el != nil; el = next(el) {
+			e := el.Value.(*entry[K, V])
+			if e.expired(now) {
+				continue
+			}
+			if !yield(e.Key, e.Val) {
+				return
+			}
+			col.checkVersion(version)
+		}
+	}
+}
+
+// Ascending returns the sequence of the entries in the ascending order of the keys, like All.
+// It walks the min-heap, so breaking the loop after k entries costs O(k log k).
+func (col *LRU[K, V]) Ascending() iter.Seq2[K, V] {
+	return col.walkHeap(col.minHeap)
+}
+
+// Descending returns the sequence of the entries in the descending order of the keys, like Ascending.
+func (col *LRU[K, V]) Descending() iter.Seq2[K, V] {
+	return col.walkHeap(col.maxHeap)
+}
+
+// walkHeap visits the entries of the heap in its order. It starts from the root, always visiting the top
+// entry among the children of the visited ones.
+func (col *LRU[K, V]) walkHeap(h *indexedHeap[K, V]) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		version, now := col.version, col.now()
+		frontier := &heapWalk[K, V]{heap: h}
+		if h.Len() > 0 {
+			frontier.indexes = []int{0}
+		}
+		for frontier.Len() > 0 {
+			index := heap.Pop(frontier).(int)
+			for _, child := range []int{2*index + 1, 2*index + 2} {
+				if child < h.Len() {
+					heap.Push(frontier, child)
+				}
+			}
+			e := h.entries[index]
+			if e.expired(now) {
+				continue
+			}
+			if !yield(e.Key, e.Val) {
+				return
+			}
+			col.checkVersion(version)
+		}
+	}
+}
+
+// checkVersion panics if the collection was modified since it was at version.
+func (col *LRU[K, V]) checkVersion(version uint64) {
+	if col.version != version {
+		panic(ErrModifiedCollection)
+	}
+}
+
+// heapWalk is the frontier of a walk over a heap: the indexes of the entries to visit, in the order of the heap.
+type heapWalk[K constraints.Ordered, V any] struct {
+	heap    *indexedHeap[K, V]
+	indexes []int
+}
+
+func (w *heapWalk[K, V]) Len() int {
+	return len(w.indexes)
+}
+
+func (w *heapWalk[K, V]) Less(i, j int) bool {
+	return w.heap.Less(w.indexes[i], w.indexes[j])
+}
+
+func (w *heapWalk[K, V]) Swap(i, j int) {
+	w.indexes[i], w.indexes[j] = w.indexes[j], w.indexes[i]
+}
+
+func (w *heapWalk[K, V]) Push(x any) {
+	w.indexes = append(w.indexes, x.(int))
+}
+
+func (w *heapWalk[K, V]) Pop() any {
+	n := len(w.indexes)
+	x := w.indexes[n-1]
+	w.indexes = w.indexes[:n-1]
+	return x
+}
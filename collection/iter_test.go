@@ -0,0 +1,140 @@
+package collection
+
+import (
+	"iter"
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func keys[K, V any](seq iter.Seq2[K, V]) []K {
+	var keys []K
+	for key := range seq {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func TestLRU_Sequences(t *testing.T) {
+	col := NewCollection[int, int]()
+	clock := fixedClock(col, time.Unix(1000, 0))
+	for _, key := range []int{4, 2, 7, 1, 9} {
+		require.NoError(t, col.Add(key, -key))
+	}
+	require.NoError(t, col.AddWithTTL(5, -5, time.Second))
+	// remove entries from the middle of the heaps, one of them to add it again
+	require.True(t, col.Delete(2))
+	require.True(t, col.Delete(9))
+	require.NoError(t, col.Add(9, -9))
+	*clock = clock.Add(time.Second)
+
+	require.Equal(t, []int{4, 7, 1, 9}, keys(col.All()))
+	require.Equal(t, collect(col.IterateBy(ByInsertion)), keys(col.All()))
+	require.Equal(t, []int{9, 1, 7, 4}, keys(col.Backward()))
+	require.Equal(t, []int{1, 4, 7, 9}, keys(col.Ascending()))
+	require.Equal(t, []int{9, 7, 4, 1}, keys(col.Descending()))
+	for key, val := range col.Ascending() {
+		require.Equal(t, -key, val)
+	}
+	// the expired entry is skipped but not evicted
+	require.Equal(t, 5, col.Len())
+}
+
+func TestLRU_AscendingWalksHeap(t *testing.T) {
+	col := NewCollection[int, int]()
+	for _, key := range rand.Perm(1000) {
+		require.NoError(t, col.Add(key, key))
+	}
+	for key := range 1000 {
+		if key%3 == 0 {
+			require.True(t, col.Delete(key))
+		}
+	}
+	ascending := keys(col.Ascending())
+	require.Len(t, ascending, col.Len())
+	require.True(t, slices.IsSorted(ascending))
+
+	var first []int
+	for key := range col.Ascending() {
+		if len(first) == 3 {
+			break
+		}
+		first = append(first, key)
+	}
+	require.Equal(t, []int{1, 2, 4}, first)
+}
+
+func TestLRU_DetectsModificationDuringIteration(t *testing.T) {
+	newCollection := func() *LRU[int, int] {
+		col := NewCollection[int, int]()
+		for key := range 3 {
+			require.NoError(t, col.Add(key, key))
+		}
+		return col
+	}
+	modifications := map[string]func(col *LRU[int, int]){
+		"Add":    func(col *LRU[int, int]) { _ = col.Add(10, 10) },
+		"DelMin": func(col *LRU[int, int]) { _, _, _ = col.DelMin() },
+		"Delete": func(col *LRU[int, int]) { col.Delete(2) },
+		"At":     func(col *LRU[int, int]) { col.At(0) },
+		"Purge":  func(col *LRU[int, int]) { col.Purge() },
+	}
+	for name, modify := range modifications {
+		t.Run(name, func(t *testing.T) {
+			sequences := []func(col *LRU[int, int]) iter.Seq2[int, int]{
+				(*LRU[int, int]).All, (*LRU[int, int]).Backward, (*LRU[int, int]).Ascending, (*LRU[int, int]).Descending,
+			}
+			for _, seq := range sequences {
+				col := newCollection()
+				require.PanicsWithValue(t, ErrModifiedCollection, func() {
+					for range seq(col) {
+						modify(col)
+					}
+				})
+			}
+
+			col := newCollection()
+			it := col.IterateBy(ByInsertion)
+			_, _, err := it.Next()
+			require.NoError(t, err)
+			modify(col)
+			_, _, err = it.Next()
+			require.ErrorIs(t, err, ErrModifiedCollection)
+		})
+	}
+}
+
+func TestLRU_LookupsDoNotInvalidateIterators(t *testing.T) {
+	col := NewCollection[int, int]()
+	for key := range 3 {
+		require.NoError(t, col.Add(key, key))
+	}
+	for key := range col.All() {
+		_, ok := col.At(key + 10)
+		require.False(t, ok)
+		require.False(t, col.Delete(key+10))
+	}
+}
+
+func TestShardedCollection_Sequences(t *testing.T) {
+	col := NewShardedCollection[int, int](4)
+	for _, key := range []int{4, 2, 7, 1, 9} {
+		require.NoError(t, col.Add(key, -key))
+	}
+	_, ok := col.At(2)
+	require.True(t, ok)
+
+	require.Equal(t, []int{4, 7, 1, 9, 2}, keys(col.All()))
+	require.Equal(t, []int{2, 9, 1, 7, 4}, keys(col.Backward()))
+	require.Equal(t, []int{1, 2, 4, 7, 9}, keys(col.Ascending()))
+	require.Equal(t, []int{9, 7, 4, 2, 1}, keys(col.Descending()))
+
+	// the sequences range over snapshots, so the collection may be modified meanwhile
+	for key := range col.Ascending() {
+		require.True(t, col.Delete(key))
+	}
+	require.Zero(t, col.Len())
+}
@@ -0,0 +1,304 @@
+package collection
+
+import (
+	"cmp"
+	"fmt"
+	"hash/maphash"
+	"iter"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/exp/constraints"
+)
+
+// stamped is a value of a ShardedCollection along with its position in the order of the whole collection.
+type stamped[V any] struct {
+	seq uint64
+	val V
+}
+
+type shard[K constraints.Ordered, V any] struct {
+	mu  sync.Mutex
+	col *LRU[K, *stamped[V]]
+}
+
+// ShardedCollection is a Collection safe for concurrent use. The keys are spread by hash over shards, each
+// an LRU guarded by its own lock, so the operations on a key only contend with those on the same shard.
+// DelMin and IterateBy, which need the whole collection, lock all the shards.
+//
+// The order of the entries is kept across the shards by stamping them with a sequence number when they are
+// added or accessed by At, so iterating is ordered from the least to the most recently used entry as in LRU.
+// A ShardedCollection created with a capacity splits it evenly between the shards, so an entry is evicted
+// when its shard is full, which approximates the least recently used one of the whole collection.
+type ShardedCollection[K constraints.Ordered, V any] struct {
+	shards []*shard[K, V]
+	seed   maphash.Seed
+	seq    atomic.Uint64
+}
+
+// NewShardedCollection creates an unbounded collection of the given number of shards.
+func NewShardedCollection[K constraints.Ordered, V any](shards int) *ShardedCollection[K, V] {
+	return NewShardedLRU[K, V](shards, 0, nil)
+}
+
+// NewShardedLRU creates a collection of the given number of shards holding about capacity entries, or an unbounded
+// one if capacity is 0. onEvict, unless nil, is called like for NewLRU, holding the lock of the entry's shard.
+func NewShardedLRU[K constraints.Ordered, V any](shards int, capacity int, onEvict func(K, V)) *ShardedCollection[K, V] {
+	if shards <= 0 {
+		panic(fmt.Sprintf("non-positive number of shards %d", shards))
+	}
+	if capacity < 0 {
+		panic(fmt.Sprintf("negative capacity %d", capacity))
+	}
+	var evict func(K, *stamped[V])
+	if onEvict != nil {
+		evict = func(key K, s *stamped[V]) { onEvict(key, s.val) }
+	}
+	// the capacity of the shards is rounded up, so that the whole capacity is usable
+	shardCapacity := (capacity + shards - 1) / shards
+	col := &ShardedCollection[K, V]{shards: make([]*shard[K, V], shards), seed: maphash.MakeSeed()}
+	for i := range col.shards {
+		col.shards[i] = &shard[K, V]{col: NewLRU[K, *stamped[V]](shardCapacity, evict)}
+	}
+	return col
+}
+
+func (col *ShardedCollection[K, V]) shardOf(key K) *shard[K, V] {
+	return col.shards[maphash.Comparable(col.seed, key)%uint64(len(col.shards))]
+}
+
+// Len returns the number of elements in the collection. Under concurrent modifications,
+// it is not a snapshot: the shards are counted one after another.
+func (col *ShardedCollection[K, V]) Len() int {
+	n := 0
+	for _, s := range col.shards {
+		s.mu.Lock()
+		n += s.col.Len()
+		s.mu.Unlock()
+	}
+	return n
+}
+
+func (col *ShardedCollection[K, V]) Add(key K, value V) error {
+	return col.AddWithTTL(key, value, 0)
+}
+
+// AddWithTTL adds the value like Add, but the entry expires after ttl, like LRU.AddWithTTL.
+func (col *ShardedCollection[K, V]) AddWithTTL(key K, value V, ttl time.Duration) error {
+	s := col.shardOf(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.col.AddWithTTL(key, &stamped[V]{seq: col.seq.Add(1), val: value}, ttl)
+}
+
+func (col *ShardedCollection[K, V]) Upsert(key K, value V) bool {
+	return col.UpsertWithTTL(key, value, 0)
+}
+
+// UpsertWithTTL upserts the value like Upsert, but the entry expires after ttl, like LRU.UpsertWithTTL.
+func (col *ShardedCollection[K, V]) UpsertWithTTL(key K, value V, ttl time.Duration) bool {
+	s := col.shardOf(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.col.UpsertWithTTL(key, &stamped[V]{seq: col.seq.Add(1), val: value}, ttl)
+}
+
+func (col *ShardedCollection[K, V]) DelMin() (K, V, error) {
+	return col.delTop(false)
+}
+
+func (col *ShardedCollection[K, V]) DelMax() (K, V, error) {
+	return col.delTop(true)
+}
+
+func (col *ShardedCollection[K, V]) PeekMin() (K, V, error) {
+	col.lockAll()
+	defer col.unlockAll()
+	s := col.top(false)
+	if s == nil {
+		var key K
+		var v V
+		return key, v, ErrEmptyCollection
+	}
+	key, stamp, err := s.col.PeekMin()
+	return key, stamp.val, err
+}
+
+func (col *ShardedCollection[K, V]) delTop(max bool) (K, V, error) {
+	col.lockAll()
+	defer col.unlockAll()
+	s := col.top(max)
+	if s == nil {
+		var key K
+		var v V
+		return key, v, ErrEmptyCollection
+	}
+	key, stamp, err := s.col.delFirst(s.heap(max))
+	return key, stamp.val, err
+}
+
+// top returns the shard holding the minimum key, or the maximum one if max is set, nil if all are empty.
+// The shards must be locked.
+func (col *ShardedCollection[K, V]) top(max bool) *shard[K, V] {
+	var top *shard[K, V]
+	var topKey K
+	for _, s := range col.shards {
+		e := s.col.first(s.heap(max))
+		if e != nil && (top == nil || (max && e.Key > topKey) || (!max && e.Key < topKey)) {
+			top, topKey = s, e.Key
+		}
+	}
+	return top
+}
+
+func (s *shard[K, V]) heap(max bool) *indexedHeap[K, *stamped[V]] {
+	if max {
+		return s.col.maxHeap
+	}
+	return s.col.minHeap
+}
+
+// At returns the value associated with the key and marks the entry as the most recently used one.
+func (col *ShardedCollection[K, V]) At(key K) (V, bool) {
+	s := col.shardOf(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stamp, ok := s.col.At(key)
+	if !ok {
+		var v V
+		return v, false
+	}
+	stamp.seq = col.seq.Add(1)
+	return stamp.val, true
+}
+
+func (col *ShardedCollection[K, V]) Delete(key K) bool {
+	s := col.shardOf(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.col.Delete(key)
+}
+
+// Purge removes all the entries.
+func (col *ShardedCollection[K, V]) Purge() {
+	col.lockAll()
+	defer col.unlockAll()
+	for _, s := range col.shards {
+		s.col.Purge()
+	}
+}
+
+// IterateBy returns an iterator over a snapshot of the collection, so unlike the iterators of LRU,
+// it is not affected by the modifications of the collection made after it is obtained.
+func (col *ShardedCollection[K, V]) IterateBy(order IterationOrder) Iterator[K, V] {
+	if order != ByInsertion && order != ByInsertionRev {
+		panic(ErrUnknownOrder)
+	}
+	pairs := col.snapshot()
+	if order == ByInsertionRev {
+		slices.Reverse(pairs)
+	}
+	return &SliceIterator[K, V]{Pairs: pairs}
+}
+
+// All returns the sequence of the entries of a snapshot of the collection from the least to the most
+// recently used one. Like the other sequences, it may be ranged over while modifying the collection.
+func (col *ShardedCollection[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		yieldAll(col.snapshot(), yield)
+	}
+}
+
+// Backward returns the sequence of the entries of a snapshot from the most to the least recently used one.
+func (col *ShardedCollection[K, V]) Backward() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		pairs := col.snapshot()
+		slices.Reverse(pairs)
+		yieldAll(pairs, yield)
+	}
+}
+
+// Ascending returns the sequence of the entries of a snapshot in the ascending order of the keys.
+func (col *ShardedCollection[K, V]) Ascending() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		pairs := col.snapshot()
+		slices.SortFunc(pairs, func(a, b Pair[K, V]) int { return cmp.Compare(a.Key, b.Key) })
+		yieldAll(pairs, yield)
+	}
+}
+
+// Descending returns the sequence of the entries of a snapshot in the descending order of the keys.
+func (col *ShardedCollection[K, V]) Descending() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		pairs := col.snapshot()
+		slices.SortFunc(pairs, func(a, b Pair[K, V]) int { return cmp.Compare(b.Key, a.Key) })
+		yieldAll(pairs, yield)
+	}
+}
+
+func yieldAll[K, V any](pairs []Pair[K, V], yield func(K, V) bool) {
+	for _, pair := range pairs {
+		if !yield(pair.Key, pair.Val) {
+			return
+		}
+	}
+}
+
+// snapshot copies the entries of all the shards from the least to the most recently used one.
+func (col *ShardedCollection[K, V]) snapshot() []Pair[K, V] {
+	var entries []stampedPair[K, V]
+	col.lockAll()
+	for _, s := range col.shards {
+		for key, stamp := range s.col.All() {
+			entries = append(entries, stampedPair[K, V]{stamp.seq, Pair[K, V]{key, stamp.val}})
+		}
+	}
+	col.unlockAll()
+
+	slices.SortFunc(entries, func(a, b stampedPair[K, V]) int { return cmp.Compare(a.seq, b.seq) })
+	pairs := make([]Pair[K, V], len(entries))
+	for i, entry := range entries {
+		pairs[i] = entry.pair
+	}
+	return pairs
+}
+
+type stampedPair[K, V any] struct {
+	seq  uint64
+	pair Pair[K, V]
+}
+
+// lockAll locks the shards in order, so that concurrent calls do not deadlock.
+func (col *ShardedCollection[K, V]) lockAll() {
+	for _, s := range col.shards {
+		s.mu.Lock()
+	}
+}
+
+func (col *ShardedCollection[K, V]) unlockAll() {
+	for _, s := range col.shards {
+		s.mu.Unlock()
+	}
+}
+
+// SliceIterator iterates over the pairs in the order of the slice.
+type SliceIterator[K comparable, V any] struct {
+	Pairs []Pair[K, V]
+}
+
+func (it *SliceIterator[K, V]) Next() (K, V, error) {
+	if len(it.Pairs) == 0 {
+		var key K
+		var val V
+		return key, val, ErrEmptyIterator
+	}
+	pair := it.Pairs[0]
+	it.Pairs = it.Pairs[1:]
+	return pair.Key, pair.Val, nil
+}
+
+func (it *SliceIterator[K, V]) HasNext() bool {
+	return len(it.Pairs) > 0
+}
@@ -0,0 +1,154 @@
+package collection
+
+import (
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var _ Collection[int, int] = (*LRU[int, int])(nil)
+var _ Collection[int, int] = (*ShardedCollection[int, int])(nil)
+
+func TestShardedCollection(t *testing.T) {
+	col := NewShardedCollection[int, string](4)
+	for _, key := range []int{5, 3, 8, 1} {
+		require.NoError(t, col.Add(key, "v"))
+	}
+	require.ErrorIs(t, col.Add(3, "again"), ErrDuplicateKey)
+	require.Equal(t, 4, col.Len())
+	require.Equal(t, []int{5, 3, 8, 1}, collect(col.IterateBy(ByInsertion)))
+
+	_, ok := col.At(3)
+	require.True(t, ok)
+	require.Equal(t, []int{3, 1, 8, 5}, collect(col.IterateBy(ByInsertionRev)))
+
+	for _, want := range []int{1, 3, 5, 8} {
+		key, _, err := col.DelMin()
+		require.NoError(t, err)
+		require.Equal(t, want, key)
+	}
+	_, _, err := col.DelMin()
+	require.ErrorIs(t, err, ErrEmptyCollection)
+	require.Panics(t, func() { col.IterateBy(IterationOrder(0)) })
+}
+
+func TestShardedCollection_UpsertPeekMinAndDelMax(t *testing.T) {
+	col := NewShardedCollection[int, string](4)
+	_, _, err := col.PeekMin()
+	require.ErrorIs(t, err, ErrEmptyCollection)
+	_, _, err = col.DelMax()
+	require.ErrorIs(t, err, ErrEmptyCollection)
+
+	for _, key := range []int{5, 3, 8, 1} {
+		require.False(t, col.Upsert(key, "v"))
+	}
+	require.True(t, col.Upsert(3, "new"))
+	require.Equal(t, []int{5, 8, 1, 3}, collect(col.IterateBy(ByInsertion)))
+	val, ok := col.At(3)
+	require.True(t, ok)
+	require.Equal(t, "new", val)
+
+	key, _, err := col.PeekMin()
+	require.NoError(t, err)
+	require.Equal(t, 1, key)
+	require.Equal(t, 4, col.Len())
+	key, _, err = col.DelMax()
+	require.NoError(t, err)
+	require.Equal(t, 8, key)
+	require.True(t, col.Delete(1))
+	key, _, err = col.DelMin()
+	require.NoError(t, err)
+	require.Equal(t, 3, key)
+}
+
+func TestShardedCollection_IteratesOverSnapshot(t *testing.T) {
+	col := NewShardedCollection[int, int](4)
+	for key := range 10 {
+		require.NoError(t, col.Add(key, key))
+	}
+	it := col.IterateBy(ByInsertion)
+	_, _, err := col.DelMin()
+	require.NoError(t, err)
+	require.True(t, col.Delete(5))
+	require.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, collect(it))
+}
+
+func TestShardedLRU_EvictsWithinShards(t *testing.T) {
+	var mu sync.Mutex
+	var evicted []int
+	col := NewShardedLRU[int, int](4, 8, func(key int, _ int) {
+		mu.Lock()
+		defer mu.Unlock()
+		evicted = append(evicted, key)
+	})
+	for key := range 100 {
+		require.NoError(t, col.Add(key, key))
+	}
+	require.Equal(t, 8, col.Len())
+	require.Len(t, evicted, 92)
+	// the survivors are the most recently added entries of their shards
+	kept := collect(col.IterateBy(ByInsertion))
+	for _, key := range kept {
+		require.NotContains(t, evicted, key)
+	}
+	require.True(t, slices.IsSorted(kept))
+}
+
+func TestShardedCollection_ParallelLoad(t *testing.T) {
+	const workers = 8
+	const perWorker = 500
+	col := NewShardedCollection[int, int](16)
+
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perWorker {
+				key := w*perWorker + i
+				require.NoError(t, col.Add(key, -key))
+				val, ok := col.At(key)
+				require.True(t, ok)
+				require.Equal(t, -key, val)
+				if i%10 == 0 {
+					require.True(t, col.Delete(key))
+				}
+				if i%50 == 0 {
+					collect(col.IterateBy(ByInsertionRev))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, workers*perWorker*9/10, col.Len())
+
+	// concurrent DelMin calls remove every key once, each caller seeing them in increasing order
+	removed := make([][]int, workers)
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				key, val, err := col.DelMin()
+				if err != nil {
+					require.ErrorIs(t, err, ErrEmptyCollection)
+					return
+				}
+				require.Equal(t, -key, val)
+				removed[w] = append(removed[w], key)
+			}
+		}()
+	}
+	wg.Wait()
+	var all []int
+	for _, keys := range removed {
+		require.True(t, slices.IsSorted(keys))
+		all = append(all, keys...)
+	}
+	slices.Sort(all)
+	require.Len(t, all, workers*perWorker*9/10)
+	require.Len(t, slices.Compact(all), len(all))
+	require.Zero(t, col.Len())
+}
@@ -1,8 +1,11 @@
 package httpapi
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"regexp"
 	"strings"
@@ -13,6 +16,10 @@ import (
 	"github.com/gorilla/mux"
 )
 
+const defaultPageSize = 10
+
+var userIdPattern = regexp.MustCompile(`^[0-9a-f]+$`)
+
 type HTTPHandler struct {
 	manager microblog.Manager
 }
@@ -26,6 +33,21 @@ func NewServer(manager microblog.Manager) *http.Server {
 	r.HandleFunc("/api/v1/users/{userId}/posts", handler.GetPosts).Methods(http.MethodGet)
 	r.HandleFunc("/maintenance/ping", handler.CheckIsReady).Methods(http.MethodGet)
 	r.HandleFunc("/api/v1/posts/{postId}", handler.ModifyPost).Methods(http.MethodPatch)
+	r.HandleFunc("/api/v1/posts/{postId}", handler.DeletePost).Methods(http.MethodDelete)
+	r.HandleFunc("/api/v1/posts/{postId}/revisions", handler.GetPostRevisions).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/posts/{postId}/likes", handler.LikePost).Methods(http.MethodPut)
+	r.HandleFunc("/api/v1/posts/{postId}/likes", handler.UnlikePost).Methods(http.MethodDelete)
+	r.HandleFunc("/api/v1/posts/{postId}/replies", handler.GetReplies).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/posts/{postId}/reposts", handler.Repost).Methods(http.MethodPost)
+	r.HandleFunc("/api/v1/posts/{postId}/thread", handler.GetThread).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/subscriptions/{userId}", handler.Subscribe).Methods(http.MethodPut)
+	r.HandleFunc("/api/v1/subscriptions/{userId}", handler.Unsubscribe).Methods(http.MethodDelete)
+	r.HandleFunc("/api/v1/users/{userId}/followers", handler.GetFollowers).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/users/{userId}/followees", handler.GetFollowees).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/feed", handler.GetFeed).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/tags/{tag}/posts", handler.GetTagPosts).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/users/{userId}/mentions", handler.GetMentions).Methods(http.MethodGet)
+	r.HandleFunc("/api/v1/search", handler.Search).Methods(http.MethodGet)
 	srv := &http.Server{
 		Addr:         "0.0.0.0:8080",
 		Handler:      r,
@@ -37,27 +59,107 @@ func NewServer(manager microblog.Manager) *http.Server {
 }
 
 type CreatePostRequest struct {
-	Text string `json:"text"`
+	Text      string `json:"text"`
+	InReplyTo string `json:"inReplyTo,omitempty"`
 }
 type CreatePostResponse struct {
-	PostId         string `json:"id"`
-	Text           string `json:"text"`
-	AuthorId       string `json:"authorId"`
-	CreatedAt      string `json:"createdAt"`
-	LastModifiedAt string `json:"lastModifiedAt"`
+	PostId         string   `json:"id"`
+	Text           string   `json:"text"`
+	AuthorId       string   `json:"authorId"`
+	CreatedAt      string   `json:"createdAt"`
+	LastModifiedAt string   `json:"lastModifiedAt"`
+	LikesCount     int64    `json:"likesCount"`
+	InReplyTo      string   `json:"inReplyTo,omitempty"`
+	RootId         string   `json:"rootId,omitempty"`
+	Kind           string   `json:"kind"`
+	RepostOf       string   `json:"repostOf,omitempty"`
+	RepostsCount   int64    `json:"repostsCount"`
+	Tags           []string `json:"tags,omitempty"`
+	Mentions       []string `json:"mentions,omitempty"`
+}
+
+func newPostResponse(post microblog.UserPost) CreatePostResponse {
+	kind := string(post.Kind)
+	if post.Kind == microblog.RegularPost {
+		kind = "post"
+	}
+	return CreatePostResponse{
+		PostId:         post.PostId,
+		Text:           post.Text,
+		AuthorId:       post.AuthorId,
+		CreatedAt:      post.CreatedAt.Format(time.RFC3339),
+		LastModifiedAt: post.LastModifiedAt.Format(time.RFC3339),
+		LikesCount:     post.LikesCount,
+		InReplyTo:      post.InReplyTo,
+		RootId:         post.RootId,
+		Kind:           kind,
+		RepostOf:       post.RepostOf,
+		RepostsCount:   post.RepostsCount,
+		Tags:           post.Tags,
+		Mentions:       post.Mentions,
+	}
 }
 
 type GetPostsResponse struct {
-	Posts    []CreatePostResponse `json:"posts"`
-	NextPage string               `json:"nextPage"`
+	Posts    []CreatePostResponse `json:"posts,omitempty"`
+	NextPage string               `json:"nextPage,omitempty"`
+}
+
+type FragmentResponse struct {
+	Text  string `json:"text"`
+	Match bool   `json:"match"`
+}
+
+type SearchResultResponse struct {
+	CreatePostResponse
+	Highlights []FragmentResponse `json:"highlights"`
+}
+
+type SearchResponse struct {
+	Posts    []SearchResultResponse `json:"posts,omitempty"`
+	NextPage string                 `json:"nextPage,omitempty"`
+}
+
+type GetThreadResponse struct {
+	Posts []CreatePostResponse `json:"posts"`
+}
+
+type RevisionResponse struct {
+	Text     string `json:"text"`
+	EditorId string `json:"editorId"`
+	EditedAt string `json:"editedAt"`
+}
+
+type GetRevisionsResponse struct {
+	Revisions []RevisionResponse `json:"revisions"`
+}
+
+type GetUsersResponse struct {
+	Users    []string `json:"users"`
+	NextPage string   `json:"nextPage,omitempty"`
+}
+
+// authenticatedUser returns the ID of the user making the request and whether it is well-formed.
+func authenticatedUser(r *http.Request) (string, bool) {
+	usrId := r.Header.Get("System-Design-User-Id")
+	return usrId, userIdPattern.MatchString(usrId)
+}
+
+// pageSize parses the size query parameter, falling back to defaultPageSize when it is absent.
+func pageSize(r *http.Request) uint8 {
+	var size uint8
+	fmt.Sscanf(r.URL.Query().Get("size"), "%d", &size)
+	if size == 0 {
+		size = defaultPageSize
+	}
+	return size
 }
 
 func (h *HTTPHandler) CreatePost(w http.ResponseWriter, r *http.Request) {
 	var body CreatePostResponse
 
-	usrId := r.Header.Get("System-Design-User-Id")
-	re := regexp.MustCompile(`^[0-9a-f]+$`)
-	if !re.MatchString(usrId) {
+	usrId, ok := authenticatedUser(r)
+	if !ok {
 		http.Error(w, "The user_id is not valid", http.StatusUnauthorized)
 		return
 	}
@@ -68,12 +170,22 @@ func (h *HTTPHandler) CreatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	post, err := h.manager.AddPost(r.Context(), usrId, body.Text)
+	var post microblog.UserPost
+	if body.InReplyTo != "" {
+		post, err = h.manager.AddReply(r.Context(), usrId, body.InReplyTo, body.Text)
+	} else {
+		post, err = h.manager.AddPost(r.Context(), usrId, body.Text)
+	}
+	if errors.Is(err, microblog.ErrNotFound) {
+		http.Error(w, "The post to reply to does not exist", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	rawResponse, _ := json.Marshal(CreatePostResponse{post.PostId, post.Text, post.AuthorId, post.CreatedAt.Format(time.RFC3339), post.LastModifiedAt.Format(time.RFC3339)})
+	rawResponse, _ := json.Marshal(newPostResponse(post))
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -87,7 +199,7 @@ func (h *HTTPHandler) GetPost(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		http.Error(w, "Post not found", http.StatusNotFound)
 	} else {
-		rawResponse, _ := json.Marshal(CreatePostResponse{post.PostId, post.Text, post.AuthorId, post.CreatedAt.Format(time.RFC3339), post.LastModifiedAt.Format(time.RFC3339)})
+		rawResponse, _ := json.Marshal(newPostResponse(post))
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write(rawResponse)
@@ -97,25 +209,108 @@ func (h *HTTPHandler) GetPost(w http.ResponseWriter, r *http.Request) {
 func (h *HTTPHandler) GetPosts(w http.ResponseWriter, r *http.Request) {
 	userId := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, `/api/v1/users/`), "/posts")
 	page := r.URL.Query().Get("page")
-	var pageSize uint8
-	fmt.Sscanf(r.URL.Query().Get("size"), "%d", &pageSize)
 
 	// Let the manager fetch the posts in the relevant page
-	posts, nextPage, err := h.manager.GetPostsInPage(r.Context(), userId, page, pageSize)
-	if err != nil {
+	posts, nextPage, err := h.manager.GetPostsInPage(r.Context(), userId, page, pageSize(r))
+	if errors.Is(err, microblog.ErrInvalidToken) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 	} else {
-		// Form HTTP response with the results
-		var resp GetPostsResponse
-		resp.NextPage = nextPage
-		for _, post := range posts {
-			resp.Posts = append(resp.Posts, CreatePostResponse{post.PostId, post.Text, post.AuthorId, post.CreatedAt.Format(time.RFC3339), post.LastModifiedAt.Format(time.RFC3339)})
+		writePostsPage(w, posts, nextPage)
+	}
+}
+
+func (h *HTTPHandler) GetFeed(w http.ResponseWriter, r *http.Request) {
+	usrId, ok := authenticatedUser(r)
+	if !ok {
+		http.Error(w, "The user_id is not valid", http.StatusUnauthorized)
+		return
+	}
+	posts, nextPage, err := h.manager.GetFeedInPage(r.Context(), usrId, r.URL.Query().Get("page"), pageSize(r))
+	if errors.Is(err, microblog.ErrInvalidToken) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writePostsPage(w, posts, nextPage)
+}
+
+func (h *HTTPHandler) GetTagPosts(w http.ResponseWriter, r *http.Request) {
+	posts, nextPage, err := h.manager.GetTagPostsInPage(r.Context(), mux.Vars(r)["tag"], r.URL.Query().Get("page"), pageSize(r))
+	if errors.Is(err, microblog.ErrInvalidToken) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writePostsPage(w, posts, nextPage)
+}
+
+func (h *HTTPHandler) GetMentions(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["userId"]
+	if !userIdPattern.MatchString(userId) {
+		http.Error(w, "The user_id is not valid", http.StatusBadRequest)
+		return
+	}
+	posts, nextPage, err := h.manager.GetMentionsInPage(r.Context(), userId, r.URL.Query().Get("page"), pageSize(r))
+	if errors.Is(err, microblog.ErrInvalidToken) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writePostsPage(w, posts, nextPage)
+}
+
+func (h *HTTPHandler) Search(w http.ResponseWriter, r *http.Request) {
+	query, err := microblog.ParseSearchQuery(r.URL.Query().Get("q"))
+	if err != nil {
+		http.Error(w, "The search query is not valid", http.StatusBadRequest)
+		return
+	}
+	posts, nextPage, err := h.manager.SearchPosts(r.Context(), query, r.URL.Query().Get("page"), pageSize(r))
+	if errors.Is(err, microblog.ErrInvalidQuery) || errors.Is(err, microblog.ErrInvalidToken) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := SearchResponse{NextPage: nextPage}
+	for _, post := range posts {
+		result := SearchResultResponse{CreatePostResponse: newPostResponse(post), Highlights: []FragmentResponse{}}
+		for _, fragment := range query.Highlight(post.Text) {
+			result.Highlights = append(result.Highlights, FragmentResponse{Text: fragment.Text, Match: fragment.Match})
 		}
-		rawResponse, _ := json.Marshal(resp)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write(rawResponse)
+		resp.Posts = append(resp.Posts, result)
 	}
+	rawResponse, _ := json.Marshal(resp)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(rawResponse)
+}
+
+// writePostsPage forms the HTTP response with a page of posts.
+func writePostsPage(w http.ResponseWriter, posts []microblog.UserPost, nextPage string) {
+	var resp GetPostsResponse
+	resp.NextPage = nextPage
+	for _, post := range posts {
+		resp.Posts = append(resp.Posts, newPostResponse(post))
+	}
+	rawResponse, _ := json.Marshal(resp)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(rawResponse)
 }
 
 func (h *HTTPHandler) CheckIsReady(w http.ResponseWriter, r *http.Request) {
@@ -138,15 +333,211 @@ func (h *HTTPHandler) ModifyPost(w http.ResponseWriter, r *http.Request) {
 	post, err := h.manager.GetPost(r.Context(), postId)
 	if err != nil {
 		http.Error(w, "Post not found", http.StatusNotFound)
+		return
 	}
 	if post.AuthorId != usrId {
 		http.Error(w, "You are not the author of this post", http.StatusForbidden)
+		return
 	}
-	post, err = h.manager.ModifyPost(r.Context(), postId, body.Text)
+	post, err = h.manager.ModifyPost(r.Context(), postId, usrId, body.Text)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rawResponse, _ := json.Marshal(newPostResponse(post))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(rawResponse)
+}
+
+func (h *HTTPHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
+	h.changeSubscription(w, r, h.manager.Subscribe)
+}
+
+func (h *HTTPHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	h.changeSubscription(w, r, h.manager.Unsubscribe)
+}
+
+func (h *HTTPHandler) changeSubscription(w http.ResponseWriter, r *http.Request, change func(ctx context.Context, userId string, targetId string) error) {
+	usrId, ok := authenticatedUser(r)
+	if !ok {
+		http.Error(w, "The user_id is not valid", http.StatusUnauthorized)
+		return
+	}
+	targetId := mux.Vars(r)["userId"]
+	if !userIdPattern.MatchString(targetId) {
+		http.Error(w, "The target user_id is not valid", http.StatusBadRequest)
+		return
+	}
+	err := change(r.Context(), usrId, targetId)
+	if errors.Is(err, microblog.ErrSelfSubscription) {
+		http.Error(w, "You cannot subscribe to yourself", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *HTTPHandler) GetFollowers(w http.ResponseWriter, r *http.Request) {
+	h.getUsers(w, r, h.manager.GetFollowers)
+}
+
+func (h *HTTPHandler) GetFollowees(w http.ResponseWriter, r *http.Request) {
+	h.getUsers(w, r, h.manager.GetFollowees)
+}
+
+func (h *HTTPHandler) getUsers(w http.ResponseWriter, r *http.Request, list func(ctx context.Context, userId string, token string, size uint8) ([]string, string, error)) {
+	userId := mux.Vars(r)["userId"]
+	users, nextPage, err := list(r.Context(), userId, r.URL.Query().Get("page"), pageSize(r))
+	if errors.Is(err, microblog.ErrInvalidToken) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp := GetUsersResponse{Users: users, NextPage: nextPage}
+	if resp.Users == nil {
+		resp.Users = []string{}
+	}
+	rawResponse, _ := json.Marshal(resp)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(rawResponse)
+}
+
+func (h *HTTPHandler) DeletePost(w http.ResponseWriter, r *http.Request) {
+	usrId, ok := authenticatedUser(r)
+	if !ok {
+		http.Error(w, "The user_id is not valid", http.StatusUnauthorized)
+		return
+	}
+	postId := mux.Vars(r)["postId"]
+	post, err := h.manager.GetPost(r.Context(), postId)
+	if err != nil {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	if post.AuthorId != usrId {
+		http.Error(w, "You are not the author of this post", http.StatusForbidden)
+		return
+	}
+	err = h.manager.DeletePost(r.Context(), postId)
+	if errors.Is(err, microblog.ErrNotFound) {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *HTTPHandler) GetPostRevisions(w http.ResponseWriter, r *http.Request) {
+	revisions, err := h.manager.GetPostRevisions(r.Context(), mux.Vars(r)["postId"])
+	if err != nil {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	resp := GetRevisionsResponse{Revisions: []RevisionResponse{}}
+	for _, revision := range revisions {
+		resp.Revisions = append(resp.Revisions, RevisionResponse{revision.Text, revision.EditorId, revision.EditedAt.Format(time.RFC3339)})
+	}
+	rawResponse, _ := json.Marshal(resp)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(rawResponse)
+}
+
+func (h *HTTPHandler) LikePost(w http.ResponseWriter, r *http.Request) {
+	h.changeLike(w, r, h.manager.LikePost)
+}
+
+func (h *HTTPHandler) UnlikePost(w http.ResponseWriter, r *http.Request) {
+	h.changeLike(w, r, h.manager.UnlikePost)
+}
+
+func (h *HTTPHandler) changeLike(w http.ResponseWriter, r *http.Request, change func(ctx context.Context, postID string, userId string) (microblog.UserPost, error)) {
+	usrId, ok := authenticatedUser(r)
+	if !ok {
+		http.Error(w, "The user_id is not valid", http.StatusUnauthorized)
+		return
+	}
+	post, err := change(r.Context(), mux.Vars(r)["postId"], usrId)
+	if errors.Is(err, microblog.ErrNotFound) {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rawResponse, _ := json.Marshal(newPostResponse(post))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(rawResponse)
+}
+
+func (h *HTTPHandler) GetReplies(w http.ResponseWriter, r *http.Request) {
+	posts, nextPage, err := h.manager.GetRepliesInPage(r.Context(), mux.Vars(r)["postId"], r.URL.Query().Get("page"), pageSize(r))
+	if errors.Is(err, microblog.ErrNotFound) {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, microblog.ErrInvalidToken) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writePostsPage(w, posts, nextPage)
+}
+
+func (h *HTTPHandler) GetThread(w http.ResponseWriter, r *http.Request) {
+	posts, err := h.manager.GetThread(r.Context(), mux.Vars(r)["postId"])
+	if err != nil {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	var resp GetThreadResponse
+	for _, post := range posts {
+		resp.Posts = append(resp.Posts, newPostResponse(post))
+	}
+	rawResponse, _ := json.Marshal(resp)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(rawResponse)
+}
+
+func (h *HTTPHandler) Repost(w http.ResponseWriter, r *http.Request) {
+	usrId, ok := authenticatedUser(r)
+	if !ok {
+		http.Error(w, "The user_id is not valid", http.StatusUnauthorized)
+		return
+	}
+	// the body with the quote is optional
+	var body CreatePostRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	post, err := h.manager.Repost(r.Context(), usrId, mux.Vars(r)["postId"], body.Text)
+	if errors.Is(err, microblog.ErrNotFound) {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
-	rawResponse, _ := json.Marshal(CreatePostResponse{post.PostId, post.Text, post.AuthorId, post.CreatedAt.Format(time.RFC3339), post.LastModifiedAt.Format(time.RFC3339)})
+	rawResponse, _ := json.Marshal(newPostResponse(post))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	_, _ = w.Write(rawResponse)
@@ -12,6 +12,8 @@ import (
 	"micro-blog/microblog/inmemoryimpl"
 	"micro-blog/microblog/mongoimpl"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"strconv"
 	"testing"
@@ -20,6 +22,7 @@ import (
 	"github.com/getkin/kin-openapi/openapi3filter"
 	openapi3_routers "github.com/getkin/kin-openapi/routers"
 	openapi3_legacy "github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -169,6 +172,555 @@ func (s *APISuite) TestGetPosts() {
 			}
 		}
 	})
+	s.Run("DefaultPageSize", func() {
+		userId := "defa17"
+		posts := s.setupUserPosts(userId, defaultPageSize+1)
+		var postsResp GetPostsResponse
+		resp, err := s.client.Get("http://localhost:8080/api/v1/users/" + userId + "/posts")
+		s.Require().NoError(err)
+		s.Require().NoError(json.NewDecoder(resp.Body).Decode(&postsResp))
+		s.Require().Equal(posts[:defaultPageSize], postsResp.Posts)
+		s.Require().NotEmpty(postsResp.NextPage)
+	})
+	s.Run("TamperedPage", func() {
+		var postsResp GetPostsResponse
+		url := "http://localhost:8080/api/v1/users/" + userId + "/posts?size=2"
+		resp, err := s.client.Get(url)
+		s.Require().NoError(err)
+		s.Require().NoError(json.NewDecoder(resp.Body).Decode(&postsResp))
+		s.Require().NotEmpty(postsResp.NextPage)
+
+		token := []byte(postsResp.NextPage)
+		if token[len(token)/2] == 'A' {
+			token[len(token)/2] = 'B'
+		} else {
+			token[len(token)/2] = 'A'
+		}
+		resp, err = s.client.Get(url + "&page=" + string(token))
+		s.Require().NoError(err)
+		s.Require().Equal(http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func (s *APISuite) subscriptionRequest(method string, userId string, targetId string) *http.Request {
+	req, err := http.NewRequest(method, "http://localhost:8080/api/v1/subscriptions/"+targetId, nil)
+	s.Require().NoError(err)
+	req.Header.Set("System-Design-User-Id", userId)
+	return req
+}
+
+func (s *APISuite) getUsers(url string) GetUsersResponse {
+	var usersResp GetUsersResponse
+	resp, err := s.client.Get(url)
+	s.Require().NoError(err)
+	s.Require().Equal(http.StatusOK, resp.StatusCode)
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&usersResp))
+	return usersResp
+}
+
+func (s *APISuite) TestSubscriptions() {
+	followee := "f00d"
+	followers := []string{"a1", "a2", "a3"}
+	for _, follower := range followers {
+		resp, err := s.client.Do(s.subscriptionRequest(http.MethodPut, follower, followee))
+		s.Require().NoError(err)
+		s.Require().Equal(http.StatusOK, resp.StatusCode)
+	}
+
+	s.Run("SubscribeToSelf", func() {
+		resp, err := s.client.Do(s.subscriptionRequest(http.MethodPut, followee, followee))
+		s.Require().NoError(err)
+		s.Require().Equal(http.StatusBadRequest, resp.StatusCode)
+	})
+	s.Run("GetFollowersByPages", func() {
+		usersResp := s.getUsers("http://localhost:8080/api/v1/users/" + followee + "/followers?size=2")
+		s.Require().Equal(followers[:2], usersResp.Users)
+		s.Require().NotEmpty(usersResp.NextPage)
+
+		usersResp = s.getUsers("http://localhost:8080/api/v1/users/" + followee + "/followers?size=2&page=" + usersResp.NextPage)
+		s.Require().Equal(followers[2:], usersResp.Users)
+		s.Require().Empty(usersResp.NextPage)
+	})
+	s.Run("GetFollowees", func() {
+		usersResp := s.getUsers("http://localhost:8080/api/v1/users/" + followers[0] + "/followees")
+		s.Require().Equal([]string{followee}, usersResp.Users)
+	})
+	s.Run("Unsubscribe", func() {
+		resp, err := s.client.Do(s.subscriptionRequest(http.MethodDelete, followers[1], followee))
+		s.Require().NoError(err)
+		s.Require().Equal(http.StatusOK, resp.StatusCode)
+
+		usersResp := s.getUsers("http://localhost:8080/api/v1/users/" + followee + "/followers")
+		s.Require().Equal([]string{followers[0], followers[2]}, usersResp.Users)
+	})
+}
+
+func (s *APISuite) TestGetFeed() {
+	reader := "fee1"
+	followees := []string{"b1", "b2"}
+	for _, followee := range followees {
+		resp, err := s.client.Do(s.subscriptionRequest(http.MethodPut, reader, followee))
+		s.Require().NoError(err)
+		s.Require().Equal(http.StatusOK, resp.StatusCode)
+	}
+	// posts are created alternately by the followees, so the feed must interleave them
+	var expected []CreatePostResponse
+	for i := 0; i < 3; i++ {
+		for _, followee := range followees {
+			expected = append([]CreatePostResponse{s.setupUserPosts(followee, 1)[0]}, expected...)
+		}
+	}
+	s.setupUserPosts("b3", 2)
+
+	var feed []CreatePostResponse
+	var feedResp GetPostsResponse
+	for {
+		req, err := http.NewRequest(http.MethodGet, "http://localhost:8080/api/v1/feed", nil)
+		s.Require().NoError(err)
+		req.Header.Set("System-Design-User-Id", reader)
+		q := req.URL.Query()
+		q.Add("size", "4")
+		if feedResp.NextPage != "" {
+			q.Add("page", feedResp.NextPage)
+		}
+		req.URL.RawQuery = q.Encode()
+		resp, err := s.client.Do(req)
+		s.Require().NoError(err)
+		s.Require().Equal(http.StatusOK, resp.StatusCode)
+		feedResp = GetPostsResponse{}
+		s.Require().NoError(json.NewDecoder(resp.Body).Decode(&feedResp))
+		feed = append(feed, feedResp.Posts...)
+		if feedResp.NextPage == "" {
+			break
+		}
+	}
+	s.Require().Equal(expected, feed)
+}
+
+func (s *APISuite) deletePostRequest(userId string, postId string) *http.Request {
+	req, err := http.NewRequest(http.MethodDelete, "http://localhost:8080/api/v1/posts/"+postId, nil)
+	s.Require().NoError(err)
+	req.Header.Set("System-Design-User-Id", userId)
+	return req
+}
+
+func (s *APISuite) TestDeletePost() {
+	userId := "de1e7e"
+	posts := s.setupUserPosts(userId, 5)
+
+	s.Run("DeleteOthersPost", func() {
+		resp, err := s.client.Do(s.deletePostRequest("abc123", posts[0].PostId))
+		s.Require().NoError(err)
+		s.Require().Equal(http.StatusForbidden, resp.StatusCode)
+	})
+	s.Run("DeleteKeepsPageTokens", func() {
+		var postsResp GetPostsResponse
+		resp, err := s.client.Get("http://localhost:8080/api/v1/users/" + userId + "/posts?size=2")
+		s.Require().NoError(err)
+		s.Require().NoError(json.NewDecoder(resp.Body).Decode(&postsResp))
+		s.Require().Equal(posts[:2], postsResp.Posts)
+
+		// delete the last post of the first page and the first post of the second one
+		for _, post := range posts[1:3] {
+			resp, err = s.client.Do(s.deletePostRequest(userId, post.PostId))
+			s.Require().NoError(err)
+			s.Require().Equal(http.StatusOK, resp.StatusCode)
+		}
+
+		nextPage := postsResp.NextPage
+		postsResp = GetPostsResponse{}
+		resp, err = s.client.Get("http://localhost:8080/api/v1/users/" + userId + "/posts?size=2&page=" + nextPage)
+		s.Require().NoError(err)
+		s.Require().NoError(json.NewDecoder(resp.Body).Decode(&postsResp))
+		s.Require().Equal(posts[3:], postsResp.Posts)
+		s.Require().Empty(postsResp.NextPage)
+	})
+	s.Run("GetDeletedPost", func() {
+		resp, err := s.client.Get("http://localhost:8080/api/v1/posts/" + posts[1].PostId)
+		s.Require().NoError(err)
+		s.Require().Equal(http.StatusNotFound, resp.StatusCode)
+
+		resp, err = s.client.Do(s.deletePostRequest(userId, posts[1].PostId))
+		s.Require().NoError(err)
+		s.Require().Equal(http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func (s *APISuite) modifyPostRequest(userId string, postId string, text string) *http.Request {
+	body, err := json.Marshal(&CreatePostRequest{Text: text})
+	s.Require().NoError(err)
+	req, err := http.NewRequest(http.MethodPatch, "http://localhost:8080/api/v1/posts/"+postId, bytes.NewReader(body))
+	s.Require().NoError(err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("System-Design-User-Id", userId)
+	return req
+}
+
+func (s *APISuite) TestPostRevisions() {
+	userId := "ed17"
+	post := s.setupUserPosts(userId, 1)[0]
+
+	s.Run("ModifyOthersPost", func() {
+		resp, err := s.client.Do(s.modifyPostRequest("abc123", post.PostId, "Hijacked"))
+		s.Require().NoError(err)
+		s.Require().Equal(http.StatusForbidden, resp.StatusCode)
+	})
+	s.Run("GetRevisions", func() {
+		for _, text := range []string{"Second version", "Third version"} {
+			resp, err := s.client.Do(s.modifyPostRequest(userId, post.PostId, text))
+			s.Require().NoError(err)
+			s.Require().Equal(http.StatusOK, resp.StatusCode)
+		}
+
+		var revisionsResp GetRevisionsResponse
+		resp, err := s.client.Get("http://localhost:8080/api/v1/posts/" + post.PostId + "/revisions")
+		s.Require().NoError(err)
+		s.Require().Equal(http.StatusOK, resp.StatusCode)
+		s.Require().NoError(json.NewDecoder(resp.Body).Decode(&revisionsResp))
+		s.Require().Len(revisionsResp.Revisions, 2)
+		s.Require().Equal("Second version", revisionsResp.Revisions[0].Text)
+		s.Require().Equal(post.Text, revisionsResp.Revisions[1].Text)
+		s.Require().Equal(userId, revisionsResp.Revisions[1].EditorId)
+	})
+	s.Run("GetRevisionsOfNotExistPost", func() {
+		resp, err := s.client.Get("http://localhost:8080/api/v1/posts/post4/revisions")
+		s.Require().NoError(err)
+		s.Require().Equal(http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func (s *APISuite) likeRequest(method string, userId string, postId string) *http.Request {
+	req, err := http.NewRequest(method, "http://localhost:8080/api/v1/posts/"+postId+"/likes", nil)
+	s.Require().NoError(err)
+	req.Header.Set("System-Design-User-Id", userId)
+	return req
+}
+
+func (s *APISuite) TestLikes() {
+	post := s.setupUserPosts("11ce", 1)[0]
+	s.Require().Zero(post.LikesCount)
+
+	like := func(method string, userId string) CreatePostResponse {
+		var body CreatePostResponse
+		resp, err := s.client.Do(s.likeRequest(method, userId, post.PostId))
+		s.Require().NoError(err)
+		s.Require().Equal(http.StatusOK, resp.StatusCode)
+		s.Require().NoError(json.NewDecoder(resp.Body).Decode(&body))
+		return body
+	}
+	s.Run("LikeIsIdempotent", func() {
+		s.Require().EqualValues(1, like(http.MethodPut, "a1").LikesCount)
+		s.Require().EqualValues(1, like(http.MethodPut, "a1").LikesCount)
+		s.Require().EqualValues(2, like(http.MethodPut, "a2").LikesCount)
+	})
+	s.Run("UnlikeIsIdempotent", func() {
+		s.Require().EqualValues(1, like(http.MethodDelete, "a1").LikesCount)
+		s.Require().EqualValues(1, like(http.MethodDelete, "a1").LikesCount)
+	})
+	s.Run("GetPostWithLikes", func() {
+		var body CreatePostResponse
+		resp, err := s.client.Get("http://localhost:8080/api/v1/posts/" + post.PostId)
+		s.Require().NoError(err)
+		s.Require().NoError(json.NewDecoder(resp.Body).Decode(&body))
+		s.Require().EqualValues(1, body.LikesCount)
+	})
+	s.Run("LikeNotExistPost", func() {
+		resp, err := s.client.Do(s.likeRequest(http.MethodPut, "a1", "post4"))
+		s.Require().NoError(err)
+		s.Require().Equal(http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func (s *APISuite) createReply(userId string, inReplyTo string, text string) CreatePostResponse {
+	var reply CreatePostResponse
+	resp, err := s.client.Do(s.createPostRequest(userId, &CreatePostRequest{Text: text, InReplyTo: inReplyTo}))
+	s.Require().NoError(err)
+	s.Require().Equal(http.StatusOK, resp.StatusCode)
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&reply))
+	return reply
+}
+
+func (s *APISuite) TestReplies() {
+	root := s.setupUserPosts("7e1", 1)[0]
+	first := s.createReply("a1", root.PostId, "First reply")
+	nested := s.createReply("a2", first.PostId, "Reply to the first reply")
+	second := s.createReply("a1", root.PostId, "Second reply")
+
+	s.Run("ReplyReferences", func() {
+		s.Require().Equal(root.PostId, first.InReplyTo)
+		s.Require().Equal(root.PostId, first.RootId)
+		s.Require().Equal(first.PostId, nested.InReplyTo)
+		s.Require().Equal(root.PostId, nested.RootId)
+	})
+	s.Run("ReplyToNotExistPost", func() {
+		resp, err := s.client.Do(s.createPostRequest("a1", &CreatePostRequest{Text: "Hello?", InReplyTo: "post4"}))
+		s.Require().NoError(err)
+		s.Require().Equal(http.StatusBadRequest, resp.StatusCode)
+	})
+	s.Run("GetReplies", func() {
+		var postsResp GetPostsResponse
+		resp, err := s.client.Get("http://localhost:8080/api/v1/posts/" + root.PostId + "/replies?size=1")
+		s.Require().NoError(err)
+		s.Require().NoError(json.NewDecoder(resp.Body).Decode(&postsResp))
+		s.Require().Equal([]CreatePostResponse{second}, postsResp.Posts)
+
+		nextPage := postsResp.NextPage
+		postsResp = GetPostsResponse{}
+		resp, err = s.client.Get("http://localhost:8080/api/v1/posts/" + root.PostId + "/replies?size=1&page=" + nextPage)
+		s.Require().NoError(err)
+		s.Require().NoError(json.NewDecoder(resp.Body).Decode(&postsResp))
+		s.Require().Equal([]CreatePostResponse{first}, postsResp.Posts)
+		s.Require().Empty(postsResp.NextPage)
+	})
+	s.Run("GetThread", func() {
+		var threadResp GetThreadResponse
+		resp, err := s.client.Get("http://localhost:8080/api/v1/posts/" + nested.PostId + "/thread")
+		s.Require().NoError(err)
+		s.Require().Equal(http.StatusOK, resp.StatusCode)
+		s.Require().NoError(json.NewDecoder(resp.Body).Decode(&threadResp))
+		s.Require().Equal([]CreatePostResponse{root, first, nested}, threadResp.Posts)
+	})
+}
+
+func (s *APISuite) repost(userId string, postId string, quote string) CreatePostResponse {
+	var body io.Reader
+	if quote != "" {
+		raw, err := json.Marshal(&CreatePostRequest{Text: quote})
+		s.Require().NoError(err)
+		body = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:8080/api/v1/posts/"+postId+"/reposts", body)
+	s.Require().NoError(err)
+	req.Header.Set("System-Design-User-Id", userId)
+	if quote != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	var repost CreatePostResponse
+	resp, err := s.client.Do(req)
+	s.Require().NoError(err)
+	s.Require().Equal(http.StatusOK, resp.StatusCode)
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&repost))
+	return repost
+}
+
+func (s *APISuite) TestReposts() {
+	original := s.setupUserPosts("0419", 1)[0]
+	reposter := "4e905"
+
+	repost := s.repost(reposter, original.PostId, "")
+	s.Run("RepostReferencesOriginal", func() {
+		s.Require().Equal("repost", repost.Kind)
+		s.Require().Equal(original.PostId, repost.RepostOf)
+		s.Require().Equal(reposter, repost.AuthorId)
+	})
+	s.Run("RepeatedRepostIsDeduplicated", func() {
+		s.Require().Equal(repost, s.repost(reposter, original.PostId, ""))
+		// reposting the repost shares the original post
+		s.Require().Equal(repost, s.repost(reposter, repost.PostId, ""))
+	})
+	quote := s.repost(reposter, original.PostId, "Look at this!")
+	s.Run("QuotePost", func() {
+		s.Require().Equal("quote", quote.Kind)
+		s.Require().Equal("Look at this!", quote.Text)
+		s.Require().Equal(original.PostId, quote.RepostOf)
+	})
+	s.Run("RepostsCount", func() {
+		var body CreatePostResponse
+		resp, err := s.client.Get("http://localhost:8080/api/v1/posts/" + original.PostId)
+		s.Require().NoError(err)
+		s.Require().NoError(json.NewDecoder(resp.Body).Decode(&body))
+		s.Require().EqualValues(2, body.RepostsCount)
+	})
+	s.Run("RepostsInReposterTimeline", func() {
+		var postsResp GetPostsResponse
+		resp, err := s.client.Get("http://localhost:8080/api/v1/users/" + reposter + "/posts")
+		s.Require().NoError(err)
+		s.Require().NoError(json.NewDecoder(resp.Body).Decode(&postsResp))
+		s.Require().Equal([]CreatePostResponse{quote, repost}, postsResp.Posts)
+	})
+}
+
+func (s *APISuite) getTagPosts(tag string) GetPostsResponse {
+	var postsResp GetPostsResponse
+	resp, err := s.client.Get("http://localhost:8080/api/v1/tags/" + tag + "/posts")
+	s.Require().NoError(err)
+	s.Require().Equal(http.StatusOK, resp.StatusCode)
+	s.Require().NoError(json.NewDecoder(resp.Body).Decode(&postsResp))
+	return postsResp
+}
+
+func (s *APISuite) TestTagPosts() {
+	userId := "7a9"
+	var posts []CreatePostResponse
+	for _, text := range []string{"Learning #Golang", "No tags", "#golang and #Redis", "#redis only"} {
+		resp, err := s.client.Do(s.createPostRequest(userId, &CreatePostRequest{Text: text}))
+		s.Require().NoError(err)
+		var post CreatePostResponse
+		s.Require().NoError(json.NewDecoder(resp.Body).Decode(&post))
+		posts = append(posts, post)
+	}
+
+	s.Run("ExtractedTags", func() {
+		s.Require().Equal([]string{"golang"}, posts[0].Tags)
+		s.Require().Empty(posts[1].Tags)
+		s.Require().Equal([]string{"golang", "redis"}, posts[2].Tags)
+	})
+	s.Run("GetTagPosts", func() {
+		s.Require().Equal([]CreatePostResponse{posts[2], posts[0]}, s.getTagPosts("GoLang").Posts)
+		s.Require().Equal([]CreatePostResponse{posts[3], posts[2]}, s.getTagPosts("redis").Posts)
+		s.Require().Empty(s.getTagPosts("unknown").Posts)
+	})
+	s.Run("ModifyUpdatesTags", func() {
+		resp, err := s.client.Do(s.modifyPostRequest(userId, posts[0].PostId, "Learning #Redis"))
+		s.Require().NoError(err)
+		s.Require().Equal(http.StatusOK, resp.StatusCode)
+		golang := s.getTagPosts("golang").Posts
+		s.Require().Len(golang, 1)
+		s.Require().Equal(posts[2].PostId, golang[0].PostId)
+		s.Require().Len(s.getTagPosts("redis").Posts, 3)
+	})
+}
+
+func (s *APISuite) getMentions(userId string) (int, GetPostsResponse) {
+	var postsResp GetPostsResponse
+	resp, err := s.client.Get("http://localhost:8080/api/v1/users/" + userId + "/mentions")
+	s.Require().NoError(err)
+	if resp.StatusCode == http.StatusOK {
+		s.Require().NoError(json.NewDecoder(resp.Body).Decode(&postsResp))
+	}
+	return resp.StatusCode, postsResp
+}
+
+func (s *APISuite) TestMentions() {
+	userId := "6e1"
+	var posts []CreatePostResponse
+	for _, text := range []string{"Hi @3c1 and @3c2", "Hi @Bob", "@3c1 again, @3c1!"} {
+		resp, err := s.client.Do(s.createPostRequest(userId, &CreatePostRequest{Text: text}))
+		s.Require().NoError(err)
+		var post CreatePostResponse
+		s.Require().NoError(json.NewDecoder(resp.Body).Decode(&post))
+		posts = append(posts, post)
+	}
+
+	s.Run("ExtractedMentions", func() {
+		s.Require().Equal([]string{"3c1", "3c2"}, posts[0].Mentions)
+		s.Require().Empty(posts[1].Mentions)
+		s.Require().Equal([]string{"3c1"}, posts[2].Mentions)
+	})
+	s.Run("GetMentions", func() {
+		code, page := s.getMentions("3c1")
+		s.Require().Equal(http.StatusOK, code)
+		s.Require().Equal([]CreatePostResponse{posts[2], posts[0]}, page.Posts)
+		code, page = s.getMentions("3c3")
+		s.Require().Equal(http.StatusOK, code)
+		s.Require().Empty(page.Posts)
+	})
+	s.Run("InvalidUserId", func() {
+		code, _ := s.getMentions("Bob")
+		s.Require().Equal(http.StatusBadRequest, code)
+	})
+	s.Run("ModifyUpdatesMentions", func() {
+		resp, err := s.client.Do(s.modifyPostRequest(userId, posts[0].PostId, "Hi @3c3"))
+		s.Require().NoError(err)
+		s.Require().Equal(http.StatusOK, resp.StatusCode)
+		_, page := s.getMentions("3c2")
+		s.Require().Empty(page.Posts)
+		_, page = s.getMentions("3c1")
+		s.Require().Len(page.Posts, 1)
+		s.Require().Equal(posts[2].PostId, page.Posts[0].PostId)
+		_, page = s.getMentions("3c3")
+		s.Require().Len(page.Posts, 1)
+		s.Require().Equal([]string{"3c3"}, page.Posts[0].Mentions)
+	})
+}
+
+func (s *APISuite) search(query string, page string, size int) (int, SearchResponse) {
+	var searchResp SearchResponse
+	params := url.Values{"q": {query}, "size": {strconv.Itoa(size)}}
+	if page != "" {
+		params.Set("page", page)
+	}
+	resp, err := s.client.Get("http://localhost:8080/api/v1/search?" + params.Encode())
+	s.Require().NoError(err)
+	if resp.StatusCode == http.StatusOK {
+		s.Require().NoError(json.NewDecoder(resp.Body).Decode(&searchResp))
+	}
+	return resp.StatusCode, searchResp
+}
+
+func (s *APISuite) TestSearch() {
+	var posts []CreatePostResponse
+	for _, post := range []struct{ userId, text string }{
+		{"5e1", "Zebras and giraffes"},
+		{"5e2", "A zebra crossing, zebras everywhere, zebras"},
+		{"5e1", "Giraffes only"},
+		{"5e2", "The quick zebras jumped over the lazy giraffes"},
+	} {
+		resp, err := s.client.Do(s.createPostRequest(post.userId, &CreatePostRequest{Text: post.text}))
+		s.Require().NoError(err)
+		var created CreatePostResponse
+		s.Require().NoError(json.NewDecoder(resp.Body).Decode(&created))
+		posts = append(posts, created)
+	}
+	ids := func(results []SearchResultResponse) []string {
+		var postIds []string
+		for _, result := range results {
+			postIds = append(postIds, result.PostId)
+		}
+		return postIds
+	}
+
+	s.Run("Ranking", func() {
+		code, page := s.search("zebras", "", 10)
+		s.Require().Equal(http.StatusOK, code)
+		s.Require().Equal([]string{posts[1].PostId, posts[0].PostId, posts[3].PostId}, ids(page.Posts))
+	})
+	s.Run("Pagination", func() {
+		var found []string
+		token := ""
+		for {
+			_, page := s.search("zebras giraffes", token, 1)
+			found = append(found, ids(page.Posts)...)
+			if page.NextPage == "" {
+				break
+			}
+			token = page.NextPage
+		}
+		_, all := s.search("zebras giraffes", "", 10)
+		s.Require().Len(found, 4)
+		s.Require().Equal(ids(all.Posts), found)
+	})
+	s.Run("Phrase", func() {
+		_, page := s.search(`"lazy giraffes"`, "", 10)
+		s.Require().Equal([]string{posts[3].PostId}, ids(page.Posts))
+		_, page = s.search(`"giraffes lazy"`, "", 10)
+		s.Require().Empty(page.Posts)
+	})
+	s.Run("Filters", func() {
+		_, page := s.search("giraffes author:5e1", "", 10)
+		s.Require().ElementsMatch([]string{posts[0].PostId, posts[2].PostId}, ids(page.Posts))
+		_, page = s.search("giraffes before:2000-01-01", "", 10)
+		s.Require().Empty(page.Posts)
+		_, page = s.search("giraffes after:2000-01-01", "", 10)
+		s.Require().Len(page.Posts, 3)
+	})
+	s.Run("Highlights", func() {
+		_, page := s.search(`"quick zebras" lazy`, "", 10)
+		s.Require().Len(page.Posts, 1)
+		s.Require().Equal([]FragmentResponse{
+			{Text: "The "},
+			{Text: "quick zebras", Match: true},
+			{Text: " jumped over the "},
+			{Text: "lazy", Match: true},
+			{Text: " giraffes"},
+		}, page.Posts[0].Highlights)
+	})
+	s.Run("InvalidQuery", func() {
+		code, _ := s.search("zebras author:Bob", "", 10)
+		s.Require().Equal(http.StatusBadRequest, code)
+		code, _ = s.search("zebras", "invalid", 10)
+		s.Require().Equal(http.StatusBadRequest, code)
+	})
 }
 
 func (s *APISuite) specValidating(transport http.RoundTripper) http.RoundTripper {
@@ -244,3 +796,62 @@ type RoundTripperFunc func(*http.Request) (*http.Response, error)
 func (fn RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
 	return fn(req)
 }
+
+// failingManager fails the reads of the listings with a storage error.
+type failingManager struct {
+	microblog.Manager
+}
+
+var errFailingStorage = fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
+
+func (failingManager) GetPostsInPage(context.Context, string, string, uint8) ([]microblog.UserPost, string, error) {
+	return nil, "", errFailingStorage
+}
+
+func (failingManager) GetFeedInPage(context.Context, string, string, uint8) ([]microblog.UserPost, string, error) {
+	return nil, "", errFailingStorage
+}
+
+func (failingManager) GetFollowers(context.Context, string, string, uint8) ([]string, string, error) {
+	return nil, "", errFailingStorage
+}
+
+func (failingManager) GetFollowees(context.Context, string, string, uint8) ([]string, string, error) {
+	return nil, "", errFailingStorage
+}
+
+func (failingManager) GetRepliesInPage(context.Context, string, string, uint8) ([]microblog.UserPost, string, error) {
+	return nil, "", errFailingStorage
+}
+
+func (failingManager) GetTagPostsInPage(context.Context, string, string, uint8) ([]microblog.UserPost, string, error) {
+	return nil, "", errFailingStorage
+}
+
+func (failingManager) GetMentionsInPage(context.Context, string, string, uint8) ([]microblog.UserPost, string, error) {
+	return nil, "", errFailingStorage
+}
+
+func (failingManager) SearchPosts(context.Context, microblog.SearchQuery, string, uint8) ([]microblog.UserPost, string, error) {
+	return nil, "", errFailingStorage
+}
+
+func TestStorageErrors(t *testing.T) {
+	handler := NewServer(failingManager{}).Handler
+	for _, path := range []string{
+		"/api/v1/users/abc123/posts",
+		"/api/v1/feed",
+		"/api/v1/users/abc123/followers",
+		"/api/v1/users/abc123/followees",
+		"/api/v1/posts/-JWKIlfk---/replies",
+		"/api/v1/tags/golang/posts",
+		"/api/v1/users/abc123/mentions",
+		"/api/v1/search?q=golang",
+	} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("System-Design-User-Id", "abc123")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusInternalServerError, rec.Code, path)
+	}
+}
@@ -1,33 +1,66 @@
 package main
 
 import (
+	"context"
 	"log"
 	"micro-blog/httpapi"
 	"micro-blog/microblog"
+	"micro-blog/microblog/idgen"
 	"micro-blog/microblog/inmemoryimpl"
+	"micro-blog/microblog/localcacheimpl"
 	"micro-blog/microblog/mongoimpl"
+	"micro-blog/microblog/pgimpl"
 	"micro-blog/microblog/redisimpl"
+	"micro-blog/microblog/sqliteimpl"
 	"os"
+	"strconv"
 
 	"github.com/redis/go-redis/v9"
 )
 
+// walCompactAfter is the number of write-ahead log records of the durable in-memory mode between snapshots.
+const walCompactAfter = 10_000
+
+// localCacheCapacity is the number of hot posts the cached mode keeps in process memory.
+const localCacheCapacity = 10_000
+
 func main() {
+	if key := os.Getenv("PAGE_TOKEN_KEY"); key != "" {
+		microblog.SetPageTokenKey([]byte(key))
+	}
+	if node := os.Getenv("NODE_ID"); node != "" {
+		id, err := strconv.Atoi(node)
+		if err != nil {
+			log.Fatalf("malformed NODE_ID %q", node)
+		}
+		idgen.SetNode(id)
+	}
 	mode := os.Getenv("STORAGE_MODE")
 	var manager microblog.Manager
 	if mode == "inmemory" {
-		manager = inmemoryimpl.NewInMemoryManager()
+		if dir := os.Getenv("INMEMORY_DATA_DIR"); dir != "" {
+			manager = inmemoryimpl.NewDurableInMemoryManager(dir, walCompactAfter)
+		} else {
+			manager = inmemoryimpl.NewInMemoryManager()
+		}
 	} else if mode == "mongo" {
 		dbName := os.Getenv("MONGO_DB_NAME")
 		url := os.Getenv("MONGO_URL")
 		manager = mongoimpl.NewMongoManager(url, dbName)
+	} else if mode == "postgres" {
+		manager = pgimpl.NewPostgresManager(os.Getenv("POSTGRES_URL"))
+	} else if mode == "sqlite" {
+		manager = sqliteimpl.NewSQLiteManager(os.Getenv("SQLITE_PATH"))
 	} else if mode == "cached" {
 		dbName := os.Getenv("MONGO_DB_NAME")
 		mongoURL := os.Getenv("MONGO_URL")
 		redisURL := os.Getenv("REDIS_URL")
 		mongoManager := mongoimpl.NewMongoManager(mongoURL, dbName)
 		redisClient := redis.NewClient(&redis.Options{Addr: redisURL})
-		manager = redisimpl.NewRedisManager(redisClient, mongoManager)
+		redisManager := redisimpl.NewRedisManager(redisClient, mongoManager)
+		localCache := localcacheimpl.NewLocalCacheManager(redisManager, localCacheCapacity, redisimpl.LocalCacheTTL)
+		go redisManager.Invalidations().Listen(context.Background(), localCache)
+		manager = localCache
 	}
 
 	srv := httpapi.NewServer(manager)
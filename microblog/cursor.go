@@ -0,0 +1,136 @@
+package microblog
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// Page tokens are opaque to the clients. A token holds the format version, the kind of the listing,
+// the time it was issued at and the position in the listing, followed by a truncated HMAC-SHA256
+// of all of it, and is encoded with unpadded base64url, so it matches the PageToken pattern of the API.
+const (
+	pageTokenVersion = 1
+	// pageTokenTTL is how long a token stays valid after it was issued.
+	pageTokenTTL = 24 * time.Hour
+	// pageTokenMACSize is the number of bytes of the HMAC kept in a token.
+	pageTokenMACSize = 16
+	// pageTokenHeaderSize is the size of the version, kind and issue time.
+	pageTokenHeaderSize = 1 + 1 + 8
+)
+
+// cursorKind tells apart the tokens of differently ordered listings, so that a token of one cannot be passed to another.
+type cursorKind byte
+
+const (
+	postCursor   cursorKind = 'p'
+	searchCursor cursorKind = 's'
+	userCursor   cursorKind = 'u'
+)
+
+var (
+	pageTokenKey = randomKey()
+	// now is replaced in tests to check the expiration of tokens.
+	now = time.Now
+)
+
+func randomKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// SetPageTokenKey sets the secret the page tokens are signed with. It must be called before the tokens are
+// issued, and all the instances of the service must share the key. Without it, a random key is used,
+// so the tokens are not valid after a restart.
+func SetPageTokenKey(key []byte) {
+	pageTokenKey = key
+}
+
+// EncodePostCursor builds a page token pointing right after the post with the given creation time and ID
+// in a listing ordered by creation time and ID.
+func EncodePostCursor(createdAt time.Time, postId string) string {
+	payload := binary.BigEndian.AppendUint64(nil, uint64(createdAt.UnixNano()))
+	return encodeCursor(postCursor, append(payload, postId...))
+}
+
+// DecodePostCursor parses a token built by EncodePostCursor.
+// ErrInvalidToken is returned for malformed, tampered or expired tokens.
+func DecodePostCursor(token string) (time.Time, string, error) {
+	payload, err := decodeCursor(postCursor, token)
+	if err != nil || len(payload) < 8 {
+		return time.Time{}, "", ErrInvalidToken
+	}
+	createdAt := time.Unix(0, int64(binary.BigEndian.Uint64(payload))).UTC()
+	return createdAt, string(payload[8:]), nil
+}
+
+// EncodeSearchCursor builds a page token pointing right after the search result with the given rank and post ID.
+func EncodeSearchCursor(score float64, postId string) string {
+	payload := binary.BigEndian.AppendUint64(nil, math.Float64bits(score))
+	return encodeCursor(searchCursor, append(payload, postId...))
+}
+
+// DecodeSearchCursor parses a token built by EncodeSearchCursor.
+// ErrInvalidToken is returned for malformed, tampered or expired tokens.
+func DecodeSearchCursor(token string) (float64, string, error) {
+	payload, err := decodeCursor(searchCursor, token)
+	if err != nil || len(payload) < 8 {
+		return 0, "", ErrInvalidToken
+	}
+	return math.Float64frombits(binary.BigEndian.Uint64(payload)), string(payload[8:]), nil
+}
+
+// EncodeUserCursor builds a page token pointing right after the user in a listing ordered by user ID.
+func EncodeUserCursor(userId string) string {
+	return encodeCursor(userCursor, []byte(userId))
+}
+
+// DecodeUserCursor parses a token built by EncodeUserCursor.
+// ErrInvalidToken is returned for malformed, tampered or expired tokens.
+func DecodeUserCursor(token string) (string, error) {
+	payload, err := decodeCursor(userCursor, token)
+	if err != nil {
+		return "", err
+	}
+	return string(payload), nil
+}
+
+func encodeCursor(kind cursorKind, payload []byte) string {
+	data := []byte{pageTokenVersion, byte(kind)}
+	data = binary.BigEndian.AppendUint64(data, uint64(now().Unix()))
+	data = append(data, payload...)
+	data = append(data, pageTokenMAC(data)...)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(kind cursorKind, token string) ([]byte, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(data) < pageTokenHeaderSize+pageTokenMACSize {
+		return nil, ErrInvalidToken
+	}
+	signed, mac := data[:len(data)-pageTokenMACSize], data[len(data)-pageTokenMACSize:]
+	if !hmac.Equal(mac, pageTokenMAC(signed)) {
+		return nil, ErrInvalidToken
+	}
+	if signed[0] != pageTokenVersion || cursorKind(signed[1]) != kind {
+		return nil, ErrInvalidToken
+	}
+	issuedAt := time.Unix(int64(binary.BigEndian.Uint64(signed[2:pageTokenHeaderSize])), 0)
+	if now().Sub(issuedAt) > pageTokenTTL {
+		return nil, ErrInvalidToken
+	}
+	return signed[pageTokenHeaderSize:], nil
+}
+
+func pageTokenMAC(data []byte) []byte {
+	mac := hmac.New(sha256.New, pageTokenKey)
+	mac.Write(data)
+	return mac.Sum(nil)[:pageTokenMACSize]
+}
@@ -0,0 +1,90 @@
+package microblog
+
+import (
+	"encoding/base64"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var pageTokenPattern = regexp.MustCompile(`^[A-Za-z0-9_\-]+$`)
+
+func TestPostCursor(t *testing.T) {
+	createdAt := time.Date(2024, 1, 31, 10, 0, 0, 123456789, time.UTC)
+	token := EncodePostCursor(createdAt, "abc:def")
+	require.Regexp(t, pageTokenPattern, token)
+
+	decodedTime, postId, err := DecodePostCursor(token)
+	require.NoError(t, err)
+	require.Equal(t, createdAt, decodedTime)
+	require.Equal(t, "abc:def", postId)
+}
+
+func TestSearchCursor(t *testing.T) {
+	score, postId, err := DecodeSearchCursor(EncodeSearchCursor(0.1+0.2, "abc"))
+	require.NoError(t, err)
+	require.Equal(t, 0.1+0.2, score)
+	require.Equal(t, "abc", postId)
+}
+
+func TestUserCursor(t *testing.T) {
+	userId, err := DecodeUserCursor(EncodeUserCursor("1a2b"))
+	require.NoError(t, err)
+	require.Equal(t, "1a2b", userId)
+}
+
+func TestInvalidCursor(t *testing.T) {
+	token := EncodePostCursor(time.Now(), "abc")
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	require.NoError(t, err)
+	tampered := func(i int) string {
+		changed := []byte(string(data))
+		changed[i] ^= 1
+		return base64.RawURLEncoding.EncodeToString(changed)
+	}
+
+	for name, token := range map[string]string{
+		"empty":            "",
+		"not base64":       "not a token!",
+		"truncated":        token[:len(token)-2],
+		"tampered version": tampered(0),
+		"tampered time":    tampered(pageTokenHeaderSize),
+		"tampered post ID": tampered(len(data) - pageTokenMACSize - 1),
+		"tampered MAC":     tampered(len(data) - 1),
+		"legacy":           base64.RawURLEncoding.EncodeToString([]byte("1706695200000000:abc")),
+	} {
+		_, _, err := DecodePostCursor(token)
+		require.ErrorIs(t, err, ErrInvalidToken, name)
+	}
+
+	// a token of another listing
+	_, _, err = DecodePostCursor(EncodeSearchCursor(1, "abc"))
+	require.ErrorIs(t, err, ErrInvalidToken)
+	_, err = DecodeUserCursor(token)
+	require.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestCursorSignedWithAnotherKey(t *testing.T) {
+	token := EncodeUserCursor("1a2b")
+	key := pageTokenKey
+	t.Cleanup(func() { SetPageTokenKey(key) })
+
+	SetPageTokenKey([]byte("another key"))
+	_, err := DecodeUserCursor(token)
+	require.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestExpiredCursor(t *testing.T) {
+	token := EncodeUserCursor("1a2b")
+	t.Cleanup(func() { now = time.Now })
+
+	now = func() time.Time { return time.Now().Add(pageTokenTTL - time.Minute) }
+	_, err := DecodeUserCursor(token)
+	require.NoError(t, err)
+
+	now = func() time.Time { return time.Now().Add(pageTokenTTL + time.Minute) }
+	_, err = DecodeUserCursor(token)
+	require.ErrorIs(t, err, ErrInvalidToken)
+}
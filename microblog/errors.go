@@ -3,6 +3,9 @@ package microblog
 import "errors"
 
 var (
-	ErrStorage  = errors.New("storage_error")
-	ErrNotFound = errors.New("not_found")
+	ErrStorage          = errors.New("storage_error")
+	ErrNotFound         = errors.New("not_found")
+	ErrSelfSubscription = errors.New("self_subscription")
+	ErrInvalidToken     = errors.New("invalid_page_token")
+	ErrInvalidQuery     = errors.New("invalid_search_query")
 )
@@ -0,0 +1,144 @@
+// Package idgen generates the post IDs shared by all the backends.
+//
+// An ID is a Snowflake-style 63-bit number made of the milliseconds since the epoch, the ID of the node
+// that generated it and a sequence number within the millisecond, so IDs generated by one node are unique
+// and increasing, and IDs of different nodes are roughly ordered by time. IDs are formatted as 11 characters
+// of the URL-safe base64 alphabet reordered by ASCII code, so that formatted IDs sort like the numbers.
+package idgen
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	nodeBits     = 10
+	sequenceBits = 12
+	// MaxNode is the largest node ID.
+	MaxNode = 1<<nodeBits - 1
+	// maxSequence is the largest sequence number within a millisecond.
+	maxSequence = 1<<sequenceBits - 1
+	// Length is the length of a formatted ID.
+	Length = 11
+)
+
+// alphabet is the URL-safe base64 alphabet in the ASCII order.
+const alphabet = "-0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ_abcdefghijklmnopqrstuvwxyz"
+
+// epoch is the time of the zero timestamp. The 41 bits of the timestamp last for about 69 years after it.
+var epoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+var ErrInvalidID = errors.New("invalid_id")
+
+// Generator produces the IDs of one node. It is safe for concurrent use.
+type Generator struct {
+	mu   sync.Mutex
+	node int64
+	// lastMillis is the timestamp of the last generated ID.
+	lastMillis int64
+	sequence   int64
+	// now is replaced in tests to control the clock.
+	now func() time.Time
+}
+
+// NewGenerator creates a generator of the IDs of the given node, which must be unique among the running
+// instances of the service and not greater than MaxNode.
+func NewGenerator(node int) *Generator {
+	if node < 0 || node > MaxNode {
+		panic(fmt.Sprintf("node ID %d is out of range [0, %d]", node, MaxNode))
+	}
+	return &Generator{node: int64(node), now: time.Now}
+}
+
+// Next returns a new ID. If the clock goes backwards, or the sequence of the current millisecond
+// is exhausted, the timestamp of the last ID is carried on, so the IDs keep increasing.
+func (g *Generator) Next() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	millis := g.now().Sub(epoch).Milliseconds()
+	if millis > g.lastMillis {
+		g.lastMillis = millis
+		g.sequence = 0
+	} else if g.sequence < maxSequence {
+		g.sequence++
+	} else {
+		g.lastMillis++
+		g.sequence = 0
+	}
+	return g.lastMillis<<(nodeBits+sequenceBits) | g.node<<sequenceBits | g.sequence
+}
+
+// NewID returns a new formatted ID.
+func (g *Generator) NewID() string {
+	return Format(g.Next())
+}
+
+var defaultGenerator = NewGenerator(0)
+
+// SetNode sets the node ID of the default generator. It must be called before any ID is generated.
+func SetNode(node int) {
+	defaultGenerator = NewGenerator(node)
+}
+
+// Next returns a new ID of the default generator.
+func Next() int64 {
+	return defaultGenerator.Next()
+}
+
+// NewID returns a new formatted ID of the default generator.
+func NewID() string {
+	return defaultGenerator.NewID()
+}
+
+// Format encodes a non-negative ID as a string of Length characters.
+func Format(id int64) string {
+	var buf [Length]byte
+	for i := Length - 1; i >= 0; i-- {
+		buf[i] = alphabet[id&63]
+		id >>= 6
+	}
+	return string(buf[:])
+}
+
+// Parse decodes an ID encoded by Format. ErrInvalidID is returned for any other string.
+func Parse(s string) (int64, error) {
+	if len(s) != Length {
+		return 0, ErrInvalidID
+	}
+	var id uint64
+	for i := range len(s) {
+		digit := decodeDigit(s[i])
+		if digit < 0 {
+			return 0, ErrInvalidID
+		}
+		id = id<<6 | uint64(digit)
+	}
+	// the first character holds only the 3 highest bits, the 64th one must be clear
+	if s[0] > alphabet[7] {
+		return 0, ErrInvalidID
+	}
+	return int64(id), nil
+}
+
+func decodeDigit(c byte) int {
+	switch {
+	case c == '-':
+		return 0
+	case '0' <= c && c <= '9':
+		return int(c-'0') + 1
+	case 'A' <= c && c <= 'Z':
+		return int(c-'A') + 11
+	case c == '_':
+		return 37
+	case 'a' <= c && c <= 'z':
+		return int(c-'a') + 38
+	}
+	return -1
+}
+
+// Time returns the time the ID was generated at, with millisecond precision.
+func Time(id int64) time.Time {
+	return epoch.Add(time.Duration(id>>(nodeBits+sequenceBits)) * time.Millisecond)
+}
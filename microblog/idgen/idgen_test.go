@@ -0,0 +1,130 @@
+package idgen
+
+import (
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var postIdPattern = regexp.MustCompile(`^[A-Za-z0-9_\-]+$`)
+
+// fixedClock makes the generator see the given time until it is changed.
+func fixedClock(g *Generator, t time.Time) *time.Time {
+	clock := &t
+	g.now = func() time.Time { return *clock }
+	return clock
+}
+
+func TestFormat(t *testing.T) {
+	for _, id := range []int64{0, 1, 63, 64, 1 << 40, math.MaxInt64} {
+		formatted := Format(id)
+		require.Len(t, formatted, Length)
+		require.Regexp(t, postIdPattern, formatted)
+		parsed, err := Parse(formatted)
+		require.NoError(t, err)
+		require.Equal(t, id, parsed)
+	}
+	require.Equal(t, "----------0", Format(1))
+}
+
+func TestFormattedIdsSortAsNumbers(t *testing.T) {
+	ids := []int64{0, 1, 36, 37, 38, 63, 64, 1 << 20, 1<<20 + 37, 1 << 62, math.MaxInt64}
+	formatted := make([]string, len(ids))
+	for i, id := range ids {
+		formatted[i] = Format(id)
+	}
+	require.True(t, sort.StringsAreSorted(formatted), formatted)
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, s := range []string{"", "abc", "----------0-", "---------+0", "----------=", "zzzzzzzzzzz", "7----------"} {
+		_, err := Parse(s)
+		require.ErrorIs(t, err, ErrInvalidID, s)
+	}
+}
+
+func TestNext(t *testing.T) {
+	g := NewGenerator(5)
+	at := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	clock := fixedClock(g, at)
+
+	first, second := g.Next(), g.Next()
+	require.Equal(t, first+1, second)
+	require.Equal(t, at, Time(first))
+	require.Equal(t, int64(5), first>>sequenceBits&MaxNode)
+
+	*clock = at.Add(time.Millisecond)
+	third := g.Next()
+	require.Equal(t, at.Add(time.Millisecond), Time(third))
+	require.Zero(t, third&maxSequence)
+}
+
+func TestClockGoesBackwards(t *testing.T) {
+	g := NewGenerator(0)
+	at := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	clock := fixedClock(g, at)
+	first := g.Next()
+
+	*clock = at.Add(-time.Second)
+	second := g.Next()
+	require.Greater(t, second, first)
+	require.Equal(t, at, Time(second))
+}
+
+func TestSequenceOverflow(t *testing.T) {
+	g := NewGenerator(0)
+	at := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	fixedClock(g, at)
+	ids := make([]int64, maxSequence+2)
+	for i := range ids {
+		ids[i] = g.Next()
+	}
+	require.True(t, slices.IsSorted(ids))
+	require.Equal(t, at, Time(ids[maxSequence]))
+	require.Equal(t, at.Add(time.Millisecond), Time(ids[maxSequence+1]))
+}
+
+func TestNodesDoNotCollide(t *testing.T) {
+	at := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	a, b := NewGenerator(1), NewGenerator(2)
+	fixedClock(a, at)
+	fixedClock(b, at)
+	require.NotEqual(t, a.Next(), b.Next())
+}
+
+func TestNextConcurrently(t *testing.T) {
+	const goroutines, idsPerGoroutine = 8, 1000
+	g := NewGenerator(MaxNode)
+	var mu sync.Mutex
+	var ids []string
+	var wg sync.WaitGroup
+	for range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			generated := make([]string, idsPerGoroutine)
+			for i := range generated {
+				generated[i] = g.NewID()
+			}
+			// the IDs of a single caller are increasing
+			require.True(t, slices.IsSorted(generated))
+			mu.Lock()
+			ids = append(ids, generated...)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	slices.Sort(ids)
+	require.Len(t, slices.Compact(ids), goroutines*idsPerGoroutine)
+}
+
+func TestNodeOutOfRange(t *testing.T) {
+	require.Panics(t, func() { NewGenerator(-1) })
+	require.Panics(t, func() { NewGenerator(MaxNode + 1) })
+}
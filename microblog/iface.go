@@ -5,18 +5,97 @@ import (
 	"time"
 )
 
+// PostKind tells original posts apart from the ones sharing another post.
+type PostKind string
+
+const (
+	// RegularPost is a post with its own content, possibly a reply.
+	RegularPost PostKind = ""
+	// Repost shares another post without adding any text.
+	Repost PostKind = "repost"
+	// QuotePost shares another post along with the text of the reposter.
+	QuotePost PostKind = "quote"
+)
+
 type UserPost struct {
-	PostId         string    `bson:"-"`
+	PostId         string    `bson:"_id"`
 	Text           string    `bson:"text"`
 	AuthorId       string    `bson:"author_id"`
 	CreatedAt      time.Time `bson:"created_at"`
 	LastModifiedAt time.Time `bson:"last_modified_at"`
+	LikesCount     int64     `bson:"likes_count"`
+	// InReplyTo is the ID of the post this one replies to, empty for top-level posts.
+	InReplyTo string `bson:"in_reply_to,omitempty"`
+	// RootId is the ID of the top-level post of the conversation, empty for top-level posts.
+	RootId string   `bson:"root_id,omitempty"`
+	Kind   PostKind `bson:"kind,omitempty"`
+	// RepostOf is the ID of the shared post for reposts and quote posts.
+	RepostOf     string `bson:"repost_of,omitempty"`
+	RepostsCount int64  `bson:"reposts_count"`
+	// Tags are the normalized hashtags found in the text.
+	Tags []string `bson:"tags,omitempty"`
+	// Mentions are the IDs of the users mentioned in the text.
+	Mentions []string `bson:"mentions,omitempty"`
+}
+
+// ThreadRootId returns the ID of the top-level post of the conversation the post belongs to.
+func (p UserPost) ThreadRootId() string {
+	if p.RootId != "" {
+		return p.RootId
+	}
+	return p.PostId
+}
+
+// PostRevision is a version of the post text that was replaced by a modification.
+type PostRevision struct {
+	PostId   string    `bson:"post_id"`
+	Text     string    `bson:"text"`
+	EditorId string    `bson:"editor_id"`
+	EditedAt time.Time `bson:"edited_at"`
 }
 
 type Manager interface {
 	AddPost(ctx context.Context, userId string, post string) (UserPost, error)
+	// AddReply publishes a post replying to the post inReplyTo.
+	// ErrNotFound is returned if there is no post to reply to.
+	AddReply(ctx context.Context, userId string, inReplyTo string, post string) (UserPost, error)
+	// DeletePost removes the post. ErrNotFound is returned if there is no such post.
+	DeletePost(ctx context.Context, postID string) error
+	// GetFeedInPage returns a page of posts written by the users userId follows, newest first.
+	GetFeedInPage(ctx context.Context, userId string, token string, size uint8) ([]UserPost, string, error)
+	GetFollowees(ctx context.Context, userId string, token string, size uint8) ([]string, string, error)
+	GetFollowers(ctx context.Context, userId string, token string, size uint8) ([]string, string, error)
+	// GetMentionsInPage returns a page of posts mentioning userId, newest first.
+	GetMentionsInPage(ctx context.Context, userId string, token string, size uint8) ([]UserPost, string, error)
 	GetPost(ctx context.Context, postID string) (UserPost, error)
+	// GetPostRevisions returns the previous versions of the post, most recent first.
+	// ErrNotFound is returned if there is no such post.
+	GetPostRevisions(ctx context.Context, postID string) ([]PostRevision, error)
 	GetPostsInPage(ctx context.Context, userId string, token string, size uint8) ([]UserPost, string, error)
+	// GetRepliesInPage returns a page of direct replies to the post, newest first.
+	// ErrNotFound is returned if there is no such post.
+	GetRepliesInPage(ctx context.Context, postID string, token string, size uint8) ([]UserPost, string, error)
+	// GetTagPostsInPage returns a page of posts with the hashtag, newest first.
+	GetTagPostsInPage(ctx context.Context, tag string, token string, size uint8) ([]UserPost, string, error)
+	// GetThread returns the chain of posts the post replies to, starting from the top-level post
+	// and ending with the post itself. The chain is cut at the first ancestor that was deleted.
+	// ErrNotFound is returned if there is no such post.
+	GetThread(ctx context.Context, postID string) ([]UserPost, error)
 	IsReady(ctx context.Context) bool
-	ModifyPost(ctx context.Context, postID string, post string) (UserPost, error)
+	// LikePost records that userId likes the post. Liking a post twice is a no-op.
+	LikePost(ctx context.Context, postID string, userId string) (UserPost, error)
+	// ModifyPost replaces the text of the post, keeping the previous text as a revision made by editorId.
+	ModifyPost(ctx context.Context, postID string, editorId string, post string) (UserPost, error)
+	// Repost shares the post on behalf of userId, as a quote post if quote is not empty.
+	// Sharing a repost shares the original post. Repeated reposts without a quote return
+	// the existing repost. ErrNotFound is returned if there is no post to share.
+	Repost(ctx context.Context, userId string, postID string, quote string) (UserPost, error)
+	// SearchPosts returns a page of posts matching the query, best matches first.
+	SearchPosts(ctx context.Context, query SearchQuery, token string, size uint8) ([]UserPost, string, error)
+	// Subscribe makes userId a follower of targetId. Subscribing twice is a no-op.
+	Subscribe(ctx context.Context, userId string, targetId string) error
+	// UnlikePost withdraws the like of userId. Unliking a post that is not liked is a no-op.
+	UnlikePost(ctx context.Context, postID string, userId string) (UserPost, error)
+	// Unsubscribe removes userId from the followers of targetId. Unsubscribing twice is a no-op.
+	Unsubscribe(ctx context.Context, userId string, targetId string) error
 }
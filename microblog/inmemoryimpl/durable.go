@@ -0,0 +1,331 @@
+package inmemoryimpl
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"micro-blog/microblog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	logFileName      = "wal.jsonl"
+	snapshotFileName = "snapshot.json"
+)
+
+type operation string
+
+const (
+	opAddPost     operation = "add_post"
+	opModifyPost  operation = "modify_post"
+	opDeletePost  operation = "delete_post"
+	opLikePost    operation = "like_post"
+	opUnlikePost  operation = "unlike_post"
+	opSubscribe   operation = "subscribe"
+	opUnsubscribe operation = "unsubscribe"
+)
+
+// logRecord is a single mutation of the manager state. Records hold the outcome of the
+// mutation, e.g. the generated post ID and timestamps, so that replaying them is deterministic.
+type logRecord struct {
+	Seq uint64    `json:"seq"`
+	Op  operation `json:"op"`
+	// Post is the stored post of an add_post record, which also covers replies and reposts.
+	Post     *microblog.UserPost `json:"post,omitempty"`
+	PostId   string              `json:"postId,omitempty"`
+	UserId   string              `json:"userId,omitempty"`
+	TargetId string              `json:"targetId,omitempty"`
+	Text     string              `json:"text,omitempty"`
+	Time     time.Time           `json:"time,omitzero"`
+}
+
+// snapshot is the whole state of the manager as of the record with sequence number Seq.
+// The indexes are not saved, they are rebuilt from the posts on load.
+type snapshot struct {
+	Seq       uint64                              `json:"seq"`
+	Posts     []microblog.UserPost                `json:"posts"`
+	Revisions map[string][]microblog.PostRevision `json:"revisions"`
+	Likes     map[string][]string                 `json:"likes"`
+	Followees map[string][]string                 `json:"followees"`
+}
+
+// writeAheadLog is the append-only log of the records applied since the last snapshot.
+type writeAheadLog struct {
+	dir  string
+	file *os.File
+	// seq is the sequence number of the last written record.
+	seq uint64
+	// size is the number of records in the log file.
+	size int
+	// compactAfter is the number of records after which a snapshot is taken and the log is truncated.
+	compactAfter int
+}
+
+// NewDurableInMemoryManager creates a manager persisting its state in dir, which is created if needed.
+// Every mutation is appended to a write-ahead log and synced before it is applied. Once the log
+// holds compactAfter records, the state is saved to a snapshot and the log is truncated.
+// The state is restored from the snapshot and the log on creation.
+func NewDurableInMemoryManager(dir string, compactAfter int) *InMemoryManager {
+	if compactAfter <= 0 {
+		panic("number of log records between snapshots must be positive")
+	}
+	manager := NewInMemoryManager()
+	if err := manager.open(dir, compactAfter); err != nil {
+		panic(err)
+	}
+	return manager
+}
+
+func (manager *InMemoryManager) open(dir string, compactAfter int) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	seq, err := manager.loadSnapshot(filepath.Join(dir, snapshotFileName))
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filepath.Join(dir, logFileName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	wal := &writeAheadLog{dir: dir, file: file, seq: seq, compactAfter: compactAfter}
+	if err := manager.replay(wal); err != nil {
+		file.Close()
+		return err
+	}
+	manager.wal = wal
+	return nil
+}
+
+// Close takes a snapshot and closes the log. It is a no-op for a manager without persistence.
+func (manager *InMemoryManager) Close() error {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	if manager.wal == nil {
+		return nil
+	}
+	err := manager.compact()
+	err = errors.Join(err, manager.wal.file.Close())
+	manager.wal = nil
+	return err
+}
+
+// commit writes the record to the log, if the manager is durable, and applies it.
+// The caller must hold the write lock and make sure the record is valid for the current state.
+func (manager *InMemoryManager) commit(record logRecord) error {
+	wal := manager.wal
+	if wal == nil {
+		manager.apply(record)
+		return nil
+	}
+	record.Seq = wal.seq + 1
+	if err := wal.append(record); err != nil {
+		return fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
+	}
+	manager.apply(record)
+	if wal.size >= wal.compactAfter {
+		// the record is already durable, so a failed compaction is retried after the next one
+		_ = manager.compact()
+	}
+	return nil
+}
+
+func (manager *InMemoryManager) apply(record logRecord) {
+	switch record.Op {
+	case opAddPost:
+		manager.applyAddPost(*record.Post)
+	case opModifyPost:
+		manager.applyModifyPost(record.PostId, record.UserId, record.Text, record.Time)
+	case opDeletePost:
+		manager.applyDeletePost(record.PostId)
+	case opLikePost:
+		manager.applyLikePost(record.PostId, record.UserId)
+	case opUnlikePost:
+		manager.applyUnlikePost(record.PostId, record.UserId)
+	case opSubscribe:
+		manager.applySubscribe(record.UserId, record.TargetId)
+	case opUnsubscribe:
+		manager.applyUnsubscribe(record.UserId, record.TargetId)
+	}
+}
+
+func (wal *writeAheadLog) append(record logRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := wal.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := wal.file.Sync(); err != nil {
+		return err
+	}
+	wal.seq = record.Seq
+	wal.size++
+	return nil
+}
+
+// replay applies the records of the log written after the snapshot. A torn record at the end
+// of the log, left by a crash in the middle of a write, is discarded.
+func (manager *InMemoryManager) replay(wal *writeAheadLog) error {
+	reader := bufio.NewReader(wal.file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		var record logRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			break
+		}
+		offset += int64(len(line))
+		wal.size++
+		// records up to the snapshot are left over from an interrupted compaction
+		if record.Seq <= wal.seq {
+			continue
+		}
+		manager.apply(record)
+		wal.seq = record.Seq
+	}
+	if err := wal.file.Truncate(offset); err != nil {
+		return err
+	}
+	_, err := wal.file.Seek(offset, io.SeekStart)
+	return err
+}
+
+// compact saves the state to a snapshot and truncates the log. The caller must hold the write lock.
+func (manager *InMemoryManager) compact() error {
+	wal := manager.wal
+	if err := writeFileAtomically(filepath.Join(wal.dir, snapshotFileName), manager.snapshot(wal.seq)); err != nil {
+		return err
+	}
+	if err := wal.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := wal.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	wal.size = 0
+	return nil
+}
+
+// snapshot captures the state of the manager. The caller must hold the lock.
+func (manager *InMemoryManager) snapshot(seq uint64) snapshot {
+	snap := snapshot{
+		Seq:       seq,
+		Posts:     make([]microblog.UserPost, 0, len(manager.allPosts)),
+		Revisions: manager.revisions,
+		Likes:     make(map[string][]string, len(manager.likes)),
+		Followees: make(map[string][]string, len(manager.followees)),
+	}
+	for _, post := range manager.allPosts {
+		snap.Posts = append(snap.Posts, post)
+	}
+	// parents go before their replies and originals before their reposts
+	slices.SortFunc(snap.Posts, func(a, b microblog.UserPost) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.PostId, b.PostId)
+	})
+	for postId, users := range manager.likes {
+		if len(users) > 0 {
+			snap.Likes[postId] = setToSlice(users)
+		}
+	}
+	for userId, followees := range manager.followees {
+		if len(followees) > 0 {
+			snap.Followees[userId] = setToSlice(followees)
+		}
+	}
+	return snap
+}
+
+// loadSnapshot restores the state from the snapshot file, if any, and returns its sequence number.
+func (manager *InMemoryManager) loadSnapshot(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return 0, err
+	}
+	for _, post := range snap.Posts {
+		manager.storePost(post)
+	}
+	for postId, revisions := range snap.Revisions {
+		manager.revisions[postId] = revisions
+	}
+	for postId, users := range snap.Likes {
+		manager.likes[postId] = sliceToSet(users)
+	}
+	for userId, followees := range snap.Followees {
+		for _, targetId := range followees {
+			manager.applySubscribe(userId, targetId)
+		}
+	}
+	return snap.Seq, nil
+}
+
+// writeFileAtomically replaces the file with the JSON encoding of v, so that a crash
+// leaves either the old or the new version of the file.
+func writeFileAtomically(path string, v any) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := json.NewEncoder(tmp).Encode(v); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+func setToSlice(set UserSet) []string {
+	users := make([]string, 0, len(set))
+	for user := range set {
+		users = append(users, user)
+	}
+	slices.Sort(users)
+	return users
+}
+
+func sliceToSet(users []string) UserSet {
+	set := make(UserSet, len(users))
+	for _, user := range users {
+		set[user] = struct{}{}
+	}
+	return set
+}
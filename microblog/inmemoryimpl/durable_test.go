@@ -0,0 +1,207 @@
+package inmemoryimpl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+var ctx = context.Background()
+
+func TestDurableManager(t *testing.T) {
+	suite.Run(t, new(DurableSuite))
+}
+
+type DurableSuite struct {
+	suite.Suite
+
+	dir     string
+	manager *InMemoryManager
+}
+
+func (s *DurableSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+	s.manager = NewDurableInMemoryManager(s.dir, 1000)
+}
+
+func (s *DurableSuite) TearDownTest() {
+	s.Require().NoError(s.manager.Close())
+}
+
+// crash drops the manager without taking a snapshot.
+func (s *DurableSuite) crash() {
+	s.Require().NoError(s.manager.wal.file.Close())
+	s.manager.wal = nil
+}
+
+func (s *DurableSuite) reopen(compactAfter int) *InMemoryManager {
+	restored := NewDurableInMemoryManager(s.dir, compactAfter)
+	s.manager = restored
+	return restored
+}
+
+// populate runs every kind of mutation.
+func (s *DurableSuite) populate() {
+	post, err := s.manager.AddPost(ctx, "a1", "hello #go @b2")
+	s.Require().NoError(err)
+	reply, err := s.manager.AddReply(ctx, "b2", post.PostId, "hi there")
+	s.Require().NoError(err)
+	_, err = s.manager.AddReply(ctx, "a1", reply.PostId, "how are you")
+	s.Require().NoError(err)
+	_, err = s.manager.ModifyPost(ctx, post.PostId, "a1", "hello #golang @c3")
+	s.Require().NoError(err)
+	_, err = s.manager.Repost(ctx, "b2", post.PostId, "")
+	s.Require().NoError(err)
+	_, err = s.manager.Repost(ctx, "c3", post.PostId, "look")
+	s.Require().NoError(err)
+	_, err = s.manager.LikePost(ctx, post.PostId, "b2")
+	s.Require().NoError(err)
+	_, err = s.manager.LikePost(ctx, post.PostId, "c3")
+	s.Require().NoError(err)
+	_, err = s.manager.UnlikePost(ctx, post.PostId, "c3")
+	s.Require().NoError(err)
+	s.Require().NoError(s.manager.Subscribe(ctx, "b2", "a1"))
+	s.Require().NoError(s.manager.Subscribe(ctx, "c3", "a1"))
+	s.Require().NoError(s.manager.Unsubscribe(ctx, "c3", "a1"))
+	s.Require().NoError(s.manager.DeletePost(ctx, reply.PostId))
+}
+
+// requireSameState checks that the managers hold the same data. The order of the indexed
+// post IDs is ignored, since the pages are sorted anyway.
+func (s *DurableSuite) requireSameState(expected, actual *InMemoryManager) {
+	s.Require().Equal(expected.allPosts, actual.allPosts)
+	s.Require().Equal(expected.revisions, actual.revisions)
+	s.Require().Equal(nonEmptySets(expected.likes), nonEmptySets(actual.likes))
+	s.Require().Equal(nonEmptySets(expected.followers), nonEmptySets(actual.followers))
+	s.Require().Equal(nonEmptySets(expected.followees), nonEmptySets(actual.followees))
+	s.Require().Equal(expected.reposts, actual.reposts)
+	for _, indexes := range [][2]map[string]PostIdsList{
+		{expected.userPosts, actual.userPosts},
+		{expected.replies, actual.replies},
+		{expected.tagPosts, actual.tagPosts},
+		{expected.mentionPosts, actual.mentionPosts},
+		{expected.wordPosts, actual.wordPosts},
+	} {
+		s.Require().Equal(sortedIndex(indexes[0]), sortedIndex(indexes[1]))
+	}
+}
+
+func nonEmptySets(sets map[string]UserSet) map[string]UserSet {
+	result := make(map[string]UserSet)
+	for key, set := range sets {
+		if len(set) > 0 {
+			result[key] = set
+		}
+	}
+	return result
+}
+
+func sortedIndex(index map[string]PostIdsList) map[string]PostIdsList {
+	result := make(map[string]PostIdsList)
+	for key, postIds := range index {
+		if len(postIds) > 0 {
+			result[key] = slices.Sorted(slices.Values(postIds))
+		}
+	}
+	return result
+}
+
+func (s *DurableSuite) logLines() int {
+	data, err := os.ReadFile(filepath.Join(s.dir, logFileName))
+	s.Require().NoError(err)
+	return bytes.Count(data, []byte("\n"))
+}
+
+func (s *DurableSuite) TestReplayLog() {
+	s.populate()
+	original := s.manager
+	s.crash()
+	s.Require().NoFileExists(filepath.Join(s.dir, snapshotFileName))
+
+	s.requireSameState(original, s.reopen(1000))
+}
+
+func (s *DurableSuite) TestCloseTakesSnapshot() {
+	s.populate()
+	original := s.manager
+	s.Require().NoError(s.manager.Close())
+	s.Require().FileExists(filepath.Join(s.dir, snapshotFileName))
+	s.Require().Zero(s.logLines())
+
+	s.requireSameState(original, s.reopen(1000))
+}
+
+func (s *DurableSuite) TestCompaction() {
+	s.crash()
+	s.reopen(4)
+	for i := range 10 {
+		_, err := s.manager.AddPost(ctx, "a1", fmt.Sprintf("post %d", i))
+		s.Require().NoError(err)
+	}
+	s.Require().FileExists(filepath.Join(s.dir, snapshotFileName))
+	s.Require().Equal(2, s.logLines())
+
+	original := s.manager
+	s.crash()
+	restored := s.reopen(4)
+	s.requireSameState(original, restored)
+	posts, _, err := restored.GetPostsInPage(ctx, "a1", "", 20)
+	s.Require().NoError(err)
+	s.Require().Len(posts, 10)
+}
+
+func (s *DurableSuite) TestRejectsNonPositiveCompaction() {
+	s.Require().Panics(func() { NewDurableInMemoryManager(s.T().TempDir(), 0) })
+	s.Require().Panics(func() { NewDurableInMemoryManager(s.T().TempDir(), -1) })
+}
+
+func (s *DurableSuite) TestInterruptedCompaction() {
+	s.populate()
+	log, err := os.ReadFile(filepath.Join(s.dir, logFileName))
+	s.Require().NoError(err)
+	original := s.manager
+	// the snapshot is saved, but the log is not truncated
+	s.Require().NoError(s.manager.Close())
+	s.Require().NoError(os.WriteFile(filepath.Join(s.dir, logFileName), log, 0o644))
+
+	s.requireSameState(original, s.reopen(1000))
+}
+
+func (s *DurableSuite) TestTornRecord() {
+	post, err := s.manager.AddPost(ctx, "a1", "first")
+	s.Require().NoError(err)
+	s.crash()
+	file, err := os.OpenFile(filepath.Join(s.dir, logFileName), os.O_APPEND|os.O_WRONLY, 0o644)
+	s.Require().NoError(err)
+	_, err = file.WriteString(`{"seq":2,"op":"add_po`)
+	s.Require().NoError(err)
+	s.Require().NoError(file.Close())
+
+	s.reopen(1000)
+	s.Require().Equal(1, s.logLines())
+	_, err = s.manager.ModifyPost(ctx, post.PostId, "a1", "second")
+	s.Require().NoError(err)
+	s.crash()
+
+	restored := s.reopen(1000)
+	got, err := restored.GetPost(ctx, post.PostId)
+	s.Require().NoError(err)
+	s.Require().Equal("second", got.Text)
+}
+
+func (s *DurableSuite) TestNoOpsAreNotLogged() {
+	post, err := s.manager.AddPost(ctx, "a1", "first")
+	s.Require().NoError(err)
+	_, err = s.manager.UnlikePost(ctx, post.PostId, "b2")
+	s.Require().NoError(err)
+	s.Require().NoError(s.manager.Unsubscribe(ctx, "b2", "a1"))
+	_, err = s.manager.LikePost(ctx, "missing", "b2")
+	s.Require().Error(err)
+	s.Require().Equal(1, s.logLines())
+}
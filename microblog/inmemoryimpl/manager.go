@@ -2,58 +2,162 @@ package inmemoryimpl
 
 import (
 	"context"
-	"encoding/base64"
-	"errors"
-	"fmt"
-	"math/rand"
+	"math"
 	"micro-blog/microblog"
+	"micro-blog/microblog/idgen"
+	"slices"
 	"sort"
-	"strconv"
 	"sync"
 	"time"
 )
 
 type PostIdsList []string
 
+// UserSet holds user IDs of one side of the subscription graph.
+type UserSet map[string]struct{}
+
 type InMemoryManager struct {
 	mu        sync.RWMutex
 	userPosts map[string]PostIdsList
 	allPosts  map[string]microblog.UserPost
+	followers map[string]UserSet
+	followees map[string]UserSet
+	revisions map[string][]microblog.PostRevision
+	likes     map[string]UserSet
+	replies   map[string]PostIdsList
+	// reposts maps the original post ID to the IDs of its reposts without a quote by reposter ID.
+	reposts map[string]map[string]string
+	// tagPosts is the inverted index of the posts by normalized hashtag.
+	tagPosts map[string]PostIdsList
+	// mentionPosts is the inverted index of the posts by mentioned user ID.
+	mentionPosts map[string]PostIdsList
+	// wordPosts is the inverted index of the posts by the words of their text.
+	wordPosts map[string]PostIdsList
+	// wal is the write-ahead log of a durable manager, nil if the state is not persisted.
+	wal *writeAheadLog
 }
 
 func NewInMemoryManager() *InMemoryManager {
 	return &InMemoryManager{
-		userPosts: make(map[string]PostIdsList),
-		allPosts:  make(map[string]microblog.UserPost),
+		userPosts:    make(map[string]PostIdsList),
+		allPosts:     make(map[string]microblog.UserPost),
+		followers:    make(map[string]UserSet),
+		followees:    make(map[string]UserSet),
+		revisions:    make(map[string][]microblog.PostRevision),
+		likes:        make(map[string]UserSet),
+		replies:      make(map[string]PostIdsList),
+		reposts:      make(map[string]map[string]string),
+		tagPosts:     make(map[string]PostIdsList),
+		mentionPosts: make(map[string]PostIdsList),
+		wordPosts:    make(map[string]PostIdsList),
 	}
 }
 
-func createPostID(createTime int) string {
-	randomPart := rand.Intn(1_000_000)
-	raw := strconv.FormatInt(int64(createTime), 10) + ":" + strconv.Itoa(randomPart)
-	postID := base64.RawURLEncoding.EncodeToString([]byte(raw))
-	return postID
+func (manager *InMemoryManager) AddPost(_ context.Context, userId string, text string) (microblog.UserPost, error) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	return manager.addPost(microblog.UserPost{Text: text, AuthorId: userId})
 }
 
-func (manager *InMemoryManager) AddPost(_ context.Context, userId string, text string) (microblog.UserPost, error) {
+func (manager *InMemoryManager) AddReply(_ context.Context, userId string, inReplyTo string, text string) (microblog.UserPost, error) {
 	manager.mu.Lock()
 	defer manager.mu.Unlock()
+	parent, ok := manager.allPosts[inReplyTo]
+	if !ok {
+		return microblog.UserPost{}, microblog.ErrNotFound
+	}
+	return manager.addPost(microblog.UserPost{Text: text, AuthorId: userId, InReplyTo: inReplyTo, RootId: parent.ThreadRootId()})
+}
 
-	postsList, _ := manager.userPosts[userId]
+// addPost assigns an ID and the creation time to the post and commits it.
+// The caller must hold the write lock.
+func (manager *InMemoryManager) addPost(post microblog.UserPost) (microblog.UserPost, error) {
 	createTime := time.Now().UTC()
-	postId := createPostID(createTime.Second())
-	post := microblog.UserPost{PostId: postId, Text: text, AuthorId: userId, CreatedAt: createTime}
-	manager.userPosts[userId] = append(postsList, postId)
-	manager.allPosts[post.PostId] = post
+	post.PostId = idgen.NewID()
+	post.CreatedAt = createTime
+	post.Tags = microblog.ExtractHashtags(post.Text)
+	post.Mentions = microblog.ExtractMentions(post.Text)
+	if err := manager.commit(logRecord{Op: opAddPost, Post: &post}); err != nil {
+		return microblog.UserPost{}, err
+	}
 	return post, nil
 }
 
+// applyAddPost stores a new post and counts it as a repost of the original, if any.
+// The caller must hold the write lock.
+func (manager *InMemoryManager) applyAddPost(post microblog.UserPost) {
+	manager.storePost(post)
+	if original, ok := manager.allPosts[post.RepostOf]; ok {
+		original.RepostsCount++
+		manager.allPosts[original.PostId] = original
+	}
+}
+
+// storePost stores the post as is and adds it to the indexes. The caller must hold the write lock.
+func (manager *InMemoryManager) storePost(post microblog.UserPost) {
+	manager.userPosts[post.AuthorId] = append(manager.userPosts[post.AuthorId], post.PostId)
+	manager.allPosts[post.PostId] = post
+	manager.indexText(post)
+	if _, ok := manager.allPosts[post.InReplyTo]; ok {
+		manager.replies[post.InReplyTo] = append(manager.replies[post.InReplyTo], post.PostId)
+	}
+	if _, ok := manager.allPosts[post.RepostOf]; ok && post.Kind == microblog.Repost {
+		if manager.reposts[post.RepostOf] == nil {
+			manager.reposts[post.RepostOf] = make(map[string]string)
+		}
+		manager.reposts[post.RepostOf][post.AuthorId] = post.PostId
+	}
+}
+
+// indexText adds the post to the inverted indexes of hashtags, mentions and words. The caller must hold the write lock.
+func (manager *InMemoryManager) indexText(post microblog.UserPost) {
+	addToIndex(manager.tagPosts, post.Tags, post.PostId)
+	addToIndex(manager.mentionPosts, post.Mentions, post.PostId)
+	addToIndex(manager.wordPosts, distinctWords(post.Text), post.PostId)
+}
+
+// unindexText removes the post from the inverted indexes of hashtags, mentions and words. The caller must hold the write lock.
+func (manager *InMemoryManager) unindexText(post microblog.UserPost) {
+	removeFromIndex(manager.tagPosts, post.Tags, post.PostId)
+	removeFromIndex(manager.mentionPosts, post.Mentions, post.PostId)
+	removeFromIndex(manager.wordPosts, distinctWords(post.Text), post.PostId)
+}
+
+func distinctWords(text string) []string {
+	words := microblog.Tokenize(text)
+	slices.Sort(words)
+	return slices.Compact(words)
+}
+
+func addToIndex(index map[string]PostIdsList, keys []string, postId string) {
+	for _, key := range keys {
+		index[key] = append(index[key], postId)
+	}
+}
+
+func removeFromIndex(index map[string]PostIdsList, keys []string, postId string) {
+	for _, key := range keys {
+		index[key] = slices.DeleteFunc(index[key], func(id string) bool {
+			return id == postId
+		})
+		if len(index[key]) == 0 {
+			delete(index, key)
+		}
+	}
+}
+
+func (manager *InMemoryManager) GetMentionsInPage(_ context.Context, userId string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+	return manager.postsInPage(manager.mentionPosts[userId], token, size)
+}
+
 func (manager *InMemoryManager) GetPost(_ context.Context, postId string) (microblog.UserPost, error) {
 	manager.mu.RLock()
 	defer manager.mu.RUnlock()
 	post, ok := manager.allPosts[postId]
 	if !ok {
-		return microblog.UserPost{}, errors.New("post not found")
+		return microblog.UserPost{}, microblog.ErrNotFound
 	}
 	return post, nil
 }
@@ -61,55 +165,412 @@ func (manager *InMemoryManager) GetPost(_ context.Context, postId string) (micro
 func (manager *InMemoryManager) GetPostsInPage(_ context.Context, userId string, token string, size uint8) ([]microblog.UserPost, string, error) {
 	manager.mu.RLock()
 	defer manager.mu.RUnlock()
-	start := 0
+	return manager.postsInPage(manager.userPosts[userId], token, size)
+}
+
+func (manager *InMemoryManager) GetRepliesInPage(_ context.Context, postID string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+	if _, ok := manager.allPosts[postID]; !ok {
+		return nil, "", microblog.ErrNotFound
+	}
+	return manager.postsInPage(manager.replies[postID], token, size)
+}
+
+func (manager *InMemoryManager) GetTagPostsInPage(_ context.Context, tag string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+	return manager.postsInPage(manager.tagPosts[microblog.NormalizeHashtag(tag)], token, size)
+}
+
+func (manager *InMemoryManager) GetThread(_ context.Context, postID string) ([]microblog.UserPost, error) {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+	post, ok := manager.allPosts[postID]
+	if !ok {
+		return nil, microblog.ErrNotFound
+	}
+	thread := []microblog.UserPost{post}
+	for post.InReplyTo != "" {
+		if post, ok = manager.allPosts[post.InReplyTo]; !ok {
+			break
+		}
+		thread = append(thread, post)
+	}
+	slices.Reverse(thread)
+	return thread, nil
+}
+
+func (manager *InMemoryManager) GetFeedInPage(_ context.Context, userId string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+	var postIds PostIdsList
+	for followee := range manager.followees[userId] {
+		postIds = append(postIds, manager.userPosts[followee]...)
+	}
+	return manager.postsInPage(postIds, token, size)
+}
+
+// postsInPage returns up to size of the given posts in reverse-chronological order, starting
+// right after the post the token points to. Since the token holds the creation time and ID
+// of the last returned post, it stays valid even if that post is deleted.
+func (manager *InMemoryManager) postsInPage(postIds PostIdsList, token string, size uint8) ([]microblog.UserPost, string, error) {
+	var createdAt time.Time
+	var lastPostId string
 	if token != "" {
-		decoded, err := base64.StdEncoding.DecodeString(token)
-		if err == nil {
-			fmt.Sscanf(string(decoded), "%d", &start)
-		} else {
+		var err error
+		if createdAt, lastPostId, err = microblog.DecodePostCursor(token); err != nil {
 			return nil, "", err
 		}
 	}
-	posts, ok := manager.userPosts[userId]
-	if !ok {
-		return nil, "", errors.New("user not found")
-	}
-	if start >= len(posts) {
-		return nil, "", errors.New("no posts available for this page")
+	var posts []microblog.UserPost
+	for _, postId := range postIds {
+		post := manager.allPosts[postId]
+		if token == "" || isOlder(post, createdAt, lastPostId) {
+			posts = append(posts, post)
+		}
 	}
 	sort.Slice(posts, func(i, j int) bool {
-		return manager.allPosts[posts[i]].CreatedAt.After(manager.allPosts[posts[j]].CreatedAt)
+		return isOlder(posts[j], posts[i].CreatedAt, posts[i].PostId)
 	})
+	if len(posts) <= int(size) {
+		return posts, "", nil
+	}
+	if size == 0 {
+		return nil, "", nil
+	}
+	posts = posts[:size]
+	return posts, microblog.EncodePostCursor(posts[len(posts)-1].CreatedAt, posts[len(posts)-1].PostId), nil
+}
 
-	end := start + int(size)
-	if end > len(posts) {
-		end = len(posts)
+// isOlder reports whether post goes after the post with the given creation time and ID
+// in reverse-chronological order. Posts created at the same time are ordered by ID.
+func isOlder(post microblog.UserPost, createdAt time.Time, postId string) bool {
+	if post.CreatedAt.Equal(createdAt) {
+		return post.PostId < postId
 	}
-	var nextToken string
-	var result []microblog.UserPost
-	for _, post := range posts[start:end] {
-		result = append(result, manager.allPosts[post])
+	return post.CreatedAt.Before(createdAt)
+}
+
+func (manager *InMemoryManager) DeletePost(_ context.Context, postID string) error {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	if _, ok := manager.allPosts[postID]; !ok {
+		return microblog.ErrNotFound
+	}
+	return manager.commit(logRecord{Op: opDeletePost, PostId: postID})
+}
+
+// applyDeletePost removes the post along with its revisions, likes and index entries.
+// The caller must hold the write lock.
+func (manager *InMemoryManager) applyDeletePost(postID string) {
+	post := manager.allPosts[postID]
+	delete(manager.allPosts, postID)
+	delete(manager.revisions, postID)
+	delete(manager.likes, postID)
+	delete(manager.replies, postID)
+	delete(manager.reposts, postID)
+	manager.unindexText(post)
+	isDeleted := func(id string) bool { return id == postID }
+	manager.userPosts[post.AuthorId] = slices.DeleteFunc(manager.userPosts[post.AuthorId], isDeleted)
+	if post.InReplyTo != "" {
+		manager.replies[post.InReplyTo] = slices.DeleteFunc(manager.replies[post.InReplyTo], isDeleted)
+	}
+	if original, ok := manager.allPosts[post.RepostOf]; ok {
+		original.RepostsCount--
+		manager.allPosts[original.PostId] = original
+		if post.Kind == microblog.Repost {
+			delete(manager.reposts[original.PostId], post.AuthorId)
+		}
+	}
+}
+
+func (manager *InMemoryManager) Repost(_ context.Context, userId string, postID string, quote string) (microblog.UserPost, error) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	original, ok := manager.allPosts[postID]
+	if !ok {
+		return microblog.UserPost{}, microblog.ErrNotFound
+	}
+	if original.Kind == microblog.Repost {
+		if original, ok = manager.allPosts[original.RepostOf]; !ok {
+			return microblog.UserPost{}, microblog.ErrNotFound
+		}
 	}
-	if end < len(posts) {
-		nextToken = base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%d", end)))
+	kind := microblog.QuotePost
+	if quote == "" {
+		kind = microblog.Repost
+		if repostId, ok := manager.reposts[original.PostId][userId]; ok {
+			return manager.allPosts[repostId], nil
+		}
 	}
-	return result, nextToken, nil
 
+	return manager.addPost(microblog.UserPost{Text: quote, AuthorId: userId, Kind: kind, RepostOf: original.PostId})
 }
 
 func (manager *InMemoryManager) IsReady(_ context.Context) bool {
 	return true
 }
 
-func (manager *InMemoryManager) ModifyPost(_ context.Context, postID string, post string) (microblog.UserPost, error) {
+func (manager *InMemoryManager) ModifyPost(_ context.Context, postID string, editorId string, post string) (microblog.UserPost, error) {
 	manager.mu.Lock()
 	defer manager.mu.Unlock()
-	oldPost, ok := manager.allPosts[postID]
-	if !ok {
-		return microblog.UserPost{}, errors.New("post not found")
+	if _, ok := manager.allPosts[postID]; !ok {
+		return microblog.UserPost{}, microblog.ErrNotFound
 	}
+	record := logRecord{Op: opModifyPost, PostId: postID, UserId: editorId, Text: post, Time: time.Now().UTC()}
+	if err := manager.commit(record); err != nil {
+		return microblog.UserPost{}, err
+	}
+	return manager.allPosts[postID], nil
+}
+
+// applyModifyPost replaces the text of the post, keeping the previous one as a revision.
+// The caller must hold the write lock.
+func (manager *InMemoryManager) applyModifyPost(postID string, editorId string, post string, modifyTime time.Time) {
+	oldPost := manager.allPosts[postID]
+	revision := microblog.PostRevision{PostId: postID, Text: oldPost.Text, EditorId: editorId, EditedAt: modifyTime}
+	manager.revisions[postID] = append(manager.revisions[postID], revision)
+	manager.unindexText(oldPost)
 	oldPost.Text = post
-	oldPost.LastModifiedAt = time.Now().UTC()
+	oldPost.Tags = microblog.ExtractHashtags(post)
+	oldPost.Mentions = microblog.ExtractMentions(post)
+	oldPost.LastModifiedAt = modifyTime
 	manager.allPosts[postID] = oldPost
-	return oldPost, nil
+	manager.indexText(oldPost)
+}
+
+func (manager *InMemoryManager) GetPostRevisions(_ context.Context, postID string) ([]microblog.PostRevision, error) {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+	if _, ok := manager.allPosts[postID]; !ok {
+		return nil, microblog.ErrNotFound
+	}
+	revisions := slices.Clone(manager.revisions[postID])
+	slices.Reverse(revisions)
+	return revisions, nil
+}
+
+func (manager *InMemoryManager) SearchPosts(_ context.Context, query microblog.SearchQuery, token string, size uint8) ([]microblog.UserPost, string, error) {
+	var lastScore float64
+	var lastPostId string
+	if token != "" {
+		var err error
+		if lastScore, lastPostId, err = microblog.DecodeSearchCursor(token); err != nil {
+			return nil, "", err
+		}
+	}
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+
+	type result struct {
+		post  microblog.UserPost
+		score float64
+	}
+	var results []result
+	for _, postId := range manager.searchCandidates(query) {
+		post := manager.allPosts[postId]
+		if !query.MatchesFilters(post) {
+			continue
+		}
+		words := microblog.Tokenize(post.Text)
+		if !query.MatchesWords(words) {
+			continue
+		}
+		score := searchScore(query, words)
+		if token == "" || score < lastScore || score == lastScore && postId < lastPostId {
+			results = append(results, result{post, score})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].score == results[j].score {
+			return results[i].post.PostId > results[j].post.PostId
+		}
+		return results[i].score > results[j].score
+	})
+
+	if size == 0 {
+		return nil, "", nil
+	}
+	hasMore := len(results) > int(size)
+	if hasMore {
+		results = results[:size]
+	}
+	posts := make([]microblog.UserPost, len(results))
+	for i, r := range results {
+		posts[i] = r.post
+	}
+	if !hasMore {
+		return posts, "", nil
+	}
+	last := results[len(results)-1]
+	return posts, microblog.EncodeSearchCursor(last.score, last.post.PostId), nil
+}
+
+// searchCandidates returns the IDs of the posts that may match the query: the posts containing
+// every word of the phrases, or any of the terms if there are no phrases. The caller must hold the lock.
+func (manager *InMemoryManager) searchCandidates(query microblog.SearchQuery) PostIdsList {
+	if len(query.Phrases) == 0 {
+		var candidates PostIdsList
+		for _, term := range query.Terms {
+			candidates = append(candidates, manager.wordPosts[term]...)
+		}
+		slices.Sort(candidates)
+		return slices.Compact(candidates)
+	}
+
+	var words []string
+	for _, phrase := range query.Phrases {
+		words = append(words, phrase...)
+	}
+	// Intersect starting from the rarest word to keep the candidate set small.
+	slices.SortFunc(words, func(a, b string) int { return len(manager.wordPosts[a]) - len(manager.wordPosts[b]) })
+	candidates := slices.Clone(manager.wordPosts[words[0]])
+	for _, word := range words[1:] {
+		postIds := manager.wordPosts[word]
+		candidates = slices.DeleteFunc(candidates, func(id string) bool { return !slices.Contains(postIds, id) })
+	}
+	return candidates
+}
+
+// searchScore ranks a post by the number of occurrences of the query words in it,
+// normalized by the length of the post so that short focused posts go first.
+func searchScore(query microblog.SearchQuery, words []string) float64 {
+	queryWords := query.Words()
+	occurrences := 0
+	for _, word := range words {
+		if slices.Contains(queryWords, word) {
+			occurrences++
+		}
+	}
+	return float64(occurrences) / math.Sqrt(float64(len(words)))
+}
+
+func (manager *InMemoryManager) Subscribe(_ context.Context, userId string, targetId string) error {
+	if userId == targetId {
+		return microblog.ErrSelfSubscription
+	}
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	if _, ok := manager.followees[userId][targetId]; ok {
+		return nil
+	}
+	return manager.commit(logRecord{Op: opSubscribe, UserId: userId, TargetId: targetId})
+}
+
+// applySubscribe adds the subscription to the graph. The caller must hold the write lock.
+func (manager *InMemoryManager) applySubscribe(userId string, targetId string) {
+	if manager.followers[targetId] == nil {
+		manager.followers[targetId] = make(UserSet)
+	}
+	if manager.followees[userId] == nil {
+		manager.followees[userId] = make(UserSet)
+	}
+	manager.followers[targetId][userId] = struct{}{}
+	manager.followees[userId][targetId] = struct{}{}
+}
+
+func (manager *InMemoryManager) Unsubscribe(_ context.Context, userId string, targetId string) error {
+	if userId == targetId {
+		return microblog.ErrSelfSubscription
+	}
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	if _, ok := manager.followees[userId][targetId]; !ok {
+		return nil
+	}
+	return manager.commit(logRecord{Op: opUnsubscribe, UserId: userId, TargetId: targetId})
+}
+
+// applyUnsubscribe removes the subscription from the graph. The caller must hold the write lock.
+func (manager *InMemoryManager) applyUnsubscribe(userId string, targetId string) {
+	delete(manager.followers[targetId], userId)
+	delete(manager.followees[userId], targetId)
+}
+
+func (manager *InMemoryManager) GetFollowers(_ context.Context, userId string, token string, size uint8) ([]string, string, error) {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+	return usersInPage(manager.followers[userId], token, size)
+}
+
+func (manager *InMemoryManager) GetFollowees(_ context.Context, userId string, token string, size uint8) ([]string, string, error) {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+	return usersInPage(manager.followees[userId], token, size)
+}
+
+// usersInPage returns up to size user IDs from the set in ascending order, starting
+// right after the user the token points to. The token of the next page points to the
+// last returned user ID, or is empty if there are no more users.
+func usersInPage(set UserSet, token string, size uint8) ([]string, string, error) {
+	var lastUserId string
+	if token != "" {
+		var err error
+		if lastUserId, err = microblog.DecodeUserCursor(token); err != nil {
+			return nil, "", err
+		}
+	}
+	users := make([]string, 0, len(set))
+	for user := range set {
+		if user > lastUserId {
+			users = append(users, user)
+		}
+	}
+	sort.Strings(users)
+	if len(users) <= int(size) {
+		return users, "", nil
+	}
+	if size == 0 {
+		return nil, "", nil
+	}
+	users = users[:size]
+	return users, microblog.EncodeUserCursor(users[len(users)-1]), nil
+}
+
+func (manager *InMemoryManager) LikePost(_ context.Context, postID string, userId string) (microblog.UserPost, error) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	if _, ok := manager.allPosts[postID]; !ok {
+		return microblog.UserPost{}, microblog.ErrNotFound
+	}
+	if _, liked := manager.likes[postID][userId]; !liked {
+		if err := manager.commit(logRecord{Op: opLikePost, PostId: postID, UserId: userId}); err != nil {
+			return microblog.UserPost{}, err
+		}
+	}
+	return manager.allPosts[postID], nil
+}
+
+// applyLikePost records the like of the user and counts it. The caller must hold the write lock.
+func (manager *InMemoryManager) applyLikePost(postID string, userId string) {
+	if manager.likes[postID] == nil {
+		manager.likes[postID] = make(UserSet)
+	}
+	post := manager.allPosts[postID]
+	manager.likes[postID][userId] = struct{}{}
+	post.LikesCount++
+	manager.allPosts[postID] = post
+}
+
+func (manager *InMemoryManager) UnlikePost(_ context.Context, postID string, userId string) (microblog.UserPost, error) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	if _, ok := manager.allPosts[postID]; !ok {
+		return microblog.UserPost{}, microblog.ErrNotFound
+	}
+	if _, liked := manager.likes[postID][userId]; liked {
+		if err := manager.commit(logRecord{Op: opUnlikePost, PostId: postID, UserId: userId}); err != nil {
+			return microblog.UserPost{}, err
+		}
+	}
+	return manager.allPosts[postID], nil
+}
+
+// applyUnlikePost withdraws the like of the user. The caller must hold the write lock.
+func (manager *InMemoryManager) applyUnlikePost(postID string, userId string) {
+	post := manager.allPosts[postID]
+	delete(manager.likes[postID], userId)
+	post.LikesCount--
+	manager.allPosts[postID] = post
 }
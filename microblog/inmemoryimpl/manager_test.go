@@ -0,0 +1,24 @@
+package inmemoryimpl
+
+import (
+	"micro-blog/microblog"
+	"micro-blog/microblog/microblogtest"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+func TestManager(t *testing.T) {
+	suite.Run(t, &microblogtest.ManagerSuite{NewManager: func(*testing.T) microblog.Manager {
+		return NewInMemoryManager()
+	}})
+}
+
+func TestDurableManagerConformance(t *testing.T) {
+	suite.Run(t, &microblogtest.ManagerSuite{NewManager: func(t *testing.T) microblog.Manager {
+		// a small log makes the suite go through compactions
+		manager := NewDurableInMemoryManager(t.TempDir(), 16)
+		t.Cleanup(func() { _ = manager.Close() })
+		return manager
+	}})
+}
@@ -0,0 +1,245 @@
+// Package localcacheimpl keeps the hot posts in process memory in front of another manager,
+// taking the reads of popular posts off the shared cache and the storage.
+package localcacheimpl
+
+import (
+	"context"
+	"micro-blog/collection"
+	"micro-blog/microblog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats are the counters of the post cache since the manager was created.
+type Stats struct {
+	Hits   uint64
+	Misses uint64
+	// Evictions is the number of posts dropped to make room for others or due to the TTL.
+	Evictions uint64
+	// Size is the number of posts currently cached.
+	Size int
+}
+
+// NewLocalCacheManager caches up to capacity posts read through manager for at most ttl, or until evicted
+// if ttl is 0. When several instances of the service share the storage, ttl bounds the staleness of the posts
+// changed by the other instances, unless the manager is subscribed to their invalidations as an evictor.
+func NewLocalCacheManager(manager microblog.Manager, capacity int, ttl time.Duration) *LocalCacheManager {
+	if capacity <= 0 {
+		panic("capacity of the local cache must be positive")
+	}
+	m := &LocalCacheManager{manager: manager, ttl: ttl}
+	m.posts = collection.NewLRU[string, microblog.UserPost](capacity, func(string, microblog.UserPost) {
+		m.evictions.Add(1)
+	})
+	return m
+}
+
+type LocalCacheManager struct {
+	manager microblog.Manager
+	ttl     time.Duration
+
+	mu    sync.Mutex
+	posts *collection.LRU[string, microblog.UserPost]
+	// generation is bumped by every change of the cached posts, so that a post loaded before a change
+	// is not cached after it.
+	generation uint64
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+}
+
+// Stats returns the hit, miss and eviction counters and the size of the cache.
+func (m *LocalCacheManager) Stats() Stats {
+	m.mu.Lock()
+	size := m.posts.Len()
+	m.mu.Unlock()
+	return Stats{Hits: m.hits.Load(), Misses: m.misses.Load(), Evictions: m.evictions.Load(), Size: size}
+}
+
+// Evict drops the cached copy of the post changed elsewhere.
+func (m *LocalCacheManager) Evict(postID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.generation++
+	m.posts.Delete(postID)
+}
+
+// EvictAll drops every cached post.
+func (m *LocalCacheManager) EvictAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.generation++
+	m.posts.Purge()
+}
+
+// store caches the post unless the cached posts changed since generation.
+func (m *LocalCacheManager) store(post microblog.UserPost, generation uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if generation != m.generation {
+		return
+	}
+	m.posts.UpsertWithTTL(post.PostId, post, m.ttl)
+}
+
+// writeThrough replaces the cached copy of the post with its version returned by a write.
+func (m *LocalCacheManager) writeThrough(post microblog.UserPost) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.generation++
+	m.posts.UpsertWithTTL(post.PostId, post, m.ttl)
+}
+
+// GetPost serves the post from the cache, reading it through the wrapped manager on a miss.
+// Posts that are not found are not cached.
+func (m *LocalCacheManager) GetPost(ctx context.Context, postID string) (microblog.UserPost, error) {
+	m.mu.Lock()
+	post, ok := m.posts.At(postID)
+	generation := m.generation
+	m.mu.Unlock()
+	if ok {
+		m.hits.Add(1)
+		return post, nil
+	}
+	m.misses.Add(1)
+	post, err := m.manager.GetPost(ctx, postID)
+	if err != nil {
+		return post, err
+	}
+	m.store(post, generation)
+	return post, nil
+}
+
+// AddPost delegates to the wrapped manager, new posts are cached once read.
+func (m *LocalCacheManager) AddPost(ctx context.Context, userId string, post string) (microblog.UserPost, error) {
+	return m.manager.AddPost(ctx, userId, post)
+}
+
+// AddReply delegates to the wrapped manager.
+func (m *LocalCacheManager) AddReply(ctx context.Context, userId string, inReplyTo string, post string) (microblog.UserPost, error) {
+	return m.manager.AddReply(ctx, userId, inReplyTo, post)
+}
+
+// DeletePost deletes the post through the wrapped manager and evicts it, along with the original
+// post of a repost, whose reposts counter has changed.
+func (m *LocalCacheManager) DeletePost(ctx context.Context, postID string) error {
+	post, err := m.GetPost(ctx, postID)
+	if err != nil {
+		return err
+	}
+	if err := m.manager.DeletePost(ctx, postID); err != nil {
+		return err
+	}
+	m.Evict(postID)
+	if post.RepostOf != "" {
+		m.Evict(post.RepostOf)
+	}
+	return nil
+}
+
+// GetFeedInPage delegates pagination to the wrapped manager.
+func (m *LocalCacheManager) GetFeedInPage(ctx context.Context, userId string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	return m.manager.GetFeedInPage(ctx, userId, token, size)
+}
+
+// GetFollowees delegates pagination to the wrapped manager.
+func (m *LocalCacheManager) GetFollowees(ctx context.Context, userId string, token string, size uint8) ([]string, string, error) {
+	return m.manager.GetFollowees(ctx, userId, token, size)
+}
+
+// GetFollowers delegates pagination to the wrapped manager.
+func (m *LocalCacheManager) GetFollowers(ctx context.Context, userId string, token string, size uint8) ([]string, string, error) {
+	return m.manager.GetFollowers(ctx, userId, token, size)
+}
+
+// GetMentionsInPage delegates pagination to the wrapped manager.
+func (m *LocalCacheManager) GetMentionsInPage(ctx context.Context, userId string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	return m.manager.GetMentionsInPage(ctx, userId, token, size)
+}
+
+// GetPostRevisions delegates to the wrapped manager.
+func (m *LocalCacheManager) GetPostRevisions(ctx context.Context, postID string) ([]microblog.PostRevision, error) {
+	return m.manager.GetPostRevisions(ctx, postID)
+}
+
+// GetPostsInPage delegates pagination to the wrapped manager.
+func (m *LocalCacheManager) GetPostsInPage(ctx context.Context, userId string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	return m.manager.GetPostsInPage(ctx, userId, token, size)
+}
+
+// GetRepliesInPage delegates pagination to the wrapped manager.
+func (m *LocalCacheManager) GetRepliesInPage(ctx context.Context, postID string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	return m.manager.GetRepliesInPage(ctx, postID, token, size)
+}
+
+// GetTagPostsInPage delegates pagination to the wrapped manager.
+func (m *LocalCacheManager) GetTagPostsInPage(ctx context.Context, tag string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	return m.manager.GetTagPostsInPage(ctx, tag, token, size)
+}
+
+// GetThread delegates to the wrapped manager.
+func (m *LocalCacheManager) GetThread(ctx context.Context, postID string) ([]microblog.UserPost, error) {
+	return m.manager.GetThread(ctx, postID)
+}
+
+// IsReady delegates the health check to the wrapped manager.
+func (m *LocalCacheManager) IsReady(ctx context.Context) bool {
+	return m.manager.IsReady(ctx)
+}
+
+// LikePost writes through the like and caches the post with the new counter.
+func (m *LocalCacheManager) LikePost(ctx context.Context, postID string, userId string) (microblog.UserPost, error) {
+	updated, err := m.manager.LikePost(ctx, postID, userId)
+	if err != nil {
+		return updated, err
+	}
+	m.writeThrough(updated)
+	return updated, nil
+}
+
+// ModifyPost writes through the update and caches the modified post.
+func (m *LocalCacheManager) ModifyPost(ctx context.Context, postID string, editorId string, post string) (microblog.UserPost, error) {
+	updated, err := m.manager.ModifyPost(ctx, postID, editorId, post)
+	if err != nil {
+		return updated, err
+	}
+	m.writeThrough(updated)
+	return updated, nil
+}
+
+// Repost writes through the repost and evicts the original post with the stale reposts counter.
+func (m *LocalCacheManager) Repost(ctx context.Context, userId string, postID string, quote string) (microblog.UserPost, error) {
+	created, err := m.manager.Repost(ctx, userId, postID, quote)
+	if err != nil {
+		return created, err
+	}
+	m.Evict(created.RepostOf)
+	return created, nil
+}
+
+// SearchPosts delegates the search to the wrapped manager.
+func (m *LocalCacheManager) SearchPosts(ctx context.Context, query microblog.SearchQuery, token string, size uint8) ([]microblog.UserPost, string, error) {
+	return m.manager.SearchPosts(ctx, query, token, size)
+}
+
+// Subscribe delegates to the wrapped manager.
+func (m *LocalCacheManager) Subscribe(ctx context.Context, userId string, targetId string) error {
+	return m.manager.Subscribe(ctx, userId, targetId)
+}
+
+// UnlikePost writes through the unlike and caches the post with the new counter.
+func (m *LocalCacheManager) UnlikePost(ctx context.Context, postID string, userId string) (microblog.UserPost, error) {
+	updated, err := m.manager.UnlikePost(ctx, postID, userId)
+	if err != nil {
+		return updated, err
+	}
+	m.writeThrough(updated)
+	return updated, nil
+}
+
+// Unsubscribe delegates to the wrapped manager.
+func (m *LocalCacheManager) Unsubscribe(ctx context.Context, userId string, targetId string) error {
+	return m.manager.Unsubscribe(ctx, userId, targetId)
+}
@@ -0,0 +1,205 @@
+package localcacheimpl
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"micro-blog/microblog"
+	"micro-blog/microblog/inmemoryimpl"
+	"micro-blog/microblog/microblogtest"
+	"micro-blog/microblog/redisimpl"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/suite"
+)
+
+var ctx = context.Background()
+
+func TestLocalCacheManager(t *testing.T) {
+	suite.Run(t, new(LocalCacheManagerSuite))
+}
+
+func TestLocalCacheManagerConformance(t *testing.T) {
+	suite.Run(t, &microblogtest.ManagerSuite{NewManager: func(t *testing.T) microblog.Manager {
+		return NewLocalCacheManager(inmemoryimpl.NewInMemoryManager(), 100, time.Minute)
+	}})
+}
+
+type LocalCacheManagerSuite struct {
+	suite.Suite
+
+	persistent *inmemoryimpl.InMemoryManager
+	counting   *countingManager
+	cached     *LocalCacheManager
+}
+
+func (s *LocalCacheManagerSuite) SetupTest() {
+	s.persistent = inmemoryimpl.NewInMemoryManager()
+	s.counting = &countingManager{InMemoryManager: s.persistent}
+	s.cached = NewLocalCacheManager(s.counting, 2, time.Minute)
+}
+
+// countingManager counts the reads of posts and runs afterGet once, after the first one.
+type countingManager struct {
+	*inmemoryimpl.InMemoryManager
+	gets     atomic.Int64
+	afterGet func()
+}
+
+func (m *countingManager) GetPost(ctx context.Context, postID string) (microblog.UserPost, error) {
+	m.gets.Add(1)
+	post, err := m.InMemoryManager.GetPost(ctx, postID)
+	if m.afterGet != nil {
+		afterGet := m.afterGet
+		m.afterGet = nil
+		afterGet()
+	}
+	return post, err
+}
+
+func (s *LocalCacheManagerSuite) TestGetPost_ServesHitsFromMemory() {
+	p, err := s.persistent.AddPost(ctx, "alice", "hot")
+	s.Require().NoError(err)
+
+	for range 3 {
+		got, err := s.cached.GetPost(ctx, p.PostId)
+		s.Require().NoError(err)
+		s.Require().Equal(p, got)
+	}
+	s.Require().EqualValues(1, s.counting.gets.Load())
+	s.Require().Equal(Stats{Hits: 2, Misses: 1, Size: 1}, s.cached.Stats())
+}
+
+func (s *LocalCacheManagerSuite) TestGetPost_DoesNotCacheMissingPosts() {
+	for range 2 {
+		_, err := s.cached.GetPost(ctx, "missing")
+		s.Require().ErrorIs(err, microblog.ErrNotFound)
+	}
+	s.Require().EqualValues(2, s.counting.gets.Load())
+	s.Require().Equal(Stats{Misses: 2}, s.cached.Stats())
+}
+
+func (s *LocalCacheManagerSuite) TestGetPost_EvictsLeastRecentlyUsed() {
+	var posts []microblog.UserPost
+	for _, text := range []string{"first", "second", "third"} {
+		p, err := s.persistent.AddPost(ctx, "alice", text)
+		s.Require().NoError(err)
+		posts = append(posts, p)
+	}
+	for _, i := range []int{0, 1, 0, 2} {
+		_, err := s.cached.GetPost(ctx, posts[i].PostId)
+		s.Require().NoError(err)
+	}
+	// the second post was the least recently used one when the third one was cached
+	s.Require().Equal(Stats{Hits: 1, Misses: 3, Evictions: 1, Size: 2}, s.cached.Stats())
+	for _, i := range []int{0, 2} {
+		_, err := s.cached.GetPost(ctx, posts[i].PostId)
+		s.Require().NoError(err)
+	}
+	s.Require().EqualValues(3, s.counting.gets.Load())
+}
+
+func (s *LocalCacheManagerSuite) TestModifyPost_WritesThrough() {
+	p, err := s.persistent.AddPost(ctx, "bob", "v1")
+	s.Require().NoError(err)
+	_, err = s.cached.GetPost(ctx, p.PostId)
+	s.Require().NoError(err)
+
+	updated, err := s.cached.ModifyPost(ctx, p.PostId, "bob", "v2")
+	s.Require().NoError(err)
+	got, err := s.cached.GetPost(ctx, p.PostId)
+	s.Require().NoError(err)
+	s.Require().Equal(updated, got)
+	s.Require().Equal("v2", got.Text)
+	s.Require().EqualValues(1, s.counting.gets.Load())
+}
+
+func (s *LocalCacheManagerSuite) TestGetPost_DropsLoadRacingWithWrite() {
+	p, err := s.persistent.AddPost(ctx, "bob", "v1")
+	s.Require().NoError(err)
+	var updated microblog.UserPost
+	s.counting.afterGet = func() {
+		updated, err = s.cached.ModifyPost(ctx, p.PostId, "bob", "v2")
+		s.Require().NoError(err)
+	}
+
+	got, err := s.cached.GetPost(ctx, p.PostId)
+	s.Require().NoError(err)
+	s.Require().Equal("v1", got.Text)
+
+	got, err = s.cached.GetPost(ctx, p.PostId)
+	s.Require().NoError(err)
+	s.Require().Equal(updated, got)
+}
+
+func (s *LocalCacheManagerSuite) TestWrites_RefreshCounters() {
+	p, err := s.persistent.AddPost(ctx, "alice", "original")
+	s.Require().NoError(err)
+	_, err = s.cached.GetPost(ctx, p.PostId)
+	s.Require().NoError(err)
+
+	liked, err := s.cached.LikePost(ctx, p.PostId, "bob")
+	s.Require().NoError(err)
+	got, err := s.cached.GetPost(ctx, p.PostId)
+	s.Require().NoError(err)
+	s.Require().Equal(liked, got)
+
+	repost, err := s.cached.Repost(ctx, "bob", p.PostId, "")
+	s.Require().NoError(err)
+	got, err = s.cached.GetPost(ctx, p.PostId)
+	s.Require().NoError(err)
+	s.Require().EqualValues(1, got.RepostsCount)
+
+	s.Require().NoError(s.cached.DeletePost(ctx, repost.PostId))
+	got, err = s.cached.GetPost(ctx, p.PostId)
+	s.Require().NoError(err)
+	s.Require().EqualValues(0, got.RepostsCount)
+	_, err = s.cached.GetPost(ctx, repost.PostId)
+	s.Require().ErrorIs(err, microblog.ErrNotFound)
+}
+
+func (s *LocalCacheManagerSuite) TestEvictAll() {
+	p, err := s.persistent.AddPost(ctx, "alice", "hot")
+	s.Require().NoError(err)
+	_, err = s.cached.GetPost(ctx, p.PostId)
+	s.Require().NoError(err)
+
+	s.cached.EvictAll()
+	s.Require().Zero(s.cached.Stats().Size)
+	_, err = s.cached.GetPost(ctx, p.PostId)
+	s.Require().NoError(err)
+	s.Require().EqualValues(2, s.counting.gets.Load())
+}
+
+func (s *LocalCacheManagerSuite) TestRedisInvalidations_EvictOtherInstances() {
+	mini := miniredis.RunT(s.T())
+	newInstance := func() *LocalCacheManager {
+		client := redis.NewClient(&redis.Options{Addr: mini.Addr()})
+		s.T().Cleanup(func() { _ = client.Close() })
+		redisManager := redisimpl.NewRedisManager(client, s.persistent)
+		cached := NewLocalCacheManager(redisManager, 10, redisimpl.LocalCacheTTL)
+		listenCtx, cancel := context.WithCancel(ctx)
+		s.T().Cleanup(cancel)
+		go redisManager.Invalidations().Listen(listenCtx, cached)
+		return cached
+	}
+	writer, reader := newInstance(), newInstance()
+	s.Require().Eventually(func() bool {
+		return mini.PubSubNumSub("post-invalidations")["post-invalidations"] == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	p, err := s.persistent.AddPost(ctx, "alice", "v1")
+	s.Require().NoError(err)
+	_, err = reader.GetPost(ctx, p.PostId)
+	s.Require().NoError(err)
+
+	_, err = writer.ModifyPost(ctx, p.PostId, "alice", "v2")
+	s.Require().NoError(err)
+	s.Require().Eventually(func() bool {
+		got, err := reader.GetPost(ctx, p.PostId)
+		return err == nil && got.Text == "v2"
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,752 @@
+// Package microblogtest provides a conformance test suite for implementations of microblog.Manager.
+//
+// An implementation runs the suite by supplying a constructor of empty managers:
+//
+//	func TestManager(t *testing.T) {
+//		suite.Run(t, &microblogtest.ManagerSuite{NewManager: func(t *testing.T) microblog.Manager {
+//			return NewFooManager()
+//		}})
+//	}
+//
+// The suite can also be embedded into a suite of implementation-specific tests.
+package microblogtest
+
+import (
+	"context"
+	"fmt"
+	"micro-blog/microblog"
+	"micro-blog/microblog/idgen"
+	"regexp"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// timestampPrecision is the coarsest precision of the stored timestamps the suite accepts.
+const timestampPrecision = time.Millisecond
+
+// postIdPattern is the pattern of PostId in the API specification.
+var postIdPattern = regexp.MustCompile(`^[A-Za-z0-9_\-]+$`)
+
+// invalidToken is a page token no implementation can produce.
+const invalidToken = "not a token!"
+
+var ctx = context.Background()
+
+// ManagerSuite checks that a microblog.Manager implementation follows the contract of the interface:
+// which errors are returned for missing posts, that paging returns every item exactly once and in order,
+// that concurrent updates are not lost and that timestamps are consistent.
+type ManagerSuite struct {
+	suite.Suite
+
+	// NewManager returns the manager under test holding no data. It is called before every test,
+	// resources of the manager may be released with t.Cleanup.
+	NewManager func(t *testing.T) microblog.Manager
+	// Manager is the manager under test of the current test.
+	Manager microblog.Manager
+}
+
+func (s *ManagerSuite) SetupTest() {
+	s.Manager = s.NewManager(s.T())
+}
+
+func (s *ManagerSuite) addPost(userId string, text string) microblog.UserPost {
+	post, err := s.Manager.AddPost(ctx, userId, text)
+	s.Require().NoError(err)
+	return post
+}
+
+func (s *ManagerSuite) addNPosts(userId string, n int) []microblog.UserPost {
+	posts := make([]microblog.UserPost, n)
+	for i := range posts {
+		posts[i] = s.addPost(userId, fmt.Sprintf("This is post number %d", i+1))
+	}
+	return posts
+}
+
+// pageFunc fetches a page of items starting after the token.
+type pageFunc[T any] func(token string, size uint8) ([]T, string, error)
+
+// collectPages reads every page of the given size. Each page but the last one must be full,
+// and the last one must come without a token.
+func collectPages[T any](s *ManagerSuite, fetch pageFunc[T], size uint8) []T {
+	var items []T
+	token := ""
+	for range 1000 {
+		page, next, err := fetch(token, size)
+		s.Require().NoError(err)
+		if next == "" {
+			s.Require().LessOrEqual(len(page), int(size))
+			return append(items, page...)
+		}
+		s.Require().Len(page, int(size), "a page followed by another one must be full")
+		items = append(items, page...)
+		token = next
+	}
+	s.FailNow("paging does not end")
+	return nil
+}
+
+func postIds(posts []microblog.UserPost) []string {
+	ids := make([]string, len(posts))
+	for i, post := range posts {
+		ids[i] = post.PostId
+	}
+	return ids
+}
+
+func reversed(posts []microblog.UserPost) []string {
+	ids := postIds(posts)
+	slices.Reverse(ids)
+	return ids
+}
+
+// requireNewestFirst checks that the posts go in reverse-chronological order.
+func (s *ManagerSuite) requireNewestFirst(posts []microblog.UserPost) {
+	for i := 1; i < len(posts); i++ {
+		s.Require().False(posts[i].CreatedAt.After(posts[i-1].CreatedAt), "post %d is newer than post %d", i, i-1)
+	}
+}
+
+func (s *ManagerSuite) TestAddPost() {
+	usr := "broniy"
+	msg := "This is my first post"
+	p, err := s.Manager.AddPost(ctx, usr, msg)
+	s.Require().NoError(err)
+	s.Require().Regexp(postIdPattern, p.PostId)
+	s.Require().Equal(usr, p.AuthorId)
+	s.Require().Equal(msg, p.Text)
+	s.Require().Equal(microblog.RegularPost, p.Kind)
+	s.Require().Zero(p.LikesCount)
+	s.Require().Zero(p.RepostsCount)
+}
+
+// TestPostIdsAreTimeOrdered checks that the IDs come from idgen, so they sort like the posts.
+func (s *ManagerSuite) TestPostIdsAreTimeOrdered() {
+	posts := s.addNPosts("alice", 5)
+	reply, err := s.Manager.AddReply(ctx, "bob", posts[0].PostId, "reply")
+	s.Require().NoError(err)
+	repost, err := s.Manager.Repost(ctx, "bob", posts[1].PostId, "")
+	s.Require().NoError(err)
+	ids := append(postIds(posts), reply.PostId, repost.PostId)
+	s.Require().True(slices.IsSorted(ids), ids)
+	s.Require().Len(slices.Compact(ids), len(posts)+2)
+	for _, id := range ids {
+		_, err := idgen.Parse(id)
+		s.Require().NoError(err)
+	}
+}
+
+func (s *ManagerSuite) TestGetPost() {
+	usr := "broniy"
+	created := s.addNPosts(usr, 10)
+
+	post, err := s.Manager.GetPost(ctx, created[9].PostId)
+	s.Require().NoError(err)
+	s.Require().Equal(created[9], post)
+	s.Require().Equal("This is post number 10", post.Text)
+}
+
+func (s *ManagerSuite) TestNotFound() {
+	deleted := s.addPost("alice", "soon gone")
+	s.Require().NoError(s.Manager.DeletePost(ctx, deleted.PostId))
+
+	for _, postId := range []string{deleted.PostId, "missing"} {
+		s.Run(postId, func() {
+			var err error
+			_, err = s.Manager.GetPost(ctx, postId)
+			s.Require().ErrorIs(err, microblog.ErrNotFound, "GetPost")
+			_, err = s.Manager.ModifyPost(ctx, postId, "alice", "edited")
+			s.Require().ErrorIs(err, microblog.ErrNotFound, "ModifyPost")
+			s.Require().ErrorIs(s.Manager.DeletePost(ctx, postId), microblog.ErrNotFound, "DeletePost")
+			_, err = s.Manager.AddReply(ctx, "bob", postId, "reply")
+			s.Require().ErrorIs(err, microblog.ErrNotFound, "AddReply")
+			_, _, err = s.Manager.GetRepliesInPage(ctx, postId, "", 10)
+			s.Require().ErrorIs(err, microblog.ErrNotFound, "GetRepliesInPage")
+			_, err = s.Manager.GetThread(ctx, postId)
+			s.Require().ErrorIs(err, microblog.ErrNotFound, "GetThread")
+			_, err = s.Manager.GetPostRevisions(ctx, postId)
+			s.Require().ErrorIs(err, microblog.ErrNotFound, "GetPostRevisions")
+			_, err = s.Manager.LikePost(ctx, postId, "bob")
+			s.Require().ErrorIs(err, microblog.ErrNotFound, "LikePost")
+			_, err = s.Manager.UnlikePost(ctx, postId, "bob")
+			s.Require().ErrorIs(err, microblog.ErrNotFound, "UnlikePost")
+			_, err = s.Manager.Repost(ctx, "bob", postId, "")
+			s.Require().ErrorIs(err, microblog.ErrNotFound, "Repost")
+			_, err = s.Manager.Repost(ctx, "bob", postId, "quote")
+			s.Require().ErrorIs(err, microblog.ErrNotFound, "Repost with a quote")
+		})
+	}
+}
+
+func (s *ManagerSuite) TestEmptyPages() {
+	posts, token, err := s.Manager.GetPostsInPage(ctx, "nobody", "", 10)
+	s.Require().NoError(err)
+	s.Require().Empty(posts)
+	s.Require().Empty(token)
+	posts, token, err = s.Manager.GetFeedInPage(ctx, "nobody", "", 10)
+	s.Require().NoError(err)
+	s.Require().Empty(posts)
+	s.Require().Empty(token)
+	users, token, err := s.Manager.GetFollowers(ctx, "nobody", "", 10)
+	s.Require().NoError(err)
+	s.Require().Empty(users)
+	s.Require().Empty(token)
+}
+
+func (s *ManagerSuite) TestPageSizeZero() {
+	s.addNPosts("alice", 3)
+	posts, token, err := s.Manager.GetPostsInPage(ctx, "alice", "", 0)
+	s.Require().NoError(err)
+	s.Require().Empty(posts)
+	s.Require().Empty(token)
+}
+
+// tamper changes a character in the middle of the token, keeping it in the alphabet of page tokens.
+func tamper(token string) string {
+	i := len(token) / 2
+	replacement := "A"
+	if token[i] == 'A' {
+		replacement = "B"
+	}
+	return token[:i] + replacement + token[i+1:]
+}
+
+func (s *ManagerSuite) TestInvalidToken() {
+	root := s.addPost("alice", "root")
+	for range 2 {
+		_, err := s.Manager.AddReply(ctx, "alice", root.PostId, "#go @b0b go")
+		s.Require().NoError(err)
+	}
+	s.Require().NoError(s.Manager.Subscribe(ctx, "bob", "alice"))
+	s.Require().NoError(s.Manager.Subscribe(ctx, "carol", "alice"))
+	query, err := microblog.ParseSearchQuery("go")
+	s.Require().NoError(err)
+
+	_, usersToken, err := s.Manager.GetFollowers(ctx, "alice", "", 1)
+	s.Require().NoError(err)
+	s.Require().NotEmpty(usersToken)
+	for name, token := range map[string]string{"malformed": invalidToken, "tampered": tamper(usersToken)} {
+		_, _, err := s.Manager.GetFollowers(ctx, "alice", token, 10)
+		s.Require().ErrorIs(err, microblog.ErrInvalidToken, "GetFollowers with a %s token", name)
+		_, _, err = s.Manager.GetFollowees(ctx, "bob", token, 10)
+		s.Require().ErrorIs(err, microblog.ErrInvalidToken, "GetFollowees with a %s token", name)
+	}
+
+	pages := map[string]pageFunc[microblog.UserPost]{
+		"GetPostsInPage": func(token string, size uint8) ([]microblog.UserPost, string, error) {
+			return s.Manager.GetPostsInPage(ctx, "alice", token, size)
+		},
+		"GetFeedInPage": func(token string, size uint8) ([]microblog.UserPost, string, error) {
+			return s.Manager.GetFeedInPage(ctx, "bob", token, size)
+		},
+		"GetRepliesInPage": func(token string, size uint8) ([]microblog.UserPost, string, error) {
+			return s.Manager.GetRepliesInPage(ctx, root.PostId, token, size)
+		},
+		"GetTagPostsInPage": func(token string, size uint8) ([]microblog.UserPost, string, error) {
+			return s.Manager.GetTagPostsInPage(ctx, "go", token, size)
+		},
+		"GetMentionsInPage": func(token string, size uint8) ([]microblog.UserPost, string, error) {
+			return s.Manager.GetMentionsInPage(ctx, "b0b", token, size)
+		},
+		"SearchPosts": func(token string, size uint8) ([]microblog.UserPost, string, error) {
+			return s.Manager.SearchPosts(ctx, query, token, size)
+		},
+	}
+	for name, fetch := range pages {
+		_, token, err := fetch("", 1)
+		s.Require().NoError(err, name)
+		s.Require().NotEmpty(token, name)
+		for kind, invalid := range map[string]string{
+			"malformed":    invalidToken,
+			"tampered":     tamper(token),
+			"user listing": usersToken,
+		} {
+			_, _, err := fetch(invalid, 10)
+			s.Require().ErrorIs(err, microblog.ErrInvalidToken, "%s with a %s token", name, kind)
+		}
+	}
+}
+
+func (s *ManagerSuite) TestGetPostsInPage() {
+	usr := "bobi"
+	s.addNPosts(usr, 10)
+
+	posts, token, err := s.Manager.GetPostsInPage(ctx, usr, "", 5)
+	s.Require().NoError(err)
+	s.Require().Len(posts, 5)
+	s.Require().Equal(usr, posts[0].AuthorId)
+	s.Require().Equal("This is post number 10", posts[0].Text)
+	s.Require().Equal("This is post number 6", posts[4].Text)
+	s.Require().NotEmpty(token)
+
+	posts, token, err = s.Manager.GetPostsInPage(ctx, usr, token, 5)
+	s.Require().NoError(err)
+	s.Require().Len(posts, 5)
+	s.Require().Equal("This is post number 5", posts[0].Text)
+	s.Require().Equal("This is post number 1", posts[4].Text)
+	s.Require().Empty(token)
+}
+
+func (s *ManagerSuite) TestPaginationCompleteness() {
+	created := s.addNPosts("alice", 20)
+	for i := range 5 {
+		reply, err := s.Manager.AddReply(ctx, "bob", created[0].PostId, fmt.Sprintf("reply %d #go @a11ce", i))
+		s.Require().NoError(err)
+		created = append(created, reply)
+	}
+	replies := created[20:]
+	var followers []string
+	for i := range 12 {
+		follower := fmt.Sprintf("f%02d", i)
+		s.Require().NoError(s.Manager.Subscribe(ctx, follower, "alice"))
+		followers = append(followers, follower)
+	}
+	s.Require().NoError(s.Manager.Subscribe(ctx, "f00", "bob"))
+
+	for size := uint8(1); size <= 7; size++ {
+		s.Run(fmt.Sprintf("size %d", size), func() {
+			timeline := collectPages(s, func(token string, size uint8) ([]microblog.UserPost, string, error) {
+				return s.Manager.GetPostsInPage(ctx, "alice", token, size)
+			}, size)
+			s.Require().Equal(reversed(created[:20]), postIds(timeline))
+
+			feed := collectPages(s, func(token string, size uint8) ([]microblog.UserPost, string, error) {
+				return s.Manager.GetFeedInPage(ctx, "f00", token, size)
+			}, size)
+			s.Require().Equal(reversed(created), postIds(feed))
+
+			replyPage := collectPages(s, func(token string, size uint8) ([]microblog.UserPost, string, error) {
+				return s.Manager.GetRepliesInPage(ctx, created[0].PostId, token, size)
+			}, size)
+			s.Require().Equal(reversed(replies), postIds(replyPage))
+
+			tagged := collectPages(s, func(token string, size uint8) ([]microblog.UserPost, string, error) {
+				return s.Manager.GetTagPostsInPage(ctx, "go", token, size)
+			}, size)
+			s.Require().Equal(reversed(replies), postIds(tagged))
+
+			mentions := collectPages(s, func(token string, size uint8) ([]microblog.UserPost, string, error) {
+				return s.Manager.GetMentionsInPage(ctx, "a11ce", token, size)
+			}, size)
+			s.Require().Equal(reversed(replies), postIds(mentions))
+
+			users := collectPages(s, func(token string, size uint8) ([]string, string, error) {
+				return s.Manager.GetFollowers(ctx, "alice", token, size)
+			}, size)
+			s.Require().Equal(followers, users)
+
+			followees := collectPages(s, func(token string, size uint8) ([]string, string, error) {
+				return s.Manager.GetFollowees(ctx, "f00", token, size)
+			}, size)
+			s.Require().Equal([]string{"alice", "bob"}, followees)
+		})
+	}
+}
+
+func (s *ManagerSuite) TestPaginationIsStableUnderWrites() {
+	created := s.addNPosts("alice", 10)
+
+	posts, token, err := s.Manager.GetPostsInPage(ctx, "alice", "", 4)
+	s.Require().NoError(err)
+	seen := postIds(posts)
+	// newer posts do not shift the following pages
+	s.addNPosts("alice", 3)
+	for token != "" {
+		posts, token, err = s.Manager.GetPostsInPage(ctx, "alice", token, 4)
+		s.Require().NoError(err)
+		seen = append(seen, postIds(posts)...)
+	}
+	s.Require().Equal(reversed(created), seen)
+}
+
+func (s *ManagerSuite) TestOrdering() {
+	var created []microblog.UserPost
+	for i := range 6 {
+		for _, author := range []string{"alice", "bob", "carol"} {
+			created = append(created, s.addPost(author, fmt.Sprintf("%s post %d", author, i)))
+		}
+	}
+	s.Require().NoError(s.Manager.Subscribe(ctx, "dave", "alice"))
+	s.Require().NoError(s.Manager.Subscribe(ctx, "dave", "bob"))
+	s.Require().NoError(s.Manager.Subscribe(ctx, "dave", "carol"))
+
+	feed := collectPages(s, func(token string, size uint8) ([]microblog.UserPost, string, error) {
+		return s.Manager.GetFeedInPage(ctx, "dave", token, size)
+	}, 5)
+	s.requireNewestFirst(feed)
+	s.Require().Equal(reversed(created), postIds(feed))
+	for _, post := range feed {
+		s.Require().False(post.CreatedAt.IsZero())
+	}
+}
+
+func (s *ManagerSuite) TestTimestamps() {
+	before := time.Now().Truncate(timestampPrecision)
+	p := s.addPost("alice", "v1")
+	after := time.Now()
+	s.Require().Equal(time.UTC, p.CreatedAt.Location())
+	s.Require().False(p.CreatedAt.Before(before), "the creation time is before the call")
+	s.Require().False(p.CreatedAt.After(after), "the creation time is after the call")
+	s.Require().True(p.LastModifiedAt.IsZero(), "a new post is not modified")
+
+	fetched, err := s.Manager.GetPost(ctx, p.PostId)
+	s.Require().NoError(err)
+	s.Require().Equal(p, fetched, "the stored post differs from the created one")
+
+	modified, err := s.Manager.ModifyPost(ctx, p.PostId, "alice", "v2")
+	s.Require().NoError(err)
+	s.Require().Equal(p.CreatedAt, modified.CreatedAt, "modification changed the creation time")
+	s.Require().Equal(time.UTC, modified.LastModifiedAt.Location())
+	s.Require().False(modified.LastModifiedAt.Before(p.CreatedAt))
+	s.Require().False(modified.LastModifiedAt.After(time.Now()))
+
+	fetched, err = s.Manager.GetPost(ctx, p.PostId)
+	s.Require().NoError(err)
+	s.Require().Equal(modified, fetched, "the stored post differs from the modified one")
+
+	revisions, err := s.Manager.GetPostRevisions(ctx, p.PostId)
+	s.Require().NoError(err)
+	s.Require().Len(revisions, 1)
+	s.Require().True(modified.LastModifiedAt.Equal(revisions[0].EditedAt), "the revision time differs from the modification time")
+
+	// timestamps do not go back for posts created later
+	next := s.addPost("alice", "v3")
+	s.Require().False(next.CreatedAt.Before(p.CreatedAt))
+}
+
+func (s *ManagerSuite) TestModifyPost() {
+	usr := "alice"
+	p := s.addPost(usr, "Original message #old")
+
+	newText := "Updated message #new @b0b"
+	updated, err := s.Manager.ModifyPost(ctx, p.PostId, usr, newText)
+	s.Require().NoError(err)
+	s.Require().Equal(p.PostId, updated.PostId)
+	s.Require().Equal(usr, updated.AuthorId)
+	s.Require().Equal(newText, updated.Text)
+	s.Require().Equal([]string{"new"}, updated.Tags)
+	s.Require().Equal([]string{"b0b"}, updated.Mentions)
+	s.Require().False(updated.LastModifiedAt.IsZero())
+
+	fetched, err := s.Manager.GetPost(ctx, p.PostId)
+	s.Require().NoError(err)
+	s.Require().Equal(newText, fetched.Text)
+	s.Require().False(fetched.LastModifiedAt.IsZero())
+}
+
+func (s *ManagerSuite) TestSubscriptions() {
+	followee := "bob"
+	for _, follower := range []string{"alice", "carol", "dave"} {
+		s.Require().NoError(s.Manager.Subscribe(ctx, follower, followee))
+	}
+	// subscribing twice must not create a duplicate
+	s.Require().NoError(s.Manager.Subscribe(ctx, "alice", followee))
+	s.Require().ErrorIs(s.Manager.Subscribe(ctx, followee, followee), microblog.ErrSelfSubscription)
+	s.Require().ErrorIs(s.Manager.Unsubscribe(ctx, followee, followee), microblog.ErrSelfSubscription)
+
+	followers, token, err := s.Manager.GetFollowers(ctx, followee, "", 2)
+	s.Require().NoError(err)
+	s.Require().Equal([]string{"alice", "carol"}, followers)
+	s.Require().NotEmpty(token)
+
+	followers, token, err = s.Manager.GetFollowers(ctx, followee, token, 2)
+	s.Require().NoError(err)
+	s.Require().Equal([]string{"dave"}, followers)
+	s.Require().Empty(token)
+
+	s.Require().NoError(s.Manager.Unsubscribe(ctx, "carol", followee))
+	s.Require().NoError(s.Manager.Unsubscribe(ctx, "carol", followee))
+	followees, _, err := s.Manager.GetFollowees(ctx, "carol", "", 10)
+	s.Require().NoError(err)
+	s.Require().Empty(followees)
+}
+
+func (s *ManagerSuite) TestGetFeedInPage() {
+	reader := "dave"
+	s.Require().NoError(s.Manager.Subscribe(ctx, reader, "alice"))
+	s.Require().NoError(s.Manager.Subscribe(ctx, reader, "bob"))
+	s.addNPosts("alice", 10)
+	s.addNPosts("bob", 10)
+	s.addNPosts("carol", 10)
+
+	feed := collectPages(s, func(token string, size uint8) ([]microblog.UserPost, string, error) {
+		return s.Manager.GetFeedInPage(ctx, reader, token, size)
+	}, 6)
+	s.Require().Len(feed, 20)
+	s.Require().Equal("bob", feed[0].AuthorId)
+	s.Require().Equal("This is post number 10", feed[0].Text)
+	for _, post := range feed {
+		s.Require().NotEqual("carol", post.AuthorId)
+	}
+	s.requireNewestFirst(feed)
+}
+
+func (s *ManagerSuite) TestDeletePost() {
+	usr := "alice"
+	s.addNPosts(usr, 10)
+
+	posts, token, err := s.Manager.GetPostsInPage(ctx, usr, "", 5)
+	s.Require().NoError(err)
+	s.Require().NoError(s.Manager.DeletePost(ctx, posts[4].PostId))
+	s.Require().ErrorIs(s.Manager.DeletePost(ctx, posts[4].PostId), microblog.ErrNotFound)
+	_, err = s.Manager.GetPost(ctx, posts[4].PostId)
+	s.Require().ErrorIs(err, microblog.ErrNotFound)
+
+	// the token points at the deleted post but still resumes right after it
+	posts, token, err = s.Manager.GetPostsInPage(ctx, usr, token, 5)
+	s.Require().NoError(err)
+	s.Require().Len(posts, 5)
+	s.Require().Equal("This is post number 5", posts[0].Text)
+	s.Require().Empty(token)
+}
+
+func (s *ManagerSuite) TestGetPostRevisions() {
+	usr := "alice"
+	p := s.addPost(usr, "v1")
+
+	revisions, err := s.Manager.GetPostRevisions(ctx, p.PostId)
+	s.Require().NoError(err)
+	s.Require().Empty(revisions)
+
+	_, err = s.Manager.ModifyPost(ctx, p.PostId, usr, "v2")
+	s.Require().NoError(err)
+	updated, err := s.Manager.ModifyPost(ctx, p.PostId, "moderator", "v3")
+	s.Require().NoError(err)
+
+	revisions, err = s.Manager.GetPostRevisions(ctx, p.PostId)
+	s.Require().NoError(err)
+	s.Require().Len(revisions, 2)
+	s.Require().Equal(p.PostId, revisions[0].PostId)
+	s.Require().Equal("v2", revisions[0].Text)
+	s.Require().Equal("moderator", revisions[0].EditorId)
+	s.Require().True(updated.LastModifiedAt.Equal(revisions[0].EditedAt))
+	s.Require().Equal("v1", revisions[1].Text)
+	s.Require().Equal(usr, revisions[1].EditorId)
+	s.Require().False(revisions[0].EditedAt.Before(revisions[1].EditedAt))
+
+	s.Require().NoError(s.Manager.DeletePost(ctx, p.PostId))
+	_, err = s.Manager.GetPostRevisions(ctx, p.PostId)
+	s.Require().ErrorIs(err, microblog.ErrNotFound)
+}
+
+func (s *ManagerSuite) TestAddPostConcurrently() {
+	const writers, postsPerWriter = 8, 5
+	var wg sync.WaitGroup
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range postsPerWriter {
+				_, _ = s.Manager.AddPost(ctx, "alice", fmt.Sprintf("writer %d post %d", i, j))
+			}
+		}()
+	}
+	wg.Wait()
+
+	posts := collectPages(s, func(token string, size uint8) ([]microblog.UserPost, string, error) {
+		return s.Manager.GetPostsInPage(ctx, "alice", token, size)
+	}, 7)
+	s.Require().Len(posts, writers*postsPerWriter)
+	ids := postIds(posts)
+	slices.Sort(ids)
+	s.Require().Len(slices.Compact(ids), writers*postsPerWriter, "post IDs are not unique")
+	s.requireNewestFirst(posts)
+}
+
+func (s *ManagerSuite) TestLikePostConcurrently() {
+	p := s.addPost("bob", "like me")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(user string) {
+			defer wg.Done()
+			// every user likes twice, only the first like counts
+			_, _ = s.Manager.LikePost(ctx, p.PostId, user)
+			_, _ = s.Manager.LikePost(ctx, p.PostId, user)
+		}(fmt.Sprintf("user%d", i))
+	}
+	wg.Wait()
+
+	fetched, err := s.Manager.GetPost(ctx, p.PostId)
+	s.Require().NoError(err)
+	s.Require().EqualValues(20, fetched.LikesCount)
+
+	updated, err := s.Manager.UnlikePost(ctx, p.PostId, "user0")
+	s.Require().NoError(err)
+	s.Require().EqualValues(19, updated.LikesCount)
+	updated, err = s.Manager.UnlikePost(ctx, p.PostId, "user0")
+	s.Require().NoError(err)
+	s.Require().EqualValues(19, updated.LikesCount)
+}
+
+func (s *ManagerSuite) TestRepostConcurrently() {
+	original := s.addPost("bob", "share me")
+
+	reposts := make([]microblog.UserPost, 10)
+	var wg sync.WaitGroup
+	for i := range reposts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reposts[i], _ = s.Manager.Repost(ctx, "alice", original.PostId, "")
+		}()
+	}
+	wg.Wait()
+
+	for _, repost := range reposts {
+		s.Require().Equal(reposts[0].PostId, repost.PostId, "a repeated repost created a new post")
+	}
+	fetched, err := s.Manager.GetPost(ctx, original.PostId)
+	s.Require().NoError(err)
+	s.Require().EqualValues(1, fetched.RepostsCount)
+}
+
+func (s *ManagerSuite) TestSubscribeConcurrently() {
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = s.Manager.Subscribe(ctx, "alice", "bob")
+		}()
+	}
+	wg.Wait()
+
+	followers, _, err := s.Manager.GetFollowers(ctx, "bob", "", 10)
+	s.Require().NoError(err)
+	s.Require().Equal([]string{"alice"}, followers)
+}
+
+func (s *ManagerSuite) TestReplies() {
+	root := s.addPost("bob", "root")
+	first, err := s.Manager.AddReply(ctx, "alice", root.PostId, "first")
+	s.Require().NoError(err)
+	nested, err := s.Manager.AddReply(ctx, "bob", first.PostId, "nested")
+	s.Require().NoError(err)
+	second, err := s.Manager.AddReply(ctx, "carol", root.PostId, "second")
+	s.Require().NoError(err)
+	s.Require().Equal(root.PostId, first.RootId)
+	s.Require().Equal(root.PostId, nested.RootId)
+	s.Require().Equal(first.PostId, nested.InReplyTo)
+
+	replies, token, err := s.Manager.GetRepliesInPage(ctx, root.PostId, "", 10)
+	s.Require().NoError(err)
+	s.Require().Equal([]string{second.PostId, first.PostId}, postIds(replies))
+	s.Require().Empty(token)
+
+	thread, err := s.Manager.GetThread(ctx, nested.PostId)
+	s.Require().NoError(err)
+	s.Require().Equal([]string{root.PostId, first.PostId, nested.PostId}, postIds(thread))
+
+	// the thread is cut at the deleted post
+	s.Require().NoError(s.Manager.DeletePost(ctx, first.PostId))
+	thread, err = s.Manager.GetThread(ctx, nested.PostId)
+	s.Require().NoError(err)
+	s.Require().Equal([]string{nested.PostId}, postIds(thread))
+	replies, _, err = s.Manager.GetRepliesInPage(ctx, root.PostId, "", 10)
+	s.Require().NoError(err)
+	s.Require().Equal([]string{second.PostId}, postIds(replies))
+}
+
+func (s *ManagerSuite) TestRepost() {
+	original := s.addPost("bob", "original")
+
+	repost, err := s.Manager.Repost(ctx, "alice", original.PostId, "")
+	s.Require().NoError(err)
+	s.Require().Equal(microblog.Repost, repost.Kind)
+	s.Require().Equal(original.PostId, repost.RepostOf)
+	again, err := s.Manager.Repost(ctx, "alice", repost.PostId, "")
+	s.Require().NoError(err)
+	s.Require().Equal(repost.PostId, again.PostId)
+
+	quote, err := s.Manager.Repost(ctx, "alice", original.PostId, "so true")
+	s.Require().NoError(err)
+	s.Require().Equal(microblog.QuotePost, quote.Kind)
+	s.Require().Equal("so true", quote.Text)
+
+	fetched, err := s.Manager.GetPost(ctx, original.PostId)
+	s.Require().NoError(err)
+	s.Require().EqualValues(2, fetched.RepostsCount)
+
+	posts, _, err := s.Manager.GetPostsInPage(ctx, "alice", "", 10)
+	s.Require().NoError(err)
+	s.Require().Equal([]string{quote.PostId, repost.PostId}, postIds(posts))
+
+	s.Require().NoError(s.Manager.DeletePost(ctx, quote.PostId))
+	fetched, err = s.Manager.GetPost(ctx, original.PostId)
+	s.Require().NoError(err)
+	s.Require().EqualValues(1, fetched.RepostsCount)
+}
+
+func (s *ManagerSuite) TestGetTagPostsInPage() {
+	first := s.addPost("alice", "#Go is fun")
+	s.Require().Equal([]string{"go"}, first.Tags)
+	second := s.addPost("bob", "#go #mongo")
+
+	posts, token, err := s.Manager.GetTagPostsInPage(ctx, "go", "", 1)
+	s.Require().NoError(err)
+	s.Require().Equal([]string{second.PostId}, postIds(posts))
+	posts, token, err = s.Manager.GetTagPostsInPage(ctx, "go", token, 1)
+	s.Require().NoError(err)
+	s.Require().Equal([]string{first.PostId}, postIds(posts))
+	s.Require().Empty(token)
+
+	_, err = s.Manager.ModifyPost(ctx, second.PostId, "bob", "just #mongo")
+	s.Require().NoError(err)
+	posts, _, err = s.Manager.GetTagPostsInPage(ctx, "#GO", "", 10)
+	s.Require().NoError(err)
+	s.Require().Equal([]string{first.PostId}, postIds(posts))
+}
+
+func (s *ManagerSuite) TestGetMentionsInPage() {
+	first := s.addPost("alice", "hi @b0b")
+	s.Require().Equal([]string{"b0b"}, first.Mentions)
+	second := s.addPost("carol", "@b0b and @ca7")
+
+	posts, token, err := s.Manager.GetMentionsInPage(ctx, "b0b", "", 1)
+	s.Require().NoError(err)
+	s.Require().Equal([]string{second.PostId}, postIds(posts))
+	posts, token, err = s.Manager.GetMentionsInPage(ctx, "b0b", token, 1)
+	s.Require().NoError(err)
+	s.Require().Equal([]string{first.PostId}, postIds(posts))
+	s.Require().Empty(token)
+
+	_, err = s.Manager.ModifyPost(ctx, second.PostId, "carol", "just @ca7")
+	s.Require().NoError(err)
+	posts, _, err = s.Manager.GetMentionsInPage(ctx, "b0b", "", 10)
+	s.Require().NoError(err)
+	s.Require().Equal([]string{first.PostId}, postIds(posts))
+}
+
+func (s *ManagerSuite) TestSearchPosts() {
+	first := s.addPost("alice", "zebras and giraffes")
+	second := s.addPost("bob", "zebras, zebras everywhere")
+	s.addPost("bob", "giraffes only")
+
+	query, err := microblog.ParseSearchQuery("zebras")
+	s.Require().NoError(err)
+	posts, token, err := s.Manager.SearchPosts(ctx, query, "", 1)
+	s.Require().NoError(err)
+	s.Require().Equal([]string{second.PostId}, postIds(posts))
+	posts, token, err = s.Manager.SearchPosts(ctx, query, token, 1)
+	s.Require().NoError(err)
+	s.Require().Equal([]string{first.PostId}, postIds(posts))
+	s.Require().Empty(token)
+
+	query, err = microblog.ParseSearchQuery(`"zebras and giraffes"`)
+	s.Require().NoError(err)
+	posts, _, err = s.Manager.SearchPosts(ctx, query, "", 10)
+	s.Require().NoError(err)
+	s.Require().Equal([]string{first.PostId}, postIds(posts))
+
+	query, err = microblog.ParseSearchQuery("giraffes author:b0b")
+	s.Require().NoError(err)
+	posts, _, err = s.Manager.SearchPosts(ctx, query, "", 10)
+	s.Require().NoError(err)
+	s.Require().Empty(posts)
+}
@@ -5,6 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"micro-blog/microblog"
+	"micro-blog/microblog/idgen"
+	"slices"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -13,19 +16,79 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-const collName = "posts"
+const (
+	collName          = "posts"
+	subscriptionsName = "subscriptions"
+	revisionsName     = "post_revisions"
+	likesName         = "likes"
+)
 
 type MongoManager struct {
-	posts  *mongo.Collection
-	client *mongo.Client
+	posts         *mongo.Collection
+	subscriptions *mongo.Collection
+	revisions     *mongo.Collection
+	likes         *mongo.Collection
+	client        *mongo.Client
 }
 
-func ensureIndexes(ctx context.Context, collection *mongo.Collection) {
-	indexModels := []mongo.IndexModel{
-		{
-			Keys: bson.D{{Key: "author_id", Value: 1}, {Key: "_id", Value: -1}},
-		},
-	}
+type subscription struct {
+	FollowerId string    `bson:"follower_id"`
+	FolloweeId string    `bson:"followee_id"`
+	CreatedAt  time.Time `bson:"created_at"`
+}
+
+var postIndexes = []mongo.IndexModel{
+	{
+		Keys: bson.D{{Key: "author_id", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}},
+	},
+	{
+		Keys: bson.D{{Key: "in_reply_to", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}},
+	},
+	{
+		// multikey index, as tags is an array
+		Keys: bson.D{{Key: "tags", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}},
+	},
+	{
+		Keys: bson.D{{Key: "mentions", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}},
+	},
+	{
+		// no stemming and stop words, like in the other backends
+		Keys:    bson.D{{Key: "text", Value: "text"}},
+		Options: options.Index().SetDefaultLanguage("none"),
+	},
+	{
+		// a user can repost a post without a quote only once
+		Keys: bson.D{{Key: "repost_of", Value: 1}, {Key: "author_id", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"kind": microblog.Repost}),
+	},
+}
+
+var subscriptionIndexes = []mongo.IndexModel{
+	{
+		Keys:    bson.D{{Key: "follower_id", Value: 1}, {Key: "followee_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	},
+	{
+		Keys: bson.D{{Key: "followee_id", Value: 1}, {Key: "follower_id", Value: 1}},
+	},
+}
+
+var revisionIndexes = []mongo.IndexModel{
+	{
+		Keys: bson.D{{Key: "post_id", Value: 1}, {Key: "edited_at", Value: -1}},
+	},
+}
+
+var likeIndexes = []mongo.IndexModel{
+	{
+		Keys:    bson.D{{Key: "post_id", Value: 1}, {Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	},
+}
+
+func ensureIndexes(ctx context.Context, collection *mongo.Collection, indexModels []mongo.IndexModel) {
 	opts := options.CreateIndexes().SetMaxTime(10 * time.Second)
 
 	_, err := collection.Indexes().CreateMany(ctx, indexModels, opts)
@@ -34,6 +97,53 @@ func ensureIndexes(ctx context.Context, collection *mongo.Collection) {
 	}
 }
 
+// repostIndexName is the name Mongo gives to the unique index of reposts.
+const repostIndexName = "repost_of_1_author_id_1"
+
+// migrateObjectIds rewrites the posts stored before the IDs were generated by idgen, whose _id is an ObjectID,
+// to use its hex as the ID. The hex is the ID the API exposed for them, so their links, page tokens and the
+// references of replies, reposts, revisions and likes stay valid. A post is copied before the original is
+// deleted, so an interrupted migration resumes on the next start. The unique index of reposts is violated
+// while both copies of a repost exist, so it is dropped, to be recreated along with the other indexes.
+func migrateObjectIds(ctx context.Context, posts *mongo.Collection) error {
+	legacy := bson.M{"_id": bson.M{"$type": "objectId"}}
+	count, err := posts.CountDocuments(ctx, legacy)
+	if err != nil || count == 0 {
+		return err
+	}
+	var cmdErr mongo.CommandError
+	// 27 is the IndexNotFound error code
+	if _, err := posts.Indexes().DropOne(ctx, repostIndexName); err != nil && !(errors.As(err, &cmdErr) && cmdErr.Code == 27) {
+		return err
+	}
+
+	cursor, err := posts.Find(ctx, legacy)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var doc bson.D
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		var oid primitive.ObjectID
+		for i := range doc {
+			if doc[i].Key == "_id" {
+				oid = doc[i].Value.(primitive.ObjectID)
+				doc[i].Value = oid.Hex()
+			}
+		}
+		if _, err := posts.InsertOne(ctx, doc); err != nil && !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+		if _, err := posts.DeleteOne(ctx, bson.M{"_id": oid}); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
 func NewMongoManager(mongoURL string, dbName string) *MongoManager {
 	ctx := context.Background()
 	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURL))
@@ -42,11 +152,23 @@ func NewMongoManager(mongoURL string, dbName string) *MongoManager {
 	}
 
 	collection := client.Database(dbName).Collection(collName)
-	ensureIndexes(ctx, collection)
+	if err := migrateObjectIds(ctx, collection); err != nil {
+		panic(fmt.Errorf("failed to migrate post IDs %w", err))
+	}
+	ensureIndexes(ctx, collection, postIndexes)
+	subscriptions := client.Database(dbName).Collection(subscriptionsName)
+	ensureIndexes(ctx, subscriptions, subscriptionIndexes)
+	revisions := client.Database(dbName).Collection(revisionsName)
+	ensureIndexes(ctx, revisions, revisionIndexes)
+	likes := client.Database(dbName).Collection(likesName)
+	ensureIndexes(ctx, likes, likeIndexes)
 
 	return &MongoManager{
-		posts:  collection,
-		client: client,
+		posts:         collection,
+		subscriptions: subscriptions,
+		revisions:     revisions,
+		likes:         likes,
+		client:        client,
 	}
 }
 
@@ -59,92 +181,546 @@ func (m *MongoManager) IsReady(ctx context.Context) bool {
 }
 
 func (m *MongoManager) AddPost(ctx context.Context, userId string, text string) (microblog.UserPost, error) {
-	usrPost := microblog.UserPost{AuthorId: userId, Text: text, CreatedAt: time.Now()}
-	res, err := m.posts.InsertOne(ctx, usrPost)
+	return m.insertPost(ctx, microblog.UserPost{AuthorId: userId, Text: text})
+}
+
+func (m *MongoManager) AddReply(ctx context.Context, userId string, inReplyTo string, text string) (microblog.UserPost, error) {
+	parent, err := m.GetPost(ctx, inReplyTo)
 	if err != nil {
-		return microblog.UserPost{}, fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
+		return microblog.UserPost{}, err
 	}
-	id := res.InsertedID.(primitive.ObjectID)
-	err = m.posts.FindOne(ctx, bson.M{"_id": id}).Decode(&usrPost)
-	usrPost.PostId = id.Hex()
-	if errors.Is(err, mongo.ErrNoDocuments) {
-		return microblog.UserPost{}, microblog.ErrNotFound
+	return m.insertPost(ctx, microblog.UserPost{
+		AuthorId:  userId,
+		Text:      text,
+		InReplyTo: parent.PostId,
+		RootId:    parent.ThreadRootId(),
+	})
+}
+
+// now returns the current time with the precision of BSON dates, so that the returned posts equal the stored ones.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+// insertPost stores the post with a new ID and the current time as its creation time.
+func (m *MongoManager) insertPost(ctx context.Context, usrPost microblog.UserPost) (microblog.UserPost, error) {
+	usrPost.PostId = idgen.NewID()
+	usrPost.CreatedAt = now()
+	usrPost.Tags = microblog.ExtractHashtags(usrPost.Text)
+	usrPost.Mentions = microblog.ExtractMentions(usrPost.Text)
+	if _, err := m.posts.InsertOne(ctx, usrPost); err != nil {
+		return microblog.UserPost{}, fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
 	}
 	return usrPost, nil
 }
 
+func (m *MongoManager) GetMentionsInPage(ctx context.Context, userId string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	return m.findPostsInPage(ctx, bson.M{"mentions": userId}, token, size)
+}
+
 func (m *MongoManager) GetPost(ctx context.Context, postID string) (microblog.UserPost, error) {
 	var resPost microblog.UserPost
-	objID, _ := primitive.ObjectIDFromHex(postID)
 	err := m.posts.FindOne(
-		ctx, bson.M{"_id": objID},
+		ctx, bson.M{"_id": postID},
 	).Decode(&resPost)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return resPost, microblog.ErrNotFound
+	}
 	if err != nil {
-		return resPost, err
+		return resPost, fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
 	}
-	resPost.PostId = objID.Hex()
 	return resPost, nil
 }
 
 func (m *MongoManager) GetPostsInPage(ctx context.Context, userId string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	return m.findPostsInPage(ctx, bson.M{"author_id": userId}, token, size)
+}
+
+func (m *MongoManager) GetFeedInPage(ctx context.Context, userId string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	followees, err := m.allFollowees(ctx, userId)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(followees) == 0 {
+		return nil, "", nil
+	}
+	return m.findPostsInPage(ctx, bson.M{"author_id": bson.M{"$in": followees}}, token, size)
+}
+
+func (m *MongoManager) GetRepliesInPage(ctx context.Context, postID string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	if _, err := m.GetPost(ctx, postID); err != nil {
+		return nil, "", err
+	}
+	return m.findPostsInPage(ctx, bson.M{"in_reply_to": postID}, token, size)
+}
+
+func (m *MongoManager) GetTagPostsInPage(ctx context.Context, tag string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	return m.findPostsInPage(ctx, bson.M{"tags": microblog.NormalizeHashtag(tag)}, token, size)
+}
+
+// SearchPosts ranks the posts by the relevance score of the text index.
+// Unlike the other backends, MongoDB matches phrases as substrings of the text.
+func (m *MongoManager) SearchPosts(ctx context.Context, query microblog.SearchQuery, token string, size uint8) ([]microblog.UserPost, string, error) {
+	match := bson.M{"$text": bson.M{"$search": textSearchString(query)}}
+	if query.AuthorId != "" {
+		match["author_id"] = query.AuthorId
+	}
+	createdAt := bson.M{}
+	if !query.Before.IsZero() {
+		createdAt["$lt"] = query.Before
+	}
+	if !query.After.IsZero() {
+		createdAt["$gte"] = query.After
+	}
+	if len(createdAt) > 0 {
+		match["created_at"] = createdAt
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$addFields", Value: bson.M{"score": bson.M{"$meta": "textScore"}}}},
+	}
+	if token != "" {
+		score, postId, err := microblog.DecodeSearchCursor(token)
+		if err != nil {
+			return nil, "", err
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"$or": bson.A{
+			bson.M{"score": bson.M{"$lt": score}},
+			bson.M{"score": score, "_id": bson.M{"$lt": postId}},
+		}}}})
+	}
+	pipeline = append(pipeline,
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "score", Value: -1}, {Key: "_id", Value: -1}}}},
+		bson.D{{Key: "$limit", Value: int64(size) + 1}},
+	)
+
+	cursor, err := m.posts.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, "", fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
+	}
+	defer cursor.Close(ctx)
 
 	var posts []microblog.UserPost
-	var filter bson.M
+	var scores []float64
+	for cursor.Next(ctx) {
+		post, err := decodePost(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		posts = append(posts, post)
+		scores = append(scores, cursor.Current.Lookup("score").Double())
+	}
+	if len(posts) <= int(size) {
+		return posts, "", nil
+	}
+	posts = posts[:size]
+	if size == 0 {
+		return posts, "", nil
+	}
+	return posts, microblog.EncodeSearchCursor(scores[size-1], posts[size-1].PostId), nil
+}
+
+// textSearchString builds the $search string of the query: the terms are matched as words,
+// and every quoted phrase is required.
+func textSearchString(query microblog.SearchQuery) string {
+	parts := slices.Clone(query.Terms)
+	for _, phrase := range query.Phrases {
+		parts = append(parts, `"`+strings.Join(phrase, " ")+`"`)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (m *MongoManager) GetThread(ctx context.Context, postID string) ([]microblog.UserPost, error) {
+	post, err := m.GetPost(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+	thread := []microblog.UserPost{post}
+	for post.InReplyTo != "" {
+		post, err = m.GetPost(ctx, post.InReplyTo)
+		if errors.Is(err, microblog.ErrNotFound) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		thread = append(thread, post)
+	}
+	slices.Reverse(thread)
+	return thread, nil
+}
+
+// findPostsInPage returns up to size posts matching the filter, newest first.
+// The token holds the creation time and ID of the last post of the previous page, so the keyset
+// (created_at, _id) is used to continue; it stays valid even if that post is deleted.
+func (m *MongoManager) findPostsInPage(ctx context.Context, filter bson.M, token string, size uint8) ([]microblog.UserPost, string, error) {
 	if token != "" {
-		objID, _ := primitive.ObjectIDFromHex(token)
-		filter = bson.M{"author_id": userId, "_id": bson.M{"$lt": objID}}
-	} else {
-		filter = bson.M{"author_id": userId}
+		createdAt, lastPostId, err := microblog.DecodePostCursor(token)
+		if err != nil {
+			return nil, "", err
+		}
+		filter["$or"] = bson.A{
+			bson.M{"created_at": bson.M{"$lt": createdAt}},
+			bson.M{"created_at": createdAt, "_id": bson.M{"$lt": lastPostId}},
+		}
 	}
 	cursor, err := m.posts.Find(
 		ctx,
 		filter,
-		options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}),
-		options.Find().SetLimit(int64(size)),
+		options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+			SetLimit(int64(size)+1),
 	)
 	if err != nil {
-		return posts, "", err
+		return nil, "", fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
 	}
 	defer cursor.Close(ctx)
+
+	var posts []microblog.UserPost
 	for cursor.Next(ctx) {
-		var resPost microblog.UserPost
-		err = cursor.Decode(&resPost)
+		post, err := decodePost(cursor)
 		if err != nil {
-			return posts, "", err
+			return nil, "", err
 		}
+		posts = append(posts, post)
+	}
+	if len(posts) <= int(size) {
+		return posts, "", nil
+	}
+	posts = posts[:size]
+	if size == 0 {
+		return posts, "", nil
+	}
+	last := posts[len(posts)-1]
+	return posts, microblog.EncodePostCursor(last.CreatedAt, last.PostId), nil
+}
 
-		var doc bson.M
-		err = cursor.Decode(&doc)
-		if err != nil {
-			return posts, "", err
+// allFollowees returns the IDs of every user userId is subscribed to.
+func (m *MongoManager) allFollowees(ctx context.Context, userId string) ([]string, error) {
+	cursor, err := m.subscriptions.Find(
+		ctx,
+		bson.M{"follower_id": userId},
+		options.Find().SetProjection(bson.M{"followee_id": 1}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
+	}
+	defer cursor.Close(ctx)
+
+	var followees []string
+	for cursor.Next(ctx) {
+		var sub subscription
+		if err = cursor.Decode(&sub); err != nil {
+			return nil, fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
 		}
-		id := doc["_id"].(primitive.ObjectID)
-		resPost.PostId = id.Hex()
-		posts = append(posts, resPost)
+		followees = append(followees, sub.FolloweeId)
 	}
+	return followees, nil
+}
 
-	return posts, posts[len(posts)-1].PostId, nil
+// decodePost decodes the current document of the cursor.
+func decodePost(cursor *mongo.Cursor) (microblog.UserPost, error) {
+	var post microblog.UserPost
+	if err := cursor.Decode(&post); err != nil {
+		return microblog.UserPost{}, fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
+	}
+	return post, nil
 }
 
-func (m *MongoManager) ModifyPost(ctx context.Context, postID string, text string) (microblog.UserPost, error) {
-	var updated microblog.UserPost
-	objID, _ := primitive.ObjectIDFromHex(postID)
+func (m *MongoManager) DeletePost(ctx context.Context, postID string) error {
+	var deleted microblog.UserPost
+	err := m.posts.FindOneAndDelete(ctx, bson.M{"_id": postID}).Decode(&deleted)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return microblog.ErrNotFound
+		}
+		return fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
+	}
+	if deleted.RepostOf != "" {
+		if _, err = m.incCounter(ctx, deleted.RepostOf, "reposts_count", -1); err != nil && !errors.Is(err, microblog.ErrNotFound) {
+			return err
+		}
+	}
+	_, err = m.revisions.DeleteMany(ctx, bson.M{"post_id": postID})
+	if err != nil {
+		return fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
+	}
+	_, err = m.likes.DeleteMany(ctx, bson.M{"post_id": postID})
+	if err != nil {
+		return fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
+	}
+	return nil
+}
+
+// ModifyPost records the current text as a revision before replacing it, so a failed insert leaves the post
+// untouched. The text is replaced only if it is still the recorded one; otherwise the revision is dropped and the
+// modification is retried against the newer text.
+func (m *MongoManager) ModifyPost(ctx context.Context, postID string, editorId string, text string) (microblog.UserPost, error) {
+	tags := microblog.ExtractHashtags(text)
+	mentions := microblog.ExtractMentions(text)
+	for {
+		var previous microblog.UserPost
+		err := m.posts.FindOne(ctx, bson.M{"_id": postID}).Decode(&previous)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return microblog.UserPost{}, microblog.ErrNotFound
+			}
+			return microblog.UserPost{}, fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
+		}
+		modifyTime := now()
+		revision := microblog.PostRevision{PostId: postID, Text: previous.Text, EditorId: editorId, EditedAt: modifyTime}
+		inserted, err := m.revisions.InsertOne(ctx, revision)
+		if err != nil {
+			return microblog.UserPost{}, fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
+		}
+		update := bson.M{
+			"$set": bson.M{
+				"text":             text,
+				"tags":             tags,
+				"mentions":         mentions,
+				"last_modified_at": modifyTime,
+			},
+		}
+		res, err := m.posts.UpdateOne(ctx, bson.M{"_id": postID, "text": previous.Text}, update)
+		if err == nil && res.MatchedCount == 1 {
+			updated := previous
+			updated.Text = text
+			updated.Tags = tags
+			updated.Mentions = mentions
+			updated.LastModifiedAt = modifyTime
+			return updated, nil
+		}
+		// The post was modified or deleted meanwhile, or not modified at all: the revision records nothing.
+		_, _ = m.revisions.DeleteOne(ctx, bson.M{"_id": inserted.InsertedID})
+		if err != nil {
+			return microblog.UserPost{}, fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
+		}
+	}
+}
 
+func (m *MongoManager) GetPostRevisions(ctx context.Context, postID string) ([]microblog.PostRevision, error) {
+	if _, err := m.GetPost(ctx, postID); err != nil {
+		return nil, err
+	}
+	cursor, err := m.revisions.Find(
+		ctx,
+		bson.M{"post_id": postID},
+		options.Find().SetSort(bson.D{{Key: "edited_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
+	}
+	defer cursor.Close(ctx)
+
+	var revisions []microblog.PostRevision
+	if err = cursor.All(ctx, &revisions); err != nil {
+		return nil, fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
+	}
+	return revisions, nil
+}
+
+func (m *MongoManager) Subscribe(ctx context.Context, userId string, targetId string) error {
+	if userId == targetId {
+		return microblog.ErrSelfSubscription
+	}
+	filter := bson.M{"follower_id": userId, "followee_id": targetId}
 	update := bson.M{
-		"$set": bson.M{
-			"text":             text,
-			"last_modified_at": time.Now(),
-		},
+		"$setOnInsert": subscription{FollowerId: userId, FolloweeId: targetId, CreatedAt: time.Now()},
+	}
+	_, err := m.subscriptions.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
+	}
+	return nil
+}
+
+func (m *MongoManager) Unsubscribe(ctx context.Context, userId string, targetId string) error {
+	if userId == targetId {
+		return microblog.ErrSelfSubscription
+	}
+	_, err := m.subscriptions.DeleteOne(ctx, bson.M{"follower_id": userId, "followee_id": targetId})
+	if err != nil {
+		return fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
+	}
+	return nil
+}
+
+func (m *MongoManager) GetFollowers(ctx context.Context, userId string, token string, size uint8) ([]string, string, error) {
+	return m.usersInPage(ctx, "followee_id", userId, "follower_id", token, size)
+}
+
+func (m *MongoManager) GetFollowees(ctx context.Context, userId string, token string, size uint8) ([]string, string, error) {
+	return m.usersInPage(ctx, "follower_id", userId, "followee_id", token, size)
+}
+
+// usersInPage pages through the subscriptions matching userId on the byField side,
+// returning the opposite side (userField) in ascending order. The token points to the
+// last user ID of the previous page.
+func (m *MongoManager) usersInPage(ctx context.Context, byField string, userId string, userField string, token string, size uint8) ([]string, string, error) {
+	filter := bson.M{byField: userId}
+	if token != "" {
+		lastUserId, err := microblog.DecodeUserCursor(token)
+		if err != nil {
+			return nil, "", err
+		}
+		filter[userField] = bson.M{"$gt": lastUserId}
+	}
+	cursor, err := m.subscriptions.Find(
+		ctx,
+		filter,
+		options.Find().
+			SetSort(bson.D{{Key: userField, Value: 1}}).
+			SetLimit(int64(size)+1),
+	)
+	if err != nil {
+		return nil, "", fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
+	}
+	defer cursor.Close(ctx)
+
+	var users []string
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err = cursor.Decode(&doc); err != nil {
+			return nil, "", fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
+		}
+		users = append(users, doc[userField].(string))
+	}
+	if len(users) <= int(size) {
+		return users, "", nil
+	}
+	users = users[:size]
+	if size == 0 {
+		return users, "", nil
+	}
+	return users, microblog.EncodeUserCursor(users[len(users)-1]), nil
+}
+
+// LikePost stores the like in a separate collection, which has a unique index per post and user,
+// and derives the counter from that collection, so a counter left behind by a failed update is corrected.
+func (m *MongoManager) LikePost(ctx context.Context, postID string, userId string) (microblog.UserPost, error) {
+	if _, err := m.GetPost(ctx, postID); err != nil {
+		return microblog.UserPost{}, err
+	}
+	_, err := m.likes.InsertOne(ctx, bson.M{"post_id": postID, "user_id": userId, "created_at": time.Now()})
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return microblog.UserPost{}, fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
+	}
+	return m.syncLikesCount(ctx, postID)
+}
+
+// UnlikePost removes the like and derives the counter from the remaining likes.
+func (m *MongoManager) UnlikePost(ctx context.Context, postID string, userId string) (microblog.UserPost, error) {
+	if _, err := m.GetPost(ctx, postID); err != nil {
+		return microblog.UserPost{}, err
+	}
+	if _, err := m.likes.DeleteOne(ctx, bson.M{"post_id": postID, "user_id": userId}); err != nil {
+		return microblog.UserPost{}, fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
 	}
+	return m.syncLikesCount(ctx, postID)
+}
+
+// syncLikesCount sets the counter of the post to the number of its likes. The likes are counted after the version
+// of the counter is read and the counter is set only if that version is still current, so a count taken before a
+// concurrent like or unlike never overwrites a newer one.
+func (m *MongoManager) syncLikesCount(ctx context.Context, postID string) (microblog.UserPost, error) {
+	for {
+		var current struct {
+			Version int64 `bson:"likes_version"`
+		}
+		opts := options.FindOne().SetProjection(bson.M{"likes_version": 1})
+		err := m.posts.FindOne(ctx, bson.M{"_id": postID}, opts).Decode(&current)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return microblog.UserPost{}, microblog.ErrNotFound
+			}
+			return microblog.UserPost{}, fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
+		}
+		count, err := m.likes.CountDocuments(ctx, bson.M{"post_id": postID})
+		if err != nil {
+			return microblog.UserPost{}, fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
+		}
+
+		filter := bson.M{"_id": postID, "likes_version": current.Version}
+		if current.Version == 0 {
+			// posts stored before the version was introduced have none
+			filter["likes_version"] = bson.M{"$in": bson.A{0, nil}}
+		}
+		update := bson.M{"$set": bson.M{"likes_count": count}, "$inc": bson.M{"likes_version": 1}}
+		var updated microblog.UserPost
+		err = m.posts.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).
+			Decode(&updated)
+		if err == nil {
+			return updated, nil
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return microblog.UserPost{}, fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
+		}
+		// the counter was set meanwhile or the post was deleted: read it again
+	}
+}
+
+// incCounter atomically adds delta to the counter field of the post and returns the updated post.
+func (m *MongoManager) incCounter(ctx context.Context, postID string, field string, delta int64) (microblog.UserPost, error) {
+	var updated microblog.UserPost
+	update := bson.M{"$inc": bson.M{field: delta}}
 	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
 
-	err := m.posts.FindOneAndUpdate(ctx, bson.M{"_id": objID}, update, opts).Decode(&updated)
+	err := m.posts.FindOneAndUpdate(ctx, bson.M{"_id": postID}, update, opts).Decode(&updated)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return microblog.UserPost{}, microblog.ErrNotFound
 		}
 		return microblog.UserPost{}, fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
 	}
-	updated.PostId = objID.Hex()
 	return updated, nil
 }
+
+// Repost relies on the partial unique index on reposts without a quote to deduplicate concurrent reposts.
+func (m *MongoManager) Repost(ctx context.Context, userId string, postID string, quote string) (microblog.UserPost, error) {
+	original, err := m.GetPost(ctx, postID)
+	if err == nil && original.Kind == microblog.Repost {
+		original, err = m.GetPost(ctx, original.RepostOf)
+	}
+	if err != nil {
+		return microblog.UserPost{}, err
+	}
+
+	kind := microblog.QuotePost
+	if quote == "" {
+		kind = microblog.Repost
+		if existing, err := m.findRepost(ctx, userId, original.PostId); !errors.Is(err, microblog.ErrNotFound) {
+			return existing, err
+		}
+	}
+	post, err := m.insertPost(ctx, microblog.UserPost{AuthorId: userId, Text: quote, Kind: kind, RepostOf: original.PostId})
+	if err != nil {
+		if kind == microblog.Repost {
+			// a concurrent repost by the same user may have won the unique index
+			if existing, findErr := m.findRepost(ctx, userId, original.PostId); findErr == nil {
+				return existing, nil
+			}
+		}
+		return microblog.UserPost{}, err
+	}
+	if _, err = m.incCounter(ctx, original.PostId, "reposts_count", 1); err != nil && !errors.Is(err, microblog.ErrNotFound) {
+		return microblog.UserPost{}, err
+	}
+	return post, nil
+}
+
+func (m *MongoManager) findRepost(ctx context.Context, userId string, originalId string) (microblog.UserPost, error) {
+	cursor, err := m.posts.Find(
+		ctx,
+		bson.M{"repost_of": originalId, "author_id": userId, "kind": microblog.Repost},
+		options.Find().SetLimit(1),
+	)
+	if err != nil {
+		return microblog.UserPost{}, fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
+	}
+	defer cursor.Close(ctx)
+	if !cursor.Next(ctx) {
+		return microblog.UserPost{}, microblog.ErrNotFound
+	}
+	return decodePost(cursor)
+}
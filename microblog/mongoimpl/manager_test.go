@@ -2,19 +2,45 @@ package mongoimpl
 
 import (
 	"context"
-	"fmt"
 	"micro-blog/microblog"
+	"micro-blog/microblog/microblogtest"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var ctx = context.Background()
 
+const (
+	testMongoAddr   = "mongodb://localhost:27017"
+	testMongoDBName = "test"
+)
+
 func TestManager(t *testing.T) {
-	suite.Run(t, &ManagerSuite{mongoAddr: "mongodb://localhost:27017", mongodbName: "test"})
+	suite.Run(t, &ManagerSuite{mongoAddr: testMongoAddr, mongodbName: testMongoDBName})
+}
+
+func TestManagerConformance(t *testing.T) {
+	mongoClient, err := mongo.Connect(ctx, options.Client().ApplyURI(testMongoAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mongoClient.Disconnect(ctx)
+	suite.Run(t, &microblogtest.ManagerSuite{NewManager: func(t *testing.T) microblog.Manager {
+		if err := mongoClient.Database(testMongoDBName).Drop(ctx); err != nil {
+			t.Fatal(err)
+		}
+		// the manager creates the indexes of the dropped collections anew
+		manager := NewMongoManager(testMongoAddr, testMongoDBName)
+		t.Cleanup(func() { _ = manager.client.Disconnect(ctx) })
+		return manager
+	}})
 }
 
 type ManagerSuite struct {
@@ -24,12 +50,10 @@ type ManagerSuite struct {
 	mongodbName string
 	mongoClient *mongo.Client
 	mongoDB     *mongo.Database
-	manager     microblog.Manager
+	manager     *MongoManager
 }
 
 func (s *ManagerSuite) SetupSuite() {
-	s.manager = NewMongoManager(s.mongoAddr, s.mongodbName)
-
 	mongoClient, err := mongo.Connect(ctx, options.Client().ApplyURI(s.mongoAddr))
 	s.Require().NoError(err)
 	db := mongoClient.Database(s.mongodbName)
@@ -37,83 +61,125 @@ func (s *ManagerSuite) SetupSuite() {
 	s.mongoDB = db
 }
 
+func (s *ManagerSuite) TearDownSuite() {
+	_ = s.mongoClient.Disconnect(ctx)
+}
+
 func (s *ManagerSuite) SetupTest() {
 	s.Require().NoError(s.mongoClient.Database(s.mongodbName).Drop(ctx))
+	// the manager creates the indexes of the dropped collections anew
+	s.manager = NewMongoManager(s.mongoAddr, s.mongodbName)
 }
 
-//func (s *ManagerSuite) TearDownTest() {
-//	s.Require().NoError(s.mongoClient.Database(s.mongodbName).Drop(ctx))
-//}
-
-func (s *ManagerSuite) TestAddPost() {
-	usr := "broniy"
-	msg := "This is my first post"
-	p, err := s.manager.AddPost(ctx, usr, msg)
-	s.Require().Equal(usr, p.AuthorId)
-	s.Require().Equal(msg, p.Text)
-	s.Require().NoError(err)
+func (s *ManagerSuite) TearDownTest() {
+	_ = s.manager.client.Disconnect(ctx)
 }
 
-func (s *ManagerSuite) addNPosts(usrName string, n int) {
-	for i := 1; i <= 10; i++ {
-		msg := fmt.Sprintf("This is post number %d", i)
-		_, err := s.manager.AddPost(ctx, usrName, msg)
-		s.Require().NoError(err)
+func (s *ManagerSuite) TestMigratesObjectIds() {
+	posts := s.mongoDB.Collection(collName)
+	createdAt := time.Now().UTC().Truncate(time.Millisecond)
+	rootId, replyId, repostId := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	reply := bson.M{
+		"text": "legacy reply", "author_id": "alice", "created_at": createdAt.Add(-time.Second),
+		"in_reply_to": rootId.Hex(), "root_id": rootId.Hex(), "likes_count": 0, "reposts_count": 0,
 	}
-}
+	_, err := posts.InsertMany(ctx, []any{
+		bson.M{
+			"_id": rootId, "text": "legacy", "author_id": "bob", "created_at": createdAt.Add(-2 * time.Second),
+			"likes_count": 1, "reposts_count": 1,
+		},
+		bson.M{
+			"_id": repostId, "text": "", "author_id": "carol", "created_at": createdAt,
+			"kind": microblog.Repost, "repost_of": rootId.Hex(), "likes_count": 0, "reposts_count": 0,
+		},
+		withId(reply, replyId),
+		// the copy of a post left by an interrupted migration
+		withId(reply, replyId.Hex()),
+	})
+	s.Require().NoError(err)
+	_, err = s.mongoDB.Collection(likesName).InsertOne(ctx, bson.M{"post_id": rootId.Hex(), "user_id": "alice", "created_at": createdAt})
+	s.Require().NoError(err)
 
-func (s *ManagerSuite) TestGetPost() {
-	usr := "broniy"
-	s.addNPosts(usr, 10)
+	// the manager of the test started before the legacy posts were stored
+	manager := NewMongoManager(s.mongoAddr, s.mongodbName)
+	defer manager.client.Disconnect(ctx)
+	legacy, err := posts.CountDocuments(ctx, bson.M{"_id": bson.M{"$type": "objectId"}})
+	s.Require().NoError(err)
+	s.Require().Zero(legacy)
 
-	post, err := s.manager.GetPost(ctx, usr)
+	root, err := manager.GetPost(ctx, rootId.Hex())
 	s.Require().NoError(err)
-	s.Require().Equal(usr, post.AuthorId)
-	s.Require().Equal("This is post number 10", post.Text)
-}
+	s.Require().Equal("legacy", root.Text)
+	thread, err := manager.GetThread(ctx, replyId.Hex())
+	s.Require().NoError(err)
+	s.Require().Equal([]string{rootId.Hex(), replyId.Hex()}, []string{thread[0].PostId, thread[1].PostId})
+	replies, _, err := manager.GetRepliesInPage(ctx, rootId.Hex(), "", 10)
+	s.Require().NoError(err)
+	s.Require().Len(replies, 1)
 
-func (s *ManagerSuite) TestGetPostsInPage() {
-	usr := "bobi"
-	s.addNPosts(usr, 10)
+	specs, err := posts.Indexes().ListSpecifications(ctx)
+	s.Require().NoError(err)
+	s.Require().True(slices.ContainsFunc(specs, func(spec *mongo.IndexSpecification) bool {
+		return spec.Name == repostIndexName && spec.Unique != nil && *spec.Unique
+	}))
+	again, err := manager.Repost(ctx, "carol", rootId.Hex(), "")
+	s.Require().NoError(err)
+	s.Require().Equal(repostId.Hex(), again.PostId)
+	unliked, err := manager.UnlikePost(ctx, rootId.Hex(), "alice")
+	s.Require().NoError(err)
+	s.Require().Zero(unliked.LikesCount)
+	s.Require().NoError(manager.DeletePost(ctx, repostId.Hex()))
+	root, err = manager.GetPost(ctx, rootId.Hex())
+	s.Require().NoError(err)
+	s.Require().Zero(root.RepostsCount)
 
-	token := ""
-	var posts []microblog.UserPost
-	var err error
+	s.Require().NoError(migrateObjectIds(ctx, posts))
+}
 
-	posts, token, err = s.manager.GetPostsInPage(ctx, usr, token, 5)
+func (s *ManagerSuite) TestModifyPostKeepsTextIfRevisionFails() {
+	post, err := s.manager.AddPost(ctx, "alice", "original")
 	s.Require().NoError(err)
-	s.Require().Len(posts, 5)
-	s.Require().Equal(usr, posts[0].AuthorId)
-	s.Require().Equal("This is post number 10", posts[0].Text)
-	s.Require().Equal("This is post number 6", posts[4].Text)
-
-	posts, token, err = s.manager.GetPostsInPage(ctx, usr, token, 5)
-	s.Require().Len(posts, 5)
-	s.Require().Equal(usr, posts[0].AuthorId)
-	s.Require().Equal("This is post number 5", posts[0].Text)
-	s.Require().Equal(usr, posts[4].AuthorId)
-	s.Require().Equal("This is post number 1", posts[4].Text)
+	// every revision is rejected by the validator of the collection
+	s.Require().NoError(s.mongoDB.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: revisionsName},
+		{Key: "validator", Value: bson.M{"never": bson.M{"$exists": true}}},
+	}).Err())
+
+	_, err = s.manager.ModifyPost(ctx, post.PostId, "alice", "modified")
+	s.Require().ErrorIs(err, microblog.ErrStorage)
+	post, err = s.manager.GetPost(ctx, post.PostId)
+	s.Require().NoError(err)
+	s.Require().Equal("original", post.Text)
+	revisions, err := s.manager.GetPostRevisions(ctx, post.PostId)
+	s.Require().NoError(err)
+	s.Require().Empty(revisions)
 }
 
-func (s *ManagerSuite) TestModifyPost() {
-	usr := "alice"
-	msg := "Original message"
-	p, err := s.manager.AddPost(ctx, usr, msg)
+func (s *ManagerSuite) TestLikesCountFollowsLikes() {
+	post, err := s.manager.AddPost(ctx, "alice", "liked")
 	s.Require().NoError(err)
-	s.Require().NotEmpty(p.PostId)
-	// Modify the post text
-	newText := "Updated message"
-	updated, err := s.manager.ModifyPost(ctx, p.PostId, newText)
+	// a like whose counter update failed
+	_, err = s.mongoDB.Collection(likesName).InsertOne(ctx, bson.M{"post_id": post.PostId, "user_id": "bob", "created_at": time.Now()})
 	s.Require().NoError(err)
-	s.Require().Equal(p.PostId, updated.PostId)
-	s.Require().Equal(usr, updated.AuthorId)
-	s.Require().Equal(newText, updated.Text)
-	s.Require().False(updated.LastModifiedAt.IsZero())
-	s.Require().True(updated.LastModifiedAt.After(p.CreatedAt))
 
-	// Ensure it persisted in storage by fetching it again
-	fetched, err := s.manager.GetPost(ctx, p.PostId)
+	liked, err := s.manager.LikePost(ctx, post.PostId, "carol")
+	s.Require().NoError(err)
+	s.Require().EqualValues(2, liked.LikesCount)
+	liked, err = s.manager.LikePost(ctx, post.PostId, "bob")
+	s.Require().NoError(err)
+	s.Require().EqualValues(2, liked.LikesCount)
+	unliked, err := s.manager.UnlikePost(ctx, post.PostId, "carol")
 	s.Require().NoError(err)
-	s.Require().Equal(newText, fetched.Text)
-	s.Require().False(fetched.LastModifiedAt.IsZero())
+	s.Require().EqualValues(1, unliked.LikesCount)
+	unliked, err = s.manager.UnlikePost(ctx, post.PostId, "carol")
+	s.Require().NoError(err)
+	s.Require().EqualValues(1, unliked.LikesCount)
+}
+
+func withId(doc bson.M, id any) bson.M {
+	copied := bson.M{"_id": id}
+	for key, value := range doc {
+		copied[key] = value
+	}
+	return copied
 }
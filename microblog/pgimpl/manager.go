@@ -0,0 +1,557 @@
+package pgimpl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"micro-blog/microblog"
+	"micro-blog/microblog/idgen"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// postColumns are the columns scanned by scanPost, in order.
+const postColumns = `id, author_id, text, created_at, last_modified_at, likes_count,
+	in_reply_to, root_id, kind, repost_of, reposts_count, tags, mentions`
+
+type PostgresManager struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgresManager(postgresURL string) *PostgresManager {
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, postgresURL)
+	if err != nil {
+		panic(err)
+	}
+	if err := migrate(ctx, pool); err != nil {
+		panic(err)
+	}
+	return &PostgresManager{pool: pool}
+}
+
+func (m *PostgresManager) IsReady(ctx context.Context) bool {
+	return m.pool.Ping(ctx) == nil
+}
+
+func storageError() error {
+	return fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
+}
+
+// querier is implemented by both the pool and transactions.
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// scanPost reads a row of postColumns followed by the extra columns.
+func scanPost(row pgx.Row, extra ...any) (microblog.UserPost, error) {
+	var post microblog.UserPost
+	var lastModifiedAt *time.Time
+	var inReplyTo, rootId, repostOf *string
+	dest := []any{
+		&post.PostId, &post.AuthorId, &post.Text, &post.CreatedAt, &lastModifiedAt, &post.LikesCount,
+		&inReplyTo, &rootId, &post.Kind, &repostOf, &post.RepostsCount, &post.Tags, &post.Mentions,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return microblog.UserPost{}, err
+	}
+	post.CreatedAt = post.CreatedAt.UTC()
+	if lastModifiedAt != nil {
+		post.LastModifiedAt = lastModifiedAt.UTC()
+	}
+	post.InReplyTo = deref(inReplyTo)
+	post.RootId = deref(rootId)
+	post.RepostOf = deref(repostOf)
+	if len(post.Tags) == 0 {
+		post.Tags = nil
+	}
+	if len(post.Mentions) == 0 {
+		post.Mentions = nil
+	}
+	return post, nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// nullable maps the empty string to NULL.
+func nullable(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// queryPost runs a query returning at most one row of postColumns.
+// ErrNotFound is returned if there is no row.
+func queryPost(ctx context.Context, q querier, sql string, args ...any) (microblog.UserPost, error) {
+	post, err := scanPost(q.QueryRow(ctx, sql, args...))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return microblog.UserPost{}, microblog.ErrNotFound
+	}
+	if err != nil {
+		return microblog.UserPost{}, storageError()
+	}
+	return post, nil
+}
+
+func (m *PostgresManager) AddPost(ctx context.Context, userId string, text string) (microblog.UserPost, error) {
+	return insertPost(ctx, m.pool, microblog.UserPost{AuthorId: userId, Text: text})
+}
+
+func (m *PostgresManager) AddReply(ctx context.Context, userId string, inReplyTo string, text string) (microblog.UserPost, error) {
+	parent, err := m.GetPost(ctx, inReplyTo)
+	if err != nil {
+		return microblog.UserPost{}, err
+	}
+	return insertPost(ctx, m.pool, microblog.UserPost{
+		AuthorId:  userId,
+		Text:      text,
+		InReplyTo: parent.PostId,
+		RootId:    parent.ThreadRootId(),
+	})
+}
+
+// insertPost stores the post with a new ID and the current time as its creation time.
+// The time is truncated to microseconds, the precision of Postgres timestamps.
+func insertPost(ctx context.Context, q querier, post microblog.UserPost) (microblog.UserPost, error) {
+	return queryPost(ctx, q, `
+		INSERT INTO posts (id, author_id, text, created_at, in_reply_to, root_id, kind, repost_of, tags, mentions)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING `+postColumns,
+		idgen.NewID(), post.AuthorId, post.Text, time.Now().UTC().Truncate(time.Microsecond),
+		nullable(post.InReplyTo), nullable(post.RootId), post.Kind, nullable(post.RepostOf),
+		nonNil(microblog.ExtractHashtags(post.Text)), nonNil(microblog.ExtractMentions(post.Text)),
+	)
+}
+
+// nonNil makes sure an absent list is stored as an empty array rather than NULL.
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+func (m *PostgresManager) GetPost(ctx context.Context, postID string) (microblog.UserPost, error) {
+	return queryPost(ctx, m.pool, "SELECT "+postColumns+" FROM posts WHERE id = $1", postID)
+}
+
+func (m *PostgresManager) GetPostsInPage(ctx context.Context, userId string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	return m.findPostsInPage(ctx, "author_id = $1", []any{userId}, token, size)
+}
+
+func (m *PostgresManager) GetFeedInPage(ctx context.Context, userId string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	return m.findPostsInPage(ctx, "author_id IN (SELECT followee_id FROM subscriptions WHERE follower_id = $1)", []any{userId}, token, size)
+}
+
+func (m *PostgresManager) GetRepliesInPage(ctx context.Context, postID string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	if _, err := m.GetPost(ctx, postID); err != nil {
+		return nil, "", err
+	}
+	return m.findPostsInPage(ctx, "in_reply_to = $1", []any{postID}, token, size)
+}
+
+func (m *PostgresManager) GetTagPostsInPage(ctx context.Context, tag string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	return m.findPostsInPage(ctx, "tags @> ARRAY[$1::TEXT]", []any{microblog.NormalizeHashtag(tag)}, token, size)
+}
+
+func (m *PostgresManager) GetMentionsInPage(ctx context.Context, userId string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	return m.findPostsInPage(ctx, "mentions @> ARRAY[$1::TEXT]", []any{userId}, token, size)
+}
+
+// findPostsInPage returns a page of the posts satisfying the condition in reverse-chronological order.
+// The token holds the creation time and ID of the last post of the previous page, so the keyset
+// (created_at, id) is used to continue. Posts created at the same time are ordered by ID.
+func (m *PostgresManager) findPostsInPage(ctx context.Context, condition string, args []any, token string, size uint8) ([]microblog.UserPost, string, error) {
+	if token != "" {
+		createdAt, lastPostId, err := microblog.DecodePostCursor(token)
+		if err != nil {
+			return nil, "", err
+		}
+		args = append(args, createdAt, lastPostId)
+		condition += fmt.Sprintf(" AND (created_at, id) < ($%d, $%d)", len(args)-1, len(args))
+	}
+	args = append(args, int(size)+1)
+	rows, err := m.pool.Query(ctx, fmt.Sprintf(
+		"SELECT %s FROM posts WHERE %s ORDER BY created_at DESC, id DESC LIMIT $%d",
+		postColumns, condition, len(args),
+	), args...)
+	if err != nil {
+		return nil, "", storageError()
+	}
+	posts, err := collectPosts(rows)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(posts) <= int(size) {
+		return posts, "", nil
+	}
+	posts = posts[:size]
+	if size == 0 {
+		return posts, "", nil
+	}
+	return posts, microblog.EncodePostCursor(posts[len(posts)-1].CreatedAt, posts[len(posts)-1].PostId), nil
+}
+
+func collectPosts(rows pgx.Rows) ([]microblog.UserPost, error) {
+	defer rows.Close()
+	var posts []microblog.UserPost
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, storageError()
+		}
+		posts = append(posts, post)
+	}
+	if rows.Err() != nil {
+		return nil, storageError()
+	}
+	return posts, nil
+}
+
+func (m *PostgresManager) GetThread(ctx context.Context, postID string) ([]microblog.UserPost, error) {
+	rows, err := m.pool.Query(ctx, `
+		WITH RECURSIVE thread AS (
+			SELECT `+postColumns+`, 0 AS depth FROM posts WHERE id = $1
+			UNION ALL
+			SELECT `+prefixed("p", postColumns)+`, thread.depth + 1
+			FROM posts p JOIN thread ON p.id = thread.in_reply_to
+		)
+		SELECT `+postColumns+` FROM thread ORDER BY depth DESC`,
+		postID,
+	)
+	if err != nil {
+		return nil, storageError()
+	}
+	thread, err := collectPosts(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(thread) == 0 {
+		return nil, microblog.ErrNotFound
+	}
+	return thread, nil
+}
+
+// prefixed qualifies every column of the list with the table alias.
+func prefixed(alias string, columns string) string {
+	fields := strings.Split(columns, ",")
+	for i, field := range fields {
+		fields[i] = alias + "." + strings.TrimSpace(field)
+	}
+	return strings.Join(fields, ", ")
+}
+
+func (m *PostgresManager) DeletePost(ctx context.Context, postID string) error {
+	return pgx.BeginFunc(ctx, m.pool, func(tx pgx.Tx) error {
+		var repostOf *string
+		err := tx.QueryRow(ctx, "DELETE FROM posts WHERE id = $1 RETURNING repost_of", postID).Scan(&repostOf)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return microblog.ErrNotFound
+		}
+		if err != nil {
+			return storageError()
+		}
+		// revisions and likes are removed by the cascade
+		if repostOf != nil {
+			if _, err := tx.Exec(ctx, "UPDATE posts SET reposts_count = reposts_count - 1 WHERE id = $1", *repostOf); err != nil {
+				return storageError()
+			}
+		}
+		return nil
+	})
+}
+
+func (m *PostgresManager) ModifyPost(ctx context.Context, postID string, editorId string, text string) (microblog.UserPost, error) {
+	var updated microblog.UserPost
+	err := pgx.BeginFunc(ctx, m.pool, func(tx pgx.Tx) error {
+		modifyTime := time.Now().UTC().Truncate(time.Microsecond)
+		var previous string
+		err := tx.QueryRow(ctx, "SELECT text FROM posts WHERE id = $1 FOR UPDATE", postID).Scan(&previous)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return microblog.ErrNotFound
+		}
+		if err != nil {
+			return storageError()
+		}
+		_, err = tx.Exec(ctx,
+			"INSERT INTO post_revisions (post_id, text, editor_id, edited_at) VALUES ($1, $2, $3, $4)",
+			postID, previous, editorId, modifyTime,
+		)
+		if err != nil {
+			return storageError()
+		}
+		updated, err = queryPost(ctx, tx, `
+			UPDATE posts SET text = $2, tags = $3, mentions = $4, last_modified_at = $5
+			WHERE id = $1
+			RETURNING `+postColumns,
+			postID, text, nonNil(microblog.ExtractHashtags(text)), nonNil(microblog.ExtractMentions(text)), modifyTime,
+		)
+		return err
+	})
+	return updated, err
+}
+
+func (m *PostgresManager) GetPostRevisions(ctx context.Context, postID string) ([]microblog.PostRevision, error) {
+	if _, err := m.GetPost(ctx, postID); err != nil {
+		return nil, err
+	}
+	rows, err := m.pool.Query(ctx,
+		"SELECT post_id, text, editor_id, edited_at FROM post_revisions WHERE post_id = $1 ORDER BY id DESC",
+		postID,
+	)
+	if err != nil {
+		return nil, storageError()
+	}
+	defer rows.Close()
+	var revisions []microblog.PostRevision
+	for rows.Next() {
+		var revision microblog.PostRevision
+		if err := rows.Scan(&revision.PostId, &revision.Text, &revision.EditorId, &revision.EditedAt); err != nil {
+			return nil, storageError()
+		}
+		revision.EditedAt = revision.EditedAt.UTC()
+		revisions = append(revisions, revision)
+	}
+	if rows.Err() != nil {
+		return nil, storageError()
+	}
+	return revisions, nil
+}
+
+func (m *PostgresManager) Repost(ctx context.Context, userId string, postID string, quote string) (microblog.UserPost, error) {
+	var repost microblog.UserPost
+	err := pgx.BeginFunc(ctx, m.pool, func(tx pgx.Tx) error {
+		original, err := queryPost(ctx, tx, "SELECT "+postColumns+" FROM posts WHERE id = $1", postID)
+		if err != nil {
+			return err
+		}
+		if original.Kind == microblog.Repost {
+			if original, err = queryPost(ctx, tx, "SELECT "+postColumns+" FROM posts WHERE id = $1", original.RepostOf); err != nil {
+				return err
+			}
+		}
+
+		if quote == "" {
+			repost, err = queryPost(ctx, tx, `
+				INSERT INTO posts (id, author_id, text, created_at, kind, repost_of)
+				VALUES ($1, $2, '', $3, $4, $5)
+				ON CONFLICT (repost_of, author_id) WHERE kind = 'repost' DO NOTHING
+				RETURNING `+postColumns,
+				idgen.NewID(), userId, time.Now().UTC().Truncate(time.Microsecond), microblog.Repost, original.PostId,
+			)
+			if errors.Is(err, microblog.ErrNotFound) {
+				// the post has already been reposted by the user
+				repost, err = queryPost(ctx, tx,
+					"SELECT "+postColumns+" FROM posts WHERE repost_of = $1 AND author_id = $2 AND kind = $3",
+					original.PostId, userId, microblog.Repost,
+				)
+				return err
+			}
+		} else {
+			repost, err = insertPost(ctx, tx, microblog.UserPost{
+				AuthorId: userId,
+				Text:     quote,
+				Kind:     microblog.QuotePost,
+				RepostOf: original.PostId,
+			})
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, "UPDATE posts SET reposts_count = reposts_count + 1 WHERE id = $1", original.PostId); err != nil {
+			return storageError()
+		}
+		return nil
+	})
+	return repost, err
+}
+
+// LikePost inserts the like and increments the counter in a single statement,
+// so the counter is only changed if the like did not exist.
+func (m *PostgresManager) LikePost(ctx context.Context, postID string, userId string) (microblog.UserPost, error) {
+	return queryPost(ctx, m.pool, `
+		WITH liked AS (
+			INSERT INTO likes (post_id, user_id)
+			SELECT id, $2 FROM posts WHERE id = $1
+			ON CONFLICT DO NOTHING
+			RETURNING post_id
+		)
+		UPDATE posts SET likes_count = likes_count + (SELECT count(*) FROM liked)
+		WHERE id = $1
+		RETURNING `+postColumns,
+		postID, userId,
+	)
+}
+
+func (m *PostgresManager) UnlikePost(ctx context.Context, postID string, userId string) (microblog.UserPost, error) {
+	return queryPost(ctx, m.pool, `
+		WITH unliked AS (
+			DELETE FROM likes WHERE post_id = $1 AND user_id = $2
+			RETURNING post_id
+		)
+		UPDATE posts SET likes_count = likes_count - (SELECT count(*) FROM unliked)
+		WHERE id = $1
+		RETURNING `+postColumns,
+		postID, userId,
+	)
+}
+
+func (m *PostgresManager) Subscribe(ctx context.Context, userId string, targetId string) error {
+	if userId == targetId {
+		return microblog.ErrSelfSubscription
+	}
+	_, err := m.pool.Exec(ctx,
+		"INSERT INTO subscriptions (follower_id, followee_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		userId, targetId,
+	)
+	if err != nil {
+		return storageError()
+	}
+	return nil
+}
+
+func (m *PostgresManager) Unsubscribe(ctx context.Context, userId string, targetId string) error {
+	if userId == targetId {
+		return microblog.ErrSelfSubscription
+	}
+	_, err := m.pool.Exec(ctx, "DELETE FROM subscriptions WHERE follower_id = $1 AND followee_id = $2", userId, targetId)
+	if err != nil {
+		return storageError()
+	}
+	return nil
+}
+
+func (m *PostgresManager) GetFollowers(ctx context.Context, userId string, token string, size uint8) ([]string, string, error) {
+	return m.usersInPage(ctx, "SELECT follower_id FROM subscriptions WHERE followee_id = $1 AND follower_id > $2 ORDER BY follower_id LIMIT $3", userId, token, size)
+}
+
+func (m *PostgresManager) GetFollowees(ctx context.Context, userId string, token string, size uint8) ([]string, string, error) {
+	return m.usersInPage(ctx, "SELECT followee_id FROM subscriptions WHERE follower_id = $1 AND followee_id > $2 ORDER BY followee_id LIMIT $3", userId, token, size)
+}
+
+// usersInPage runs a query listing user IDs in ascending order after the user the token points to.
+// The token of the next page points to the last returned user ID, or is empty if there are no more users.
+func (m *PostgresManager) usersInPage(ctx context.Context, sql string, userId string, token string, size uint8) ([]string, string, error) {
+	var lastUserId string
+	if token != "" {
+		var err error
+		if lastUserId, err = microblog.DecodeUserCursor(token); err != nil {
+			return nil, "", err
+		}
+	}
+	rows, err := m.pool.Query(ctx, sql, userId, lastUserId, int(size)+1)
+	if err != nil {
+		return nil, "", storageError()
+	}
+	users, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, "", storageError()
+	}
+	if len(users) <= int(size) {
+		return users, "", nil
+	}
+	users = users[:size]
+	if size == 0 {
+		return users, "", nil
+	}
+	return users, microblog.EncodeUserCursor(users[len(users)-1]), nil
+}
+
+// SearchPosts ranks the posts with ts_rank over the words of the query.
+// Words are split by the text search parser of Postgres, which may differ slightly from microblog.Tokenize.
+func (m *PostgresManager) SearchPosts(ctx context.Context, query microblog.SearchQuery, token string, size uint8) ([]microblog.UserPost, string, error) {
+	match, rank := tsQueries(query)
+	args := []any{match, rank}
+	conditions := []string{"search @@ to_tsquery('simple', $1)"}
+	if query.AuthorId != "" {
+		args = append(args, query.AuthorId)
+		conditions = append(conditions, fmt.Sprintf("author_id = $%d", len(args)))
+	}
+	if !query.Before.IsZero() {
+		args = append(args, query.Before)
+		conditions = append(conditions, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+	if !query.After.IsZero() {
+		args = append(args, query.After)
+		conditions = append(conditions, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+	after := "TRUE"
+	if token != "" {
+		score, postId, err := microblog.DecodeSearchCursor(token)
+		if err != nil {
+			return nil, "", err
+		}
+		args = append(args, float32(score), postId)
+		after = fmt.Sprintf("(rank, id) < ($%d::REAL, $%d)", len(args)-1, len(args))
+	}
+	args = append(args, int(size)+1)
+
+	rows, err := m.pool.Query(ctx, fmt.Sprintf(`
+		SELECT %s, rank FROM (
+			SELECT *, ts_rank(search, to_tsquery('simple', $2)) AS rank FROM posts WHERE %s
+		) matches
+		WHERE %s
+		ORDER BY rank DESC, id DESC
+		LIMIT $%d`,
+		postColumns, strings.Join(conditions, " AND "), after, len(args),
+	), args...)
+	if err != nil {
+		return nil, "", storageError()
+	}
+	defer rows.Close()
+
+	var posts []microblog.UserPost
+	var scores []float32
+	for rows.Next() {
+		var score float32
+		post, err := scanPost(rows, &score)
+		if err != nil {
+			return nil, "", storageError()
+		}
+		posts = append(posts, post)
+		scores = append(scores, score)
+	}
+	if rows.Err() != nil {
+		return nil, "", storageError()
+	}
+	if len(posts) <= int(size) {
+		return posts, "", nil
+	}
+	posts = posts[:size]
+	if size == 0 {
+		return posts, "", nil
+	}
+	return posts, microblog.EncodeSearchCursor(float64(scores[size-1]), posts[size-1].PostId), nil
+}
+
+// tsQueries builds the text of the tsquery selecting the posts and of the one ranking them.
+// Posts have to contain every phrase, or any of the terms if there are no phrases;
+// all the words of the query contribute to the rank.
+func tsQueries(query microblog.SearchQuery) (string, string) {
+	quote := func(words []string) []string {
+		quoted := make([]string, len(words))
+		for i, word := range words {
+			quoted[i] = "'" + word + "'"
+		}
+		return quoted
+	}
+	rank := strings.Join(quote(query.Words()), " | ")
+	if len(query.Phrases) == 0 {
+		return strings.Join(quote(query.Terms), " | "), rank
+	}
+	phrases := make([]string, len(query.Phrases))
+	for i, phrase := range query.Phrases {
+		phrases[i] = "(" + strings.Join(quote(phrase), " <-> ") + ")"
+	}
+	return strings.Join(phrases, " & "), rank
+}
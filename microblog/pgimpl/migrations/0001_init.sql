@@ -0,0 +1,51 @@
+CREATE SEQUENCE post_ids;
+
+CREATE TABLE posts (
+    id               TEXT PRIMARY KEY DEFAULT nextval('post_ids')::TEXT,
+    author_id        TEXT        NOT NULL,
+    text             TEXT        NOT NULL,
+    created_at       TIMESTAMPTZ NOT NULL,
+    last_modified_at TIMESTAMPTZ,
+    likes_count      BIGINT      NOT NULL DEFAULT 0,
+    in_reply_to      TEXT,
+    root_id          TEXT,
+    kind             TEXT        NOT NULL DEFAULT '',
+    repost_of        TEXT,
+    reposts_count    BIGINT      NOT NULL DEFAULT 0,
+    tags             TEXT[]      NOT NULL DEFAULT '{}',
+    mentions         TEXT[]      NOT NULL DEFAULT '{}',
+    search           TSVECTOR GENERATED ALWAYS AS (to_tsvector('simple', text)) STORED
+);
+
+CREATE INDEX posts_author_id_created_at_id ON posts (author_id, created_at DESC, id DESC);
+CREATE INDEX posts_in_reply_to_created_at_id ON posts (in_reply_to, created_at DESC, id DESC)
+    WHERE in_reply_to IS NOT NULL;
+CREATE INDEX posts_tags ON posts USING GIN (tags);
+CREATE INDEX posts_mentions ON posts USING GIN (mentions);
+CREATE INDEX posts_search ON posts USING GIN (search);
+-- a user can repost a post without a quote only once
+CREATE UNIQUE INDEX posts_repost_of_author_id ON posts (repost_of, author_id) WHERE kind = 'repost';
+
+CREATE TABLE subscriptions (
+    follower_id TEXT NOT NULL,
+    followee_id TEXT NOT NULL,
+    PRIMARY KEY (follower_id, followee_id)
+);
+
+CREATE INDEX subscriptions_followee_id_follower_id ON subscriptions (followee_id, follower_id);
+
+CREATE TABLE post_revisions (
+    id        BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    post_id   TEXT        NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    text      TEXT        NOT NULL,
+    editor_id TEXT        NOT NULL,
+    edited_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX post_revisions_post_id_id ON post_revisions (post_id, id);
+
+CREATE TABLE likes (
+    post_id TEXT NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL,
+    PRIMARY KEY (post_id, user_id)
+);
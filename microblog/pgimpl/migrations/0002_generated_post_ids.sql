@@ -0,0 +1,6 @@
+-- post IDs are generated by the service, see the idgen package; the existing IDs are kept
+ALTER TABLE posts ALTER COLUMN id DROP DEFAULT;
+DROP SEQUENCE post_ids;
+
+-- compare the IDs byte by byte, so that they sort like in the other backends
+ALTER TABLE posts ALTER COLUMN id TYPE TEXT COLLATE "C";
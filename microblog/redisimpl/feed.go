@@ -0,0 +1,353 @@
+package redisimpl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"micro-blog/microblog"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Feeds are materialized as sorted sets of post IDs scored by creation time in microseconds.
+// Every materialized set holds feedSentinel with score 0, so an existing but empty feed
+// can be told apart from an evicted one, which has to be rebuilt from persistent storage.
+//
+// Every change of a set bumps its version, which a rebuild from persistent storage watches,
+// so that a rebuild racing with the change cannot store a set missing it.
+// A set that dropped older posts to stay within the capacity also holds feedTruncated with score 0,
+// as its size does not tell it once posts are deleted from it.
+const (
+	defaultFeedCapacity       = 800
+	defaultCelebrityThreshold = 10_000
+	feedCacheTTL              = 24 * time.Hour
+	fanOutTimeout             = 30 * time.Second
+	fanOutPageSize            = 200
+	feedSentinel              = "*"
+	feedTruncated             = "..."
+	celebritiesKey            = "celebrities"
+)
+
+func cacheKeyForFeed(userId string) string { return "feed:" + userId }
+
+func cacheKeyForTimeline(userId string) string { return "timeline:" + userId }
+
+func cacheKeyForFeedVersion(userId string) string { return "feed-version:" + userId }
+
+func cacheKeyForTimelineVersion(userId string) string { return "timeline-version:" + userId }
+
+func bumpVersion(ctx context.Context, pipe redis.Pipeliner, versionKey string) {
+	pipe.Incr(ctx, versionKey)
+	pipe.Expire(ctx, versionKey, feedCacheTTL)
+}
+
+// appendToFeed adds a post to a materialized feed and trims it to the capacity,
+// keeping the sentinel and marking the feed as truncated if posts are trimmed.
+// Feeds that are not materialized are left untouched.
+//
+// KEYS[1] - feed key, ARGV[1] - score, ARGV[2] - post ID, ARGV[3] - capacity, ARGV[4] - truncation marker.
+var appendToFeed = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[1], ARGV[2])
+local excess = redis.call('ZCOUNT', KEYS[1], '(0', '+inf') - tonumber(ARGV[3])
+if excess > 0 then
+	-- the markers have score 0, so they come before the posts
+	local markers = redis.call('ZCOUNT', KEYS[1], 0, 0)
+	redis.call('ZREMRANGEBYRANK', KEYS[1], markers, markers + excess - 1)
+	redis.call('ZADD', KEYS[1], 0, ARGV[4])
+end
+return 1
+`)
+
+func feedScore(post microblog.UserPost) int64 { return post.CreatedAt.UnixMicro() }
+
+// fanOut pushes a freshly created post to the feeds of the author's followers.
+// Authors with more than celebrityThreshold followers are marked as celebrities instead,
+// and their posts are pulled from their timeline when a follower reads the feed.
+func (r RedisManager) fanOut(ctx context.Context, post microblog.UserPost) {
+	score := feedScore(post)
+	var followers []string
+	token := ""
+	for {
+		page, next, err := r.persistentManager.GetFollowers(ctx, post.AuthorId, token, fanOutPageSize)
+		if err != nil {
+			return
+		}
+		followers = append(followers, page...)
+		if len(followers) > r.celebrityThreshold {
+			_ = r.client.SAdd(ctx, celebritiesKey, post.AuthorId).Err()
+			return
+		}
+		if next == "" {
+			break
+		}
+		token = next
+	}
+	_ = r.client.SRem(ctx, celebritiesKey, post.AuthorId).Err()
+
+	pipe := r.client.Pipeline()
+	for _, follower := range followers {
+		// Eval rather than Run, as a pipeline cannot fall back from EVALSHA to EVAL.
+		_ = appendToFeed.Eval(ctx, pipe, []string{cacheKeyForFeed(follower)}, score, post.PostId, r.feedCapacity, feedTruncated)
+		bumpVersion(ctx, pipe, cacheKeyForFeedVersion(follower))
+	}
+	_, _ = pipe.Exec(ctx)
+}
+
+// GetFeedInPage reads the feed materialized in Redis, merged with the timelines of followed celebrities.
+// The feed is rebuilt from persistent storage if its key is missing, or read from there if the rebuild races with a change.
+// Only the feedCapacity most recent posts of the feed and of each timeline are served.
+func (r RedisManager) GetFeedInPage(ctx context.Context, userId string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	var maxScore int64
+	var lastPostId string
+	if token != "" {
+		var err error
+		if maxScore, lastPostId, err = decodeFeedCursor(token); err != nil {
+			return nil, "", err
+		}
+	}
+
+	keys := []string{cacheKeyForFeed(userId)}
+	materialized, err := r.ensureFeed(ctx, userId)
+	if err != nil {
+		return nil, "", err
+	}
+	celebrities, err := r.followedCelebrities(ctx, userId)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, celebrity := range celebrities {
+		ok, err := r.ensureTimeline(ctx, celebrity)
+		if err != nil {
+			return nil, "", err
+		}
+		materialized = materialized && ok
+		keys = append(keys, cacheKeyForTimeline(celebrity))
+	}
+	if !materialized {
+		// a set changed while it was rebuilt, so the feed is read from persistent storage this time
+		return r.persistentManager.GetFeedInPage(ctx, userId, token, size)
+	}
+
+	// the size+1-th entry of a set tells if there is a next page
+	limit := int64(size) + 1
+	hasMore := false
+	seen := make(map[string]bool)
+	var entries []redis.Z
+	for _, key := range keys {
+		page, err := r.revRangeAfter(ctx, key, maxScore, lastPostId, limit)
+		if err != nil {
+			return nil, "", err
+		}
+		hasMore = hasMore || int64(len(page)) == limit
+		for _, entry := range page {
+			postId := entry.Member.(string)
+			if !seen[postId] {
+				seen[postId] = true
+				entries = append(entries, entry)
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Score == entries[j].Score {
+			return entries[i].Member.(string) > entries[j].Member.(string)
+		}
+		return entries[i].Score > entries[j].Score
+	})
+	if len(entries) > int(size) {
+		entries = entries[:size]
+		hasMore = true
+	}
+	if len(entries) == 0 {
+		return nil, "", nil
+	}
+
+	ids := make([]string, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.Member.(string)
+	}
+	posts := r.hydratePosts(ctx, ids)
+	if !hasMore {
+		return posts, "", nil
+	}
+	last := entries[len(entries)-1]
+	return posts, encodeFeedCursor(int64(last.Score), last.Member.(string)), nil
+}
+
+// revRangeAfter reads up to count posts of a materialized feed or timeline from the most recent one,
+// starting right after the entry with maxScore and lastPostId, or at the top if lastPostId is empty.
+// Entries sharing a score are ordered by post ID, so the ones up to the cursor come first; they are
+// skipped and the missing entries read again until count entries are collected or the set ends.
+func (r RedisManager) revRangeAfter(ctx context.Context, key string, maxScore int64, lastPostId string, count int64) ([]redis.Z, error) {
+	maxBound := "+inf"
+	if lastPostId != "" {
+		maxBound = strconv.FormatInt(maxScore, 10)
+	}
+	var entries []redis.Z
+	var offset int64
+	for int64(len(entries)) < count {
+		want := count - int64(len(entries))
+		page, err := r.client.ZRevRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{
+			Min:    "(0",
+			Max:    maxBound,
+			Offset: offset,
+			Count:  want,
+		}).Result()
+		if err != nil {
+			return nil, err
+		}
+		offset += int64(len(page))
+		for _, entry := range page {
+			if lastPostId != "" && int64(entry.Score) == maxScore && entry.Member.(string) >= lastPostId {
+				continue
+			}
+			entries = append(entries, entry)
+		}
+		if int64(len(page)) < want {
+			break
+		}
+	}
+	return entries, nil
+}
+
+// ensureFeed rebuilds the feed of userId from persistent storage if it is not materialized.
+func (r RedisManager) ensureFeed(ctx context.Context, userId string) (bool, error) {
+	return r.ensureSortedSet(ctx, cacheKeyForFeed(userId), cacheKeyForFeedVersion(userId), func(token string, size uint8) ([]microblog.UserPost, string, error) {
+		return r.persistentManager.GetFeedInPage(ctx, userId, token, size)
+	})
+}
+
+// ensureSortedSet rebuilds the set at key from persistent storage if it is not materialized and reports whether
+// it is. If the version of the set changes during the rebuild, it is left not materialized until the next read.
+func (r RedisManager) ensureSortedSet(
+	ctx context.Context,
+	key string,
+	versionKey string,
+	fetch func(token string, size uint8) ([]microblog.UserPost, string, error),
+) (bool, error) {
+	err := r.client.Watch(ctx, func(tx *redis.Tx) error {
+		exists, err := tx.Exists(ctx, key).Result()
+		if err != nil || exists == 1 {
+			return err
+		}
+		members, err := r.loadSortedSet(fetch)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.ZAdd(ctx, key, members...)
+			pipe.Expire(ctx, key, feedCacheTTL)
+			return nil
+		})
+		return err
+	}, key, versionKey)
+	if errors.Is(err, redis.TxFailedErr) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// loadSortedSet reads up to feedCapacity most recent posts from persistent storage
+// as the members of a materialized feed, including the sentinel, and the truncation
+// marker if there may be older posts.
+func (r RedisManager) loadSortedSet(fetch func(token string, size uint8) ([]microblog.UserPost, string, error)) ([]redis.Z, error) {
+	members := []redis.Z{{Score: 0, Member: feedSentinel}}
+	token := ""
+	for {
+		posts, next, err := fetch(token, fanOutPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, post := range posts {
+			members = append(members, redis.Z{Score: float64(feedScore(post)), Member: post.PostId})
+		}
+		if next == "" {
+			break
+		}
+		if len(members) > r.feedCapacity {
+			return append(members[:r.feedCapacity+1], redis.Z{Score: 0, Member: feedTruncated}), nil
+		}
+		token = next
+	}
+	if len(members) > r.feedCapacity+1 {
+		return append(members[:r.feedCapacity+1], redis.Z{Score: 0, Member: feedTruncated}), nil
+	}
+	return members, nil
+}
+
+// followedCelebrities returns the users marked as celebrities that userId follows.
+func (r RedisManager) followedCelebrities(ctx context.Context, userId string) ([]string, error) {
+	celebrities, err := r.client.SMembers(ctx, celebritiesKey).Result()
+	if err != nil || len(celebrities) == 0 {
+		return nil, err
+	}
+	isCelebrity := make(map[string]bool, len(celebrities))
+	for _, celebrity := range celebrities {
+		isCelebrity[celebrity] = true
+	}
+
+	var followed []string
+	token := ""
+	for {
+		followees, next, err := r.persistentManager.GetFollowees(ctx, userId, token, fanOutPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, followee := range followees {
+			if isCelebrity[followee] {
+				followed = append(followed, followee)
+			}
+		}
+		if next == "" {
+			return followed, nil
+		}
+		token = next
+	}
+}
+
+// hydratePosts loads the posts with the given IDs, preferring the post cache.
+// Posts that no longer exist are skipped.
+func (r RedisManager) hydratePosts(ctx context.Context, ids []string) []microblog.UserPost {
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = cacheKeyForPost(id)
+	}
+	cached, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		cached = make([]any, len(ids))
+	}
+
+	posts := make([]microblog.UserPost, 0, len(ids))
+	for i, id := range ids {
+		if raw, ok := cached[i].(string); ok {
+			var post microblog.UserPost
+			if json.Unmarshal([]byte(raw), &post) == nil {
+				posts = append(posts, post)
+				continue
+			}
+		}
+		if post, err := r.GetPost(ctx, id); err == nil {
+			posts = append(posts, post)
+		}
+	}
+	return posts
+}
+
+// encodeFeedCursor builds a page token pointing right after the feed entry with the given score and post ID.
+// The score is the creation time in microseconds, so the token has the format of the other post listings.
+func encodeFeedCursor(score int64, postId string) string {
+	return microblog.EncodePostCursor(time.UnixMicro(score), postId)
+}
+
+func decodeFeedCursor(token string) (int64, string, error) {
+	createdAt, postId, err := microblog.DecodePostCursor(token)
+	if err != nil {
+		return 0, "", err
+	}
+	return createdAt.UnixMicro(), postId, nil
+}
@@ -0,0 +1,127 @@
+package redisimpl
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	invalidationChannel = "post-invalidations"
+	// LocalCacheTTL is the longest a local copy of a post may be served. Local caches expire their
+	// entries after it, which bounds the staleness if invalidations are lost.
+	LocalCacheTTL = time.Minute
+	// listenHealthCheckInterval is the time without messages after which the subscription is pinged.
+	listenHealthCheckInterval = 15 * time.Second
+	// minListenRetryDelay and maxListenRetryDelay bound the backoff of reconnecting to the channel.
+	minListenRetryDelay = 100 * time.Millisecond
+	maxListenRetryDelay = 5 * time.Second
+)
+
+// Evictor is an in-process cache of posts kept consistent by an InvalidationBus.
+type Evictor interface {
+	// Evict drops the local copy of the post.
+	Evict(postID string)
+	// EvictAll drops every local copy, as invalidations might have been missed.
+	EvictAll()
+}
+
+// InvalidationBus broadcasts the IDs of the changed posts to every instance of the service
+// through a Redis pub/sub channel, so that the instances evict their local copies.
+// The messages are "<instance ID>:<post ID>", an instance ignores its own messages.
+type InvalidationBus struct {
+	client     *redis.Client
+	instanceId string
+}
+
+func NewInvalidationBus(client *redis.Client) *InvalidationBus {
+	instanceId := make([]byte, 8)
+	_, _ = rand.Read(instanceId)
+	return &InvalidationBus{client: client, instanceId: hex.EncodeToString(instanceId)}
+}
+
+// Publish announces that the posts have changed. Pub/sub delivery is best-effort,
+// so a failure is not reported: the local copies expire after LocalCacheTTL anyway.
+func (b *InvalidationBus) Publish(ctx context.Context, postIDs ...string) {
+	if len(postIDs) == 0 {
+		return
+	}
+	pipe := b.client.Pipeline()
+	for _, postID := range postIDs {
+		pipe.Publish(ctx, invalidationChannel, b.instanceId+":"+postID)
+	}
+	_, _ = pipe.Exec(ctx)
+}
+
+// Listen evicts the posts changed by the other instances from the evictor until ctx is done.
+// The subscription is re-established with a backoff when the connection breaks, and every local copy
+// is evicted once the channel is subscribed again, since the messages published meanwhile are lost.
+func (b *InvalidationBus) Listen(ctx context.Context, evictor Evictor) {
+	delay := minListenRetryDelay
+	resubscribing := false
+	for {
+		if b.listen(ctx, evictor, resubscribing) {
+			delay = minListenRetryDelay
+		}
+		if !sleep(ctx, delay) {
+			return
+		}
+		delay = min(2*delay, maxListenRetryDelay)
+		resubscribing = true
+	}
+}
+
+// listen subscribes to the channel and handles the messages until the connection breaks or ctx is done.
+// A connection idle for listenHealthCheckInterval is pinged and considered broken if the ping is not answered
+// in time. It reports whether the channel was subscribed.
+func (b *InvalidationBus) listen(ctx context.Context, evictor Evictor, resubscribing bool) bool {
+	pubsub := b.client.Subscribe(ctx, invalidationChannel)
+	defer pubsub.Close()
+	stop := context.AfterFunc(ctx, func() { _ = pubsub.Close() })
+	defer stop()
+
+	subscribed := false
+	pinged := false
+	for {
+		msg, err := pubsub.ReceiveTimeout(ctx, listenHealthCheckInterval)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() && !pinged && pubsub.Ping(ctx) == nil {
+				pinged = true
+				continue
+			}
+			return subscribed
+		}
+		pinged = false
+		switch msg := msg.(type) {
+		case *redis.Subscription:
+			subscribed = true
+			if resubscribing {
+				evictor.EvictAll()
+			}
+		case *redis.Message:
+			instanceId, postID, ok := strings.Cut(msg.Payload, ":")
+			if ok && instanceId != b.instanceId {
+				evictor.Evict(postID)
+			}
+		}
+	}
+}
+
+// sleep waits for the delay and reports false if ctx is done first.
+func sleep(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -2,8 +2,9 @@ package redisimpl
 
 import (
 	"context"
-	"encoding/json"
 	"micro-blog/microblog"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -19,54 +20,148 @@ func NewRedisManager(
 ) *RedisManager {
 
 	return &RedisManager{
-		client:            client,
-		persistentManager: persistentManager,
+		client:             client,
+		persistentManager:  persistentManager,
+		fanOuts:            &sync.WaitGroup{},
+		loads:              newLoadGroup(),
+		invalidations:      NewInvalidationBus(client),
+		feedCapacity:       defaultFeedCapacity,
+		celebrityThreshold: defaultCelebrityThreshold,
+		refreshBeta:        defaultRefreshBeta,
 	}
 }
 
 type RedisManager struct {
 	client            *redis.Client
 	persistentManager microblog.Manager
+	// fanOuts tracks the feed updates still running in background after AddPost.
+	fanOuts *sync.WaitGroup
+	// loads coalesces the concurrent reads of the same post from persistent storage.
+	loads *loadGroup
+	// invalidations announces the changed posts to the local caches of all the instances.
+	invalidations *InvalidationBus
+	// feedCapacity is the maximum number of posts kept in a materialized feed or timeline.
+	feedCapacity int
+	// celebrityThreshold is the number of followers above which posts are not pushed
+	// to the followers' feeds but pulled from the author's timeline on read.
+	celebrityThreshold int
+	// refreshBeta scales the window before the expiration of a post cache entry in which it may be refreshed early.
+	refreshBeta float64
 }
 
-// AddPost writes through to persistent storage and updates the cache.
+// AddPost writes through to persistent storage, updates the cache and the author's timeline and
+// pushes the post to the followers' feeds in background.
 func (r RedisManager) AddPost(ctx context.Context, userId string, post string) (microblog.UserPost, error) {
 	created, err := r.persistentManager.AddPost(ctx, userId, post)
 	if err != nil {
 		return created, err
 	}
-	if raw, mErr := json.Marshal(created); mErr == nil {
-		_ = r.client.Set(ctx, cacheKeyForPost(created.PostId), raw, postCacheTTL).Err()
-	}
+	r.afterAdd(ctx, created)
+	return created, nil
+}
 
+// AddReply writes through to persistent storage, updates the cache and
+// pushes the reply to the followers' feeds in background.
+func (r RedisManager) AddReply(ctx context.Context, userId string, inReplyTo string, post string) (microblog.UserPost, error) {
+	created, err := r.persistentManager.AddReply(ctx, userId, inReplyTo, post)
+	if err != nil {
+		return created, err
+	}
+	r.afterAdd(ctx, created)
 	return created, nil
 }
 
-// GetPost uses read-through cache backed by persistent storage.
-func (r RedisManager) GetPost(ctx context.Context, postID string) (microblog.UserPost, error) {
-	var cached microblog.UserPost
+func (r RedisManager) afterAdd(ctx context.Context, created microblog.UserPost) {
+	r.cachePost(ctx, created)
+	r.addToTimeline(ctx, created)
 
-	if bytes, err := r.client.Get(ctx, cacheKeyForPost(postID)).Bytes(); err == nil {
-		if uErr := json.Unmarshal(bytes, &cached); uErr == nil {
-			return cached, nil
-		}
-	}
+	r.fanOuts.Add(1)
+	go func() {
+		defer r.fanOuts.Done()
+		fanOutCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), fanOutTimeout)
+		defer cancel()
+		r.fanOut(fanOutCtx, created)
+	}()
+}
 
-	post, err := r.persistentManager.GetPost(ctx, postID)
+// DeletePost writes through the deletion and evicts the post from the caches and the author's timeline.
+// Feeds of the followers are cleaned up lazily, as deleted posts are skipped on read.
+func (r RedisManager) DeletePost(ctx context.Context, postID string) error {
+	post, err := r.GetPost(ctx, postID)
 	if err != nil {
-		return post, err
+		return err
 	}
-	if r.client != nil {
-		if raw, mErr := json.Marshal(post); mErr == nil {
-			_ = r.client.Set(ctx, cacheKeyForPost(postID), raw, postCacheTTL).Err()
-		}
+	if err := r.persistentManager.DeletePost(ctx, postID); err != nil {
+		return err
+	}
+	pipe := r.client.Pipeline()
+	pipe.Del(ctx, cacheKeyForPost(postID))
+	pipe.ZRem(ctx, cacheKeyForTimeline(post.AuthorId), postID)
+	bumpVersion(ctx, pipe, cacheKeyForTimelineVersion(post.AuthorId))
+	changed := []string{postID}
+	if post.RepostOf != "" {
+		// the reposts counter of the original post has changed
+		pipe.Del(ctx, cacheKeyForPost(post.RepostOf))
+		changed = append(changed, post.RepostOf)
+	}
+	_, _ = pipe.Exec(ctx)
+	r.invalidations.Publish(ctx, changed...)
+	return nil
+}
+
+// GetPostRevisions delegates to the persistent manager.
+func (r RedisManager) GetPostRevisions(ctx context.Context, postID string) ([]microblog.PostRevision, error) {
+	return r.persistentManager.GetPostRevisions(ctx, postID)
+}
+
+// Repost writes through to persistent storage, evicts the original post with the stale reposts counter
+// from the caches and pushes the repost to the followers' feeds in background.
+func (r RedisManager) Repost(ctx context.Context, userId string, postID string, quote string) (microblog.UserPost, error) {
+	created, err := r.persistentManager.Repost(ctx, userId, postID, quote)
+	if err != nil {
+		return created, err
 	}
-	return post, nil
+	_ = r.client.Del(ctx, cacheKeyForPost(created.RepostOf)).Err()
+	r.invalidations.Publish(ctx, created.RepostOf)
+	r.afterAdd(ctx, created)
+	return created, nil
+}
+
+// GetRepliesInPage delegates pagination to the persistent manager.
+func (r RedisManager) GetRepliesInPage(ctx context.Context, postID string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	return r.persistentManager.GetRepliesInPage(ctx, postID, token, size)
 }
 
-// GetPostsInPage delegates pagination to the persistent manager.
-func (r RedisManager) GetPostsInPage(ctx context.Context, userId string, token string, size uint8) ([]microblog.UserPost, string, error) {
-	return r.persistentManager.GetPostsInPage(ctx, userId, token, size)
+// GetMentionsInPage delegates pagination to the persistent manager.
+func (r RedisManager) GetMentionsInPage(ctx context.Context, userId string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	return r.persistentManager.GetMentionsInPage(ctx, userId, token, size)
+}
+
+// SearchPosts delegates the search to the persistent manager.
+func (r RedisManager) SearchPosts(ctx context.Context, query microblog.SearchQuery, token string, size uint8) ([]microblog.UserPost, string, error) {
+	return r.persistentManager.SearchPosts(ctx, query, token, size)
+}
+
+// GetTagPostsInPage delegates pagination to the persistent manager.
+func (r RedisManager) GetTagPostsInPage(ctx context.Context, tag string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	return r.persistentManager.GetTagPostsInPage(ctx, tag, token, size)
+}
+
+// GetThread walks up the reply chain through the post cache.
+func (r RedisManager) GetThread(ctx context.Context, postID string) ([]microblog.UserPost, error) {
+	post, err := r.GetPost(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+	thread := []microblog.UserPost{post}
+	for post.InReplyTo != "" {
+		if post, err = r.GetPost(ctx, post.InReplyTo); err != nil {
+			break
+		}
+		thread = append(thread, post)
+	}
+	slices.Reverse(thread)
+	return thread, nil
 }
 
 // IsReady checks both Redis and the persistent manager health.
@@ -80,16 +175,69 @@ func (r RedisManager) IsReady(ctx context.Context) bool {
 	return r.persistentManager.IsReady(ctx)
 }
 
-// ModifyPost writes through the update and refreshes the cache entry.
-func (r RedisManager) ModifyPost(ctx context.Context, postID string, post string) (microblog.UserPost, error) {
-	updated, err := r.persistentManager.ModifyPost(ctx, postID, post)
+// ModifyPost writes through the update, refreshes the cache entry and evicts the local copies.
+func (r RedisManager) ModifyPost(ctx context.Context, postID string, editorId string, post string) (microblog.UserPost, error) {
+	updated, err := r.persistentManager.ModifyPost(ctx, postID, editorId, post)
 	if err != nil {
 		return updated, err
 	}
-	if r.client != nil {
-		if raw, mErr := json.Marshal(updated); mErr == nil {
-			_ = r.client.Set(ctx, cacheKeyForPost(postID), raw, postCacheTTL).Err()
-		}
+	r.cachePost(ctx, updated)
+	r.invalidations.Publish(ctx, postID)
+	return updated, nil
+}
+
+// Subscribe writes through and drops the follower's feed so it is rebuilt on next read.
+func (r RedisManager) Subscribe(ctx context.Context, userId string, targetId string) error {
+	if err := r.persistentManager.Subscribe(ctx, userId, targetId); err != nil {
+		return err
 	}
+	_ = r.client.Del(ctx, cacheKeyForFeed(userId)).Err()
+	return nil
+}
+
+// Unsubscribe writes through and drops the follower's feed so it is rebuilt on next read.
+func (r RedisManager) Unsubscribe(ctx context.Context, userId string, targetId string) error {
+	if err := r.persistentManager.Unsubscribe(ctx, userId, targetId); err != nil {
+		return err
+	}
+	_ = r.client.Del(ctx, cacheKeyForFeed(userId)).Err()
+	return nil
+}
+
+// GetFollowers delegates pagination to the persistent manager.
+func (r RedisManager) GetFollowers(ctx context.Context, userId string, token string, size uint8) ([]string, string, error) {
+	return r.persistentManager.GetFollowers(ctx, userId, token, size)
+}
+
+// GetFollowees delegates pagination to the persistent manager.
+func (r RedisManager) GetFollowees(ctx context.Context, userId string, token string, size uint8) ([]string, string, error) {
+	return r.persistentManager.GetFollowees(ctx, userId, token, size)
+}
+
+// LikePost writes through the like, refreshes the cache entry with the new counter and evicts the local copies.
+func (r RedisManager) LikePost(ctx context.Context, postID string, userId string) (microblog.UserPost, error) {
+	updated, err := r.persistentManager.LikePost(ctx, postID, userId)
+	if err != nil {
+		return updated, err
+	}
+	r.cachePost(ctx, updated)
+	r.invalidations.Publish(ctx, postID)
 	return updated, nil
 }
+
+// UnlikePost writes through the unlike, refreshes the cache entry with the new counter and evicts the local copies.
+func (r RedisManager) UnlikePost(ctx context.Context, postID string, userId string) (microblog.UserPost, error) {
+	updated, err := r.persistentManager.UnlikePost(ctx, postID, userId)
+	if err != nil {
+		return updated, err
+	}
+	r.cachePost(ctx, updated)
+	r.invalidations.Publish(ctx, postID)
+	return updated, nil
+}
+
+// Invalidations returns the bus the manager announces the changed posts on,
+// which the local caches of posts listen to.
+func (r RedisManager) Invalidations() *InvalidationBus {
+	return r.invalidations
+}
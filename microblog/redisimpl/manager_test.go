@@ -4,14 +4,21 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/synctest"
 	"time"
 
 	"micro-blog/microblog"
 	"micro-blog/microblog/inmemoryimpl"
+	"micro-blog/microblog/microblogtest"
 
 	"github.com/alicebob/miniredis/v2"
 	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -21,13 +28,25 @@ func TestRedisManager(t *testing.T) {
 	suite.Run(t, new(RedisManagerSuite))
 }
 
+func TestRedisManagerConformance(t *testing.T) {
+	suite.Run(t, &microblogtest.ManagerSuite{NewManager: func(t *testing.T) microblog.Manager {
+		client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+		manager := NewRedisManager(client, inmemoryimpl.NewInMemoryManager())
+		t.Cleanup(func() {
+			manager.fanOuts.Wait()
+			_ = client.Close()
+		})
+		return manager
+	}})
+}
+
 type RedisManagerSuite struct {
 	suite.Suite
 
 	mini        *miniredis.Miniredis
 	redisClient *redis.Client
 	persistent  *inmemoryimpl.InMemoryManager
-	cached      microblog.Manager
+	cached      *RedisManager
 }
 
 func (s *RedisManagerSuite) SetupSuite() {
@@ -58,6 +77,11 @@ func (s *RedisManagerSuite) SetupTest() {
 	s.cached = NewRedisManager(s.redisClient, s.persistent)
 }
 
+func (s *RedisManagerSuite) TearDownTest() {
+	// let background feed updates finish before redis is flushed
+	s.cached.fanOuts.Wait()
+}
+
 func (s *RedisManagerSuite) TestAddPost_WritesThroughAndCaches() {
 	user := "user123"
 	text := "Hello from cache"
@@ -106,7 +130,7 @@ func (s *RedisManagerSuite) TestModifyPost_RefreshesCache() {
 	s.Require().NoError(err)
 
 	// modify
-	updated, err := s.cached.ModifyPost(ctx, p.PostId, "v2")
+	updated, err := s.cached.ModifyPost(ctx, p.PostId, user, "v2")
 	s.Require().NoError(err)
 	s.Require().Equal("v2", updated.Text)
 	s.Require().False(updated.LastModifiedAt.IsZero())
@@ -133,7 +157,7 @@ func (s *RedisManagerSuite) addNPosts(user string, n int) []microblog.UserPost {
 	return posts
 }
 
-func (s *RedisManagerSuite) TestGetPostsInPage_PassThrough() {
+func (s *RedisManagerSuite) TestGetPostsInPage_ServesTimeline() {
 	user := "carol"
 	s.addNPosts(user, 10)
 
@@ -152,7 +176,757 @@ func (s *RedisManagerSuite) TestGetPostsInPage_PassThrough() {
 	s.Require().Equal("This is post number 1", posts[4].Text)
 }
 
+func (s *RedisManagerSuite) TestGetPostsInPage_MaterializesTimeline() {
+	created := s.addNPosts("carol", 3)
+	exists, err := s.redisClient.Exists(ctx, cacheKeyForTimeline("carol")).Result()
+	s.Require().NoError(err)
+	s.Require().Zero(exists)
+
+	posts, next, err := s.cached.GetPostsInPage(ctx, "carol", "", 10)
+	s.Require().NoError(err)
+	s.Require().Equal([]microblog.UserPost{created[2], created[1], created[0]}, posts)
+	s.Require().Empty(next)
+	ids, err := s.redisClient.ZRevRange(ctx, cacheKeyForTimeline("carol"), 0, -1).Result()
+	s.Require().NoError(err)
+	s.Require().Equal([]string{created[2].PostId, created[1].PostId, created[0].PostId, feedSentinel}, ids)
+
+	// a post written behind the cache's back is not seen until the timeline expires
+	_, err = s.persistent.AddPost(ctx, "carol", "bypassing the cache")
+	s.Require().NoError(err)
+	posts, _, err = s.cached.GetPostsInPage(ctx, "carol", "", 10)
+	s.Require().NoError(err)
+	s.Require().Len(posts, 3)
+}
+
+func (s *RedisManagerSuite) TestGetPostsInPage_FollowsWrites() {
+	created := s.addNPosts("carol", 3)
+	_, _, err := s.cached.GetPostsInPage(ctx, "carol", "", 10)
+	s.Require().NoError(err)
+
+	added, err := s.cached.AddPost(ctx, "carol", "added")
+	s.Require().NoError(err)
+	modified, err := s.cached.ModifyPost(ctx, created[0].PostId, "carol", "modified")
+	s.Require().NoError(err)
+	s.Require().NoError(s.cached.DeletePost(ctx, created[1].PostId))
+
+	posts, next, err := s.cached.GetPostsInPage(ctx, "carol", "", 10)
+	s.Require().NoError(err)
+	s.Require().Equal([]microblog.UserPost{added, created[2], modified}, posts)
+	s.Require().Empty(next)
+}
+
+func (s *RedisManagerSuite) TestGetPostsInPage_ReadsPastTimelineFromStorage() {
+	s.cached.feedCapacity = 3
+	created := s.addNPosts("carol", 7)
+	_, _, err := s.cached.GetPostsInPage(ctx, "carol", "", 1)
+	s.Require().NoError(err)
+	count, err := s.redisClient.ZCard(ctx, cacheKeyForTimeline("carol")).Result()
+	s.Require().NoError(err)
+	s.Require().EqualValues(5, count)
+
+	var timeline []microblog.UserPost
+	token := ""
+	for {
+		posts, next, err := s.cached.GetPostsInPage(ctx, "carol", token, 2)
+		s.Require().NoError(err)
+		timeline = append(timeline, posts...)
+		if next == "" {
+			break
+		}
+		s.Require().Len(posts, 2)
+		token = next
+	}
+	slices.Reverse(created)
+	s.Require().Equal(created, timeline)
+}
+
+func (s *RedisManagerSuite) TestGetPostsInPage_ReadsPastTrimmedTimelineAfterDelete() {
+	s.cached.feedCapacity = 3
+	// reading the timeline materializes it, the posts added later are trimmed from it
+	_, _, err := s.cached.GetPostsInPage(ctx, "carol", "", 2)
+	s.Require().NoError(err)
+	created := s.addNPosts("carol", 6)
+	s.Require().NoError(s.cached.DeletePost(ctx, created[5].PostId))
+
+	timeline := s.readTimeline("carol", 2)
+	created = created[:5]
+	slices.Reverse(created)
+	s.Require().Equal(created, timeline)
+}
+
+func (s *RedisManagerSuite) TestGetPostsInPage_ReadsPastRebuiltTimelineAfterDelete() {
+	s.cached.feedCapacity = 3
+	created := s.addNPosts("carol", 4)
+	// the rebuild reads the capacity of posts out of the 4
+	_, _, err := s.cached.GetPostsInPage(ctx, "carol", "", 2)
+	s.Require().NoError(err)
+	s.Require().NoError(s.cached.DeletePost(ctx, created[3].PostId))
+
+	timeline := s.readTimeline("carol", 2)
+	created = created[:3]
+	slices.Reverse(created)
+	s.Require().Equal(created, timeline)
+}
+
+// readTimeline reads the pages of the timeline of the user until it ends.
+func (s *RedisManagerSuite) readTimeline(userId string, size uint8) []microblog.UserPost {
+	return readAllPages(s.T(), int(size), func(token string) ([]microblog.UserPost, string, error) {
+		return s.cached.GetPostsInPage(ctx, userId, token, size)
+	})
+}
+
+func (s *RedisManagerSuite) TestGetPostsInPage_PagesThroughPostsSharingTimestamp() {
+	synctest.Test(s.T(), func(t *testing.T) {
+		cached, counting := s.newBubbleManager(t)
+		// the clock of the bubble stands still, so all the posts are created at the same time
+		var created []microblog.UserPost
+		for i := range 40 {
+			p, err := cached.AddPost(ctx, "carol", fmt.Sprintf("This is post number %d", i))
+			require.NoError(t, err)
+			created = append(created, p)
+		}
+		_, _, err := cached.GetPostsInPage(ctx, "carol", "", 1)
+		require.NoError(t, err)
+		count, err := cached.client.ZCard(ctx, cacheKeyForTimeline("carol")).Result()
+		require.NoError(t, err)
+		require.EqualValues(t, 41, count)
+		loads := counting.pages.Load()
+
+		timeline := readAllPages(t, 5, func(token string) ([]microblog.UserPost, string, error) {
+			return cached.GetPostsInPage(ctx, "carol", token, 5)
+		})
+		require.Equal(t, sortedByPostIdDesc(created), timeline)
+		// all the pages are served by the timeline
+		require.Equal(t, loads, counting.pages.Load())
+	})
+}
+
+func (s *RedisManagerSuite) TestGetPostsInPage_DropsTimelineChangedDuringRebuild() {
+	s.addNPosts("carol", 2)
+	var added microblog.UserPost
+	s.cached.persistentManager = &racingManager{
+		InMemoryManager: s.persistent,
+		beforeRead: func() {
+			var err error
+			added, err = s.cached.AddPost(ctx, "carol", "racing")
+			s.Require().NoError(err)
+		},
+	}
+
+	posts, _, err := s.cached.GetPostsInPage(ctx, "carol", "", 10)
+	s.Require().NoError(err)
+	s.Require().Len(posts, 3)
+	s.Require().Equal(added, posts[0])
+	exists, err := s.redisClient.Exists(ctx, cacheKeyForTimeline("carol")).Result()
+	s.Require().NoError(err)
+	s.Require().Zero(exists)
+}
+
+// racingManager runs beforeRead once, before the first read of a user's posts or feed.
+type racingManager struct {
+	*inmemoryimpl.InMemoryManager
+	beforeRead func()
+}
+
+func (m *racingManager) GetPostsInPage(ctx context.Context, userId string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	m.race()
+	return m.InMemoryManager.GetPostsInPage(ctx, userId, token, size)
+}
+
+func (m *racingManager) GetFeedInPage(ctx context.Context, userId string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	m.race()
+	return m.InMemoryManager.GetFeedInPage(ctx, userId, token, size)
+}
+
+func (m *racingManager) race() {
+	if m.beforeRead != nil {
+		beforeRead := m.beforeRead
+		m.beforeRead = nil
+		beforeRead()
+	}
+}
+
+func (s *RedisManagerSuite) TestGetPost_CachesMissingPosts() {
+	counting := &countingManager{InMemoryManager: s.persistent}
+	s.cached.persistentManager = counting
+
+	for range 3 {
+		_, err := s.cached.GetPost(ctx, "missing")
+		s.Require().ErrorIs(err, microblog.ErrNotFound)
+	}
+	s.Require().EqualValues(1, counting.gets.Load())
+	s.Require().Equal(missingPostTTL, s.mini.TTL(cacheKeyForPost("missing")))
+
+	s.mini.FastForward(missingPostTTL)
+	_, err := s.cached.GetPost(ctx, "missing")
+	s.Require().ErrorIs(err, microblog.ErrNotFound)
+	s.Require().EqualValues(2, counting.gets.Load())
+
+	// hydration of the feeds skips missing posts
+	s.Require().Empty(s.cached.hydratePosts(ctx, []string{"missing"}))
+}
+
+func (s *RedisManagerSuite) TestGetPost_CoalescesLoads() {
+	const readers = 8
+	synctest.Test(s.T(), func(t *testing.T) {
+		cached, counting := s.newBubbleManager(t)
+		counting.release = make(chan struct{})
+		p, err := counting.AddPost(ctx, "bob", "popular")
+		require.NoError(t, err)
+
+		var wg sync.WaitGroup
+		results := make([]microblog.UserPost, readers)
+		for i := range readers {
+			wg.Go(func() {
+				results[i], _ = cached.GetPost(ctx, p.PostId)
+			})
+		}
+		// one reader loads the post, the others await it
+		synctest.Wait()
+		close(counting.release)
+		wg.Wait()
+
+		require.EqualValues(t, 1, counting.gets.Load())
+		for _, result := range results {
+			require.Equal(t, p, result)
+		}
+	})
+}
+
+func (s *RedisManagerSuite) TestGetPost_LoadOutlivesCanceledReader() {
+	synctest.Test(s.T(), func(t *testing.T) {
+		cached, counting := s.newBubbleManager(t)
+		counting.release = make(chan struct{})
+		p, err := counting.AddPost(ctx, "bob", "popular")
+		require.NoError(t, err)
+
+		canceledCtx, cancel := context.WithCancel(ctx)
+		var canceledErr error
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			_, canceledErr = cached.GetPost(canceledCtx, p.PostId)
+		})
+		synctest.Wait()
+		var result microblog.UserPost
+		wg.Go(func() {
+			result, err = cached.GetPost(ctx, p.PostId)
+		})
+		synctest.Wait()
+		// the reader that started the load gives up, the load goes on for the other one
+		cancel()
+		synctest.Wait()
+		close(counting.release)
+		wg.Wait()
+
+		require.ErrorIs(t, canceledErr, context.Canceled)
+		require.NoError(t, err)
+		require.Equal(t, p, result)
+		require.EqualValues(t, 1, counting.gets.Load())
+	})
+}
+
+// newBubbleManager creates a manager with a Redis client of its own, as the connections
+// of a synctest bubble must not be shared with the goroutines outside it.
+func (s *RedisManagerSuite) newBubbleManager(t *testing.T) (*RedisManager, *countingManager) {
+	client := redis.NewClient(&redis.Options{Addr: s.mini.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	counting := &countingManager{InMemoryManager: inmemoryimpl.NewInMemoryManager()}
+	return NewRedisManager(client, counting), counting
+}
+
+func (s *RedisManagerSuite) TestGetPost_RefreshesEarly() {
+	// widen the window to a few seconds before the expiration
+	s.cached.refreshBeta = 100
+	p, err := s.persistent.AddPost(ctx, "bob", "v1")
+	s.Require().NoError(err)
+	counting := &countingManager{InMemoryManager: s.persistent}
+	s.cached.persistentManager = counting
+	_, err = s.cached.GetPost(ctx, p.PostId)
+	s.Require().NoError(err)
+	_, err = s.persistent.ModifyPost(ctx, p.PostId, "bob", "v2")
+	s.Require().NoError(err)
+
+	// far from the expiration the cached post is served
+	got, err := s.cached.GetPost(ctx, p.PostId)
+	s.Require().NoError(err)
+	s.Require().Equal("v1", got.Text)
+	s.Require().EqualValues(1, counting.gets.Load())
+
+	s.mini.FastForward(postCacheTTL - time.Millisecond)
+	for range 3 {
+		if got, err = s.cached.GetPost(ctx, p.PostId); got.Text == "v2" {
+			break
+		}
+	}
+	s.Require().NoError(err)
+	s.Require().Equal("v2", got.Text)
+	s.Require().Equal(postCacheTTL, s.mini.TTL(cacheKeyForPost(p.PostId)))
+}
+
+// countingManager counts the reads of posts, which wait for release if it is set, and of the pages of posts.
+type countingManager struct {
+	*inmemoryimpl.InMemoryManager
+	gets    atomic.Int64
+	pages   atomic.Int64
+	release chan struct{}
+}
+
+func (m *countingManager) GetPostsInPage(ctx context.Context, userId string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	m.pages.Add(1)
+	return m.InMemoryManager.GetPostsInPage(ctx, userId, token, size)
+}
+
+func (m *countingManager) GetPost(ctx context.Context, postID string) (microblog.UserPost, error) {
+	m.gets.Add(1)
+	if m.release != nil {
+		<-m.release
+	}
+	return m.InMemoryManager.GetPost(ctx, postID)
+}
+
+// recordingEvictor reports the evictions on a channel.
+type recordingEvictor chan string
+
+const evictedAll = "*"
+
+func (e recordingEvictor) Evict(postID string) { e <- postID }
+
+func (e recordingEvictor) EvictAll() { e <- evictedAll }
+
+// listen runs Listen of the bus until the end of the test and waits for it to subscribe.
+func (s *RedisManagerSuite) listen(mini *miniredis.Miniredis, bus *InvalidationBus) recordingEvictor {
+	evictor := make(recordingEvictor, 16)
+	listenCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		bus.Listen(listenCtx, evictor)
+	}()
+	s.T().Cleanup(func() {
+		cancel()
+		<-done
+	})
+	s.waitForSubscriber(mini)
+	return evictor
+}
+
+func (s *RedisManagerSuite) waitForSubscriber(mini *miniredis.Miniredis) {
+	s.Require().Eventually(func() bool {
+		return mini.PubSubNumSub(invalidationChannel)[invalidationChannel] > 0
+	}, 5*time.Second, time.Millisecond)
+}
+
+func (s *RedisManagerSuite) requireEvicted(evictor recordingEvictor, expected string) {
+	select {
+	case evicted := <-evictor:
+		s.Require().Equal(expected, evicted)
+	case <-time.After(5 * time.Second):
+		s.FailNow("no eviction of " + expected)
+	}
+}
+
+func (s *RedisManagerSuite) TestInvalidationBus_EvictsOnOtherInstances() {
+	local, remote := NewInvalidationBus(s.redisClient), NewInvalidationBus(s.redisClient)
+	evictor := s.listen(s.mini, local)
+
+	// own messages are ignored
+	local.Publish(ctx, "mine")
+	remote.Publish(ctx, "a1", "b2")
+	s.requireEvicted(evictor, "a1")
+	s.requireEvicted(evictor, "b2")
+}
+
+func (s *RedisManagerSuite) TestInvalidationBus_EvictsAllAfterReconnecting() {
+	// the restart breaks the pooled connections, so the suite's server is not used
+	mini := miniredis.RunT(s.T())
+	client := redis.NewClient(&redis.Options{Addr: mini.Addr()})
+	s.T().Cleanup(func() { _ = client.Close() })
+	evictor := s.listen(mini, NewInvalidationBus(client))
+
+	mini.Close()
+	s.Require().NoError(mini.Restart())
+	s.requireEvicted(evictor, evictedAll)
+	s.waitForSubscriber(mini)
+
+	publisher := redis.NewClient(&redis.Options{Addr: mini.Addr()})
+	s.T().Cleanup(func() { _ = publisher.Close() })
+	NewInvalidationBus(publisher).Publish(ctx, "a1")
+	s.requireEvicted(evictor, "a1")
+}
+
+func (s *RedisManagerSuite) TestWrites_PublishInvalidations() {
+	evictor := s.listen(s.mini, NewInvalidationBus(s.redisClient))
+	original, err := s.cached.AddPost(ctx, "bob", "original")
+	s.Require().NoError(err)
+
+	_, err = s.cached.ModifyPost(ctx, original.PostId, "bob", "modified")
+	s.Require().NoError(err)
+	s.requireEvicted(evictor, original.PostId)
+	_, err = s.cached.LikePost(ctx, original.PostId, "alice")
+	s.Require().NoError(err)
+	s.requireEvicted(evictor, original.PostId)
+	_, err = s.cached.UnlikePost(ctx, original.PostId, "alice")
+	s.Require().NoError(err)
+	s.requireEvicted(evictor, original.PostId)
+	repost, err := s.cached.Repost(ctx, "alice", original.PostId, "")
+	s.Require().NoError(err)
+	s.requireEvicted(evictor, original.PostId)
+	s.Require().NoError(s.cached.DeletePost(ctx, repost.PostId))
+	s.requireEvicted(evictor, repost.PostId)
+	s.requireEvicted(evictor, original.PostId)
+}
+
 func (s *RedisManagerSuite) TestIsReady_TrueWhenHealthy() {
 	ready := s.cached.IsReady(ctx)
 	s.Require().True(ready)
 }
+
+func (s *RedisManagerSuite) TestSubscriptions_PassThrough() {
+	s.Require().NoError(s.cached.Subscribe(ctx, "alice", "bob"))
+	s.Require().NoError(s.cached.Subscribe(ctx, "carol", "bob"))
+	s.Require().ErrorIs(s.cached.Subscribe(ctx, "bob", "bob"), microblog.ErrSelfSubscription)
+
+	followers, next, err := s.cached.GetFollowers(ctx, "bob", "", 10)
+	s.Require().NoError(err)
+	s.Require().Equal([]string{"alice", "carol"}, followers)
+	s.Require().Empty(next)
+
+	s.Require().NoError(s.cached.Unsubscribe(ctx, "alice", "bob"))
+	followees, _, err := s.persistent.GetFollowees(ctx, "alice", "", 10)
+	s.Require().NoError(err)
+	s.Require().Empty(followees)
+}
+
+func (s *RedisManagerSuite) TestGetFeedInPage_RebuildsMissingFeed() {
+	s.Require().NoError(s.cached.Subscribe(ctx, "dave", "carol"))
+	s.addNPosts("carol", 3)
+	s.addNPosts("erin", 2)
+	s.cached.fanOuts.Wait()
+	exists, err := s.redisClient.Exists(ctx, cacheKeyForFeed("dave")).Result()
+	s.Require().NoError(err)
+	s.Require().Zero(exists)
+
+	posts, next, err := s.cached.GetFeedInPage(ctx, "dave", "", 2)
+	s.Require().NoError(err)
+	s.Require().Len(posts, 2)
+	s.Require().Equal("This is post number 3", posts[0].Text)
+	s.Require().NotEmpty(next)
+
+	posts, next, err = s.cached.GetFeedInPage(ctx, "dave", next, 2)
+	s.Require().NoError(err)
+	s.Require().Len(posts, 1)
+	s.Require().Equal("This is post number 1", posts[0].Text)
+	s.Require().Empty(next)
+}
+
+func (s *RedisManagerSuite) TestGetFeedInPage_DropsFeedChangedDuringRebuild() {
+	s.Require().NoError(s.cached.Subscribe(ctx, "dave", "carol"))
+	s.addNPosts("carol", 2)
+	s.cached.fanOuts.Wait()
+	var added microblog.UserPost
+	s.cached.persistentManager = &racingManager{
+		InMemoryManager: s.persistent,
+		beforeRead: func() {
+			var err error
+			added, err = s.cached.AddPost(ctx, "carol", "racing")
+			s.Require().NoError(err)
+			s.cached.fanOuts.Wait()
+		},
+	}
+
+	posts, _, err := s.cached.GetFeedInPage(ctx, "dave", "", 10)
+	s.Require().NoError(err)
+	s.Require().Len(posts, 3)
+	s.Require().Equal(added, posts[0])
+	exists, err := s.redisClient.Exists(ctx, cacheKeyForFeed("dave")).Result()
+	s.Require().NoError(err)
+	s.Require().Zero(exists)
+}
+
+func (s *RedisManagerSuite) TestAddPost_FansOutToMaterializedFeeds() {
+	s.Require().NoError(s.cached.Subscribe(ctx, "dave", "carol"))
+	s.Require().NoError(s.cached.Subscribe(ctx, "erin", "carol"))
+	// reading the feed materializes it
+	posts, _, err := s.cached.GetFeedInPage(ctx, "dave", "", 10)
+	s.Require().NoError(err)
+	s.Require().Empty(posts)
+
+	created := s.addNPosts("carol", 2)
+	s.cached.fanOuts.Wait()
+
+	ids, err := s.redisClient.ZRevRange(ctx, cacheKeyForFeed("dave"), 0, -1).Result()
+	s.Require().NoError(err)
+	s.Require().Equal([]string{created[1].PostId, created[0].PostId, feedSentinel}, ids)
+	// feeds that were never read are not materialized
+	exists, err := s.redisClient.Exists(ctx, cacheKeyForFeed("erin")).Result()
+	s.Require().NoError(err)
+	s.Require().Zero(exists)
+
+	posts, next, err := s.cached.GetFeedInPage(ctx, "dave", "", 10)
+	s.Require().NoError(err)
+	s.Require().Equal([]microblog.UserPost{created[1], created[0]}, posts)
+	s.Require().Empty(next)
+}
+
+func (s *RedisManagerSuite) TestAddPost_TrimsFeedToCapacity() {
+	s.cached.feedCapacity = 3
+	s.Require().NoError(s.cached.Subscribe(ctx, "dave", "carol"))
+	_, _, err := s.cached.GetFeedInPage(ctx, "dave", "", 10)
+	s.Require().NoError(err)
+
+	created := s.addNPosts("carol", 5)
+	s.cached.fanOuts.Wait()
+
+	ids, err := s.redisClient.ZRevRange(ctx, cacheKeyForFeed("dave"), 0, -1).Result()
+	s.Require().NoError(err)
+	s.Require().Equal([]string{created[4].PostId, created[3].PostId, created[2].PostId, feedTruncated, feedSentinel}, ids)
+}
+
+func (s *RedisManagerSuite) TestGetFeedInPage_PullsCelebrityPosts() {
+	s.cached.celebrityThreshold = 1
+	s.Require().NoError(s.cached.Subscribe(ctx, "dave", "star"))
+	s.Require().NoError(s.cached.Subscribe(ctx, "erin", "star"))
+	s.Require().NoError(s.cached.Subscribe(ctx, "dave", "carol"))
+	_, _, err := s.cached.GetFeedInPage(ctx, "dave", "", 10)
+	s.Require().NoError(err)
+
+	var expected []microblog.UserPost
+	for i := 0; i < 3; i++ {
+		for _, author := range []string{"star", "carol"} {
+			p, err := s.cached.AddPost(ctx, author, fmt.Sprintf("%s post %d", author, i))
+			s.Require().NoError(err)
+			expected = append([]microblog.UserPost{p}, expected...)
+		}
+	}
+	s.cached.fanOuts.Wait()
+
+	isCelebrity, err := s.redisClient.SIsMember(ctx, celebritiesKey, "star").Result()
+	s.Require().NoError(err)
+	s.Require().True(isCelebrity)
+	// celebrity posts are not pushed to the followers' feeds
+	count, err := s.redisClient.ZCard(ctx, cacheKeyForFeed("dave")).Result()
+	s.Require().NoError(err)
+	s.Require().EqualValues(4, count)
+
+	var feed []microblog.UserPost
+	token := ""
+	for {
+		posts, next, err := s.cached.GetFeedInPage(ctx, "dave", token, 4)
+		s.Require().NoError(err)
+		feed = append(feed, posts...)
+		if next == "" {
+			break
+		}
+		token = next
+	}
+	s.Require().Equal(expected, feed)
+}
+
+func (s *RedisManagerSuite) TestGetFeedInPage_PagesThroughPostsSharingTimestamp() {
+	synctest.Test(s.T(), func(t *testing.T) {
+		cached, _ := s.newBubbleManager(t)
+		require.NoError(t, cached.Subscribe(ctx, "dave", "carol"))
+		_, _, err := cached.GetFeedInPage(ctx, "dave", "", 10)
+		require.NoError(t, err)
+
+		// the clock of the bubble stands still, so all the posts are created at the same time
+		var created []microblog.UserPost
+		for i := range 40 {
+			p, err := cached.AddPost(ctx, "carol", fmt.Sprintf("This is post number %d", i))
+			require.NoError(t, err)
+			created = append(created, p)
+		}
+		cached.fanOuts.Wait()
+
+		feed := readAllPages(t, 5, func(token string) ([]microblog.UserPost, string, error) {
+			return cached.GetFeedInPage(ctx, "dave", token, 5)
+		})
+		require.Equal(t, sortedByPostIdDesc(created), feed)
+	})
+}
+
+// readAllPages reads the pages of a listing until it ends, requiring all but the last one to be full.
+func readAllPages(t *testing.T, size int, getPage func(token string) ([]microblog.UserPost, string, error)) []microblog.UserPost {
+	var all []microblog.UserPost
+	token := ""
+	for {
+		posts, next, err := getPage(token)
+		require.NoError(t, err)
+		all = append(all, posts...)
+		if next == "" {
+			return all
+		}
+		require.Len(t, posts, size)
+		token = next
+	}
+}
+
+// sortedByPostIdDesc returns the posts in the order of the listings for posts created at the same time.
+func sortedByPostIdDesc(posts []microblog.UserPost) []microblog.UserPost {
+	sorted := slices.Clone(posts)
+	slices.SortFunc(sorted, func(a, b microblog.UserPost) int { return strings.Compare(b.PostId, a.PostId) })
+	return sorted
+}
+
+func (s *RedisManagerSuite) TestGetFeedInPage_InvalidToken() {
+	_, _, err := s.cached.GetFeedInPage(ctx, "dave", "not a token", 10)
+	s.Require().ErrorIs(err, microblog.ErrInvalidToken)
+}
+
+func (s *RedisManagerSuite) TestDeletePost_EvictsCache() {
+	s.Require().NoError(s.cached.Subscribe(ctx, "dave", "carol"))
+	_, _, err := s.cached.GetFeedInPage(ctx, "dave", "", 10)
+	s.Require().NoError(err)
+	created := s.addNPosts("carol", 3)
+	s.cached.fanOuts.Wait()
+
+	s.Require().NoError(s.cached.DeletePost(ctx, created[1].PostId))
+	_, err = s.redisClient.Get(ctx, cacheKeyForPost(created[1].PostId)).Bytes()
+	s.Require().ErrorIs(err, redis.Nil)
+	_, err = s.cached.GetPost(ctx, created[1].PostId)
+	s.Require().Error(err)
+	s.Require().Error(s.cached.DeletePost(ctx, created[1].PostId))
+
+	posts, _, err := s.cached.GetFeedInPage(ctx, "dave", "", 10)
+	s.Require().NoError(err)
+	s.Require().Equal([]microblog.UserPost{created[2], created[0]}, posts)
+}
+
+func (s *RedisManagerSuite) TestGetPostRevisions_PassThrough() {
+	user := "bob"
+	p, err := s.cached.AddPost(ctx, user, "v1")
+	s.Require().NoError(err)
+	_, err = s.cached.ModifyPost(ctx, p.PostId, user, "v2")
+	s.Require().NoError(err)
+
+	revisions, err := s.cached.GetPostRevisions(ctx, p.PostId)
+	s.Require().NoError(err)
+	s.Require().Len(revisions, 1)
+	s.Require().Equal("v1", revisions[0].Text)
+	s.Require().Equal(user, revisions[0].EditorId)
+
+	_, err = s.cached.GetPostRevisions(ctx, "missing")
+	s.Require().ErrorIs(err, microblog.ErrNotFound)
+}
+
+func (s *RedisManagerSuite) TestLikePost_RefreshesCache() {
+	p, err := s.cached.AddPost(ctx, "bob", "like me")
+	s.Require().NoError(err)
+
+	for _, user := range []string{"alice", "alice", "carol"} {
+		_, err = s.cached.LikePost(ctx, p.PostId, user)
+		s.Require().NoError(err)
+	}
+	updated, err := s.cached.UnlikePost(ctx, p.PostId, "carol")
+	s.Require().NoError(err)
+	s.Require().EqualValues(1, updated.LikesCount)
+
+	bytes, err := s.redisClient.Get(ctx, cacheKeyForPost(p.PostId)).Bytes()
+	s.Require().NoError(err)
+	var cached microblog.UserPost
+	s.Require().NoError(json.Unmarshal(bytes, &cached))
+	s.Require().EqualValues(1, cached.LikesCount)
+
+	_, err = s.cached.LikePost(ctx, "missing", "alice")
+	s.Require().ErrorIs(err, microblog.ErrNotFound)
+}
+
+func (s *RedisManagerSuite) TestAddReply_CachesAndBuildsThread() {
+	root, err := s.cached.AddPost(ctx, "bob", "root")
+	s.Require().NoError(err)
+	reply, err := s.cached.AddReply(ctx, "alice", root.PostId, "reply")
+	s.Require().NoError(err)
+	nested, err := s.cached.AddReply(ctx, "bob", reply.PostId, "nested")
+	s.Require().NoError(err)
+	s.Require().Equal(root.PostId, nested.RootId)
+
+	_, err = s.redisClient.Get(ctx, cacheKeyForPost(nested.PostId)).Bytes()
+	s.Require().NoError(err)
+
+	thread, err := s.cached.GetThread(ctx, nested.PostId)
+	s.Require().NoError(err)
+	s.Require().Equal([]microblog.UserPost{root, reply, nested}, thread)
+
+	replies, next, err := s.cached.GetRepliesInPage(ctx, root.PostId, "", 10)
+	s.Require().NoError(err)
+	s.Require().Equal([]microblog.UserPost{reply}, replies)
+	s.Require().Empty(next)
+
+	_, err = s.cached.AddReply(ctx, "alice", "missing", "reply")
+	s.Require().ErrorIs(err, microblog.ErrNotFound)
+}
+
+func (s *RedisManagerSuite) TestRepost_EvictsOriginal() {
+	original, err := s.cached.AddPost(ctx, "bob", "original")
+	s.Require().NoError(err)
+
+	repost, err := s.cached.Repost(ctx, "alice", original.PostId, "")
+	s.Require().NoError(err)
+	s.Require().Equal(microblog.Repost, repost.Kind)
+	again, err := s.cached.Repost(ctx, "alice", original.PostId, "")
+	s.Require().NoError(err)
+	s.Require().Equal(repost, again)
+
+	// the cached original must not keep the stale counter
+	fetched, err := s.cached.GetPost(ctx, original.PostId)
+	s.Require().NoError(err)
+	s.Require().EqualValues(1, fetched.RepostsCount)
+
+	s.Require().NoError(s.cached.DeletePost(ctx, repost.PostId))
+	fetched, err = s.cached.GetPost(ctx, original.PostId)
+	s.Require().NoError(err)
+	s.Require().Zero(fetched.RepostsCount)
+}
+
+func (s *RedisManagerSuite) TestGetTagPostsInPage_PassThrough() {
+	tagged, err := s.cached.AddPost(ctx, "bob", "hello #World")
+	s.Require().NoError(err)
+	s.Require().Equal([]string{"world"}, tagged.Tags)
+	_, err = s.cached.AddPost(ctx, "bob", "no tags")
+	s.Require().NoError(err)
+
+	posts, next, err := s.cached.GetTagPostsInPage(ctx, "#WORLD", "", 10)
+	s.Require().NoError(err)
+	s.Require().Equal([]microblog.UserPost{tagged}, posts)
+	s.Require().Empty(next)
+
+	_, err = s.cached.ModifyPost(ctx, tagged.PostId, "bob", "hello #moon")
+	s.Require().NoError(err)
+	posts, _, err = s.cached.GetTagPostsInPage(ctx, "world", "", 10)
+	s.Require().NoError(err)
+	s.Require().Empty(posts)
+}
+
+func (s *RedisManagerSuite) TestGetMentionsInPage_PassThrough() {
+	post, err := s.cached.AddPost(ctx, "bob", "hi @a1")
+	s.Require().NoError(err)
+	s.Require().Equal([]string{"a1"}, post.Mentions)
+
+	posts, next, err := s.cached.GetMentionsInPage(ctx, "a1", "", 10)
+	s.Require().NoError(err)
+	s.Require().Equal([]microblog.UserPost{post}, posts)
+	s.Require().Empty(next)
+
+	_, err = s.cached.ModifyPost(ctx, post.PostId, "bob", "hi @b2")
+	s.Require().NoError(err)
+	posts, _, err = s.cached.GetMentionsInPage(ctx, "a1", "", 10)
+	s.Require().NoError(err)
+	s.Require().Empty(posts)
+}
+
+func (s *RedisManagerSuite) TestSearchPosts_PassThrough() {
+	post, err := s.cached.AddPost(ctx, "bob", "searching for zebras")
+	s.Require().NoError(err)
+	_, err = s.cached.AddPost(ctx, "bob", "nothing to see")
+	s.Require().NoError(err)
+
+	query, err := microblog.ParseSearchQuery("zebras")
+	s.Require().NoError(err)
+	posts, next, err := s.cached.SearchPosts(ctx, query, "", 10)
+	s.Require().NoError(err)
+	s.Require().Equal([]microblog.UserPost{post}, posts)
+	s.Require().Empty(next)
+
+	_, _, err = s.cached.SearchPosts(ctx, query, "invalid", 10)
+	s.Require().ErrorIs(err, microblog.ErrInvalidToken)
+}
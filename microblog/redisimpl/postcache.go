@@ -0,0 +1,138 @@
+package redisimpl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"micro-blog/microblog"
+	"sync"
+	"time"
+)
+
+const (
+	// missingPostTTL is how long a post that is not found is remembered as missing.
+	missingPostTTL = 30 * time.Second
+	// missingPost is the value of the cache entry of a post that is not found. It is not valid JSON,
+	// so readers of the entries that do not know about it treat it as a cache miss.
+	missingPost = "!"
+	// defaultRefreshBeta scales the early refresh window, values above 1 favor earlier refreshes.
+	defaultRefreshBeta = 1.0
+	// minLoadCost is the load time assumed for the entries written without loading them, e.g. after a write.
+	minLoadCost = 5 * time.Millisecond
+	// loadTimeout bounds a load from persistent storage, which does not end with the request that started it.
+	loadTimeout = 10 * time.Second
+)
+
+// cachedPost is the cache entry of a post. It is the JSON of the post extended with the time
+// it took to load the post from persistent storage, which scales the early refresh window.
+type cachedPost struct {
+	microblog.UserPost
+	LoadCost time.Duration `json:"_loadCost,omitempty"`
+}
+
+// loadGroup coalesces the concurrent loads of the same post, so that when a popular entry
+// expires, a single request per instance falls through to persistent storage.
+type loadGroup struct {
+	mu    sync.Mutex
+	calls map[string]*loadCall
+}
+
+type loadCall struct {
+	done chan struct{}
+	post microblog.UserPost
+	err  error
+}
+
+func newLoadGroup() *loadGroup {
+	return &loadGroup{calls: make(map[string]*loadCall)}
+}
+
+// do starts load, unless a load of the same post is in flight, and awaits its result. The load runs
+// in background, so that it is not canceled along with the request that started it while others await it.
+func (g *loadGroup) do(ctx context.Context, postID string, load func(ctx context.Context) (microblog.UserPost, error)) (microblog.UserPost, error) {
+	g.mu.Lock()
+	call, ok := g.calls[postID]
+	if !ok {
+		call = &loadCall{done: make(chan struct{})}
+		g.calls[postID] = call
+		go func() {
+			loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), loadTimeout)
+			defer cancel()
+			call.post, call.err = load(loadCtx)
+			g.mu.Lock()
+			delete(g.calls, postID)
+			g.mu.Unlock()
+			close(call.done)
+		}()
+	}
+	g.mu.Unlock()
+	select {
+	case <-call.done:
+		return call.post, call.err
+	case <-ctx.Done():
+		return microblog.UserPost{}, ctx.Err()
+	}
+}
+
+// GetPost uses read-through cache backed by persistent storage. An entry close to its expiration
+// is refreshed early with a probability growing as the expiration nears (the XFetch algorithm),
+// so that popular entries are reloaded by a single request before they expire for everyone.
+// Posts that are not found are cached as missing for missingPostTTL.
+func (r RedisManager) GetPost(ctx context.Context, postID string) (microblog.UserPost, error) {
+	key := cacheKeyForPost(postID)
+	pipe := r.client.Pipeline()
+	get := pipe.Get(ctx, key)
+	ttl := pipe.PTTL(ctx, key)
+	if _, err := pipe.Exec(ctx); err == nil {
+		if get.Val() == missingPost {
+			return microblog.UserPost{}, microblog.ErrNotFound
+		}
+		var cached cachedPost
+		if json.Unmarshal([]byte(get.Val()), &cached) == nil && !r.refreshEarly(ttl.Val(), cached.LoadCost) {
+			return cached.UserPost, nil
+		}
+	}
+	return r.loadPost(ctx, postID)
+}
+
+// refreshEarly decides if an entry expiring in ttl, which took cost to load, is refreshed now.
+func (r RedisManager) refreshEarly(ttl time.Duration, cost time.Duration) bool {
+	if ttl < 0 {
+		// the entry has no expiration
+		return false
+	}
+	cost = max(cost, minLoadCost)
+	return -float64(cost)*r.refreshBeta*math.Log(1-rand.Float64()) >= float64(ttl)
+}
+
+// loadPost reads the post from persistent storage and caches it, coalescing concurrent loads.
+func (r RedisManager) loadPost(ctx context.Context, postID string) (microblog.UserPost, error) {
+	return r.loads.do(ctx, postID, func(ctx context.Context) (microblog.UserPost, error) {
+		start := time.Now()
+		post, err := r.persistentManager.GetPost(ctx, postID)
+		if errors.Is(err, microblog.ErrNotFound) {
+			_ = r.client.Set(ctx, cacheKeyForPost(postID), missingPost, missingPostTTL).Err()
+		}
+		if err != nil {
+			return post, err
+		}
+		r.cacheLoadedPost(ctx, post, time.Since(start))
+		return post, nil
+	})
+}
+
+// cachePost stores the post written through to persistent storage.
+func (r RedisManager) cachePost(ctx context.Context, post microblog.UserPost) {
+	r.cacheLoadedPost(ctx, post, 0)
+}
+
+func (r RedisManager) cacheLoadedPost(ctx context.Context, post microblog.UserPost, cost time.Duration) {
+	if r.client == nil {
+		return
+	}
+	if raw, mErr := json.Marshal(cachedPost{UserPost: post, LoadCost: cost}); mErr == nil {
+		_ = r.client.Set(ctx, cacheKeyForPost(post.PostId), raw, postCacheTTL).Err()
+	}
+}
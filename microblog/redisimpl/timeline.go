@@ -0,0 +1,106 @@
+package redisimpl
+
+import (
+	"context"
+	"errors"
+	"micro-blog/microblog"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Timelines hold the feedCapacity most recent posts of a user in the format of the feeds.
+// They serve the first pages of GetPostsInPage, the older pages are read from persistent storage.
+
+// addToTimeline pushes a freshly created post to the materialized timeline of its author.
+func (r RedisManager) addToTimeline(ctx context.Context, post microblog.UserPost) {
+	pipe := r.client.Pipeline()
+	_ = appendToFeed.Eval(ctx, pipe, []string{cacheKeyForTimeline(post.AuthorId)}, feedScore(post), post.PostId, r.feedCapacity, feedTruncated)
+	bumpVersion(ctx, pipe, cacheKeyForTimelineVersion(post.AuthorId))
+	_, _ = pipe.Exec(ctx)
+}
+
+// ensureTimeline rebuilds the timeline of userId from persistent storage if it is not materialized
+// and reports whether it is.
+func (r RedisManager) ensureTimeline(ctx context.Context, userId string) (bool, error) {
+	return r.ensureSortedSet(ctx, cacheKeyForTimeline(userId), cacheKeyForTimelineVersion(userId), func(token string, size uint8) ([]microblog.UserPost, string, error) {
+		return r.persistentManager.GetPostsInPage(ctx, userId, token, size)
+	})
+}
+
+// GetPostsInPage serves the pages within the materialized timeline of the user from Redis, hydrating
+// the posts through the post cache. The pages past it, or any page if Redis fails, are read from
+// persistent storage. Both use the same page tokens, so paging can move from one to the other.
+func (r RedisManager) GetPostsInPage(ctx context.Context, userId string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	if token != "" {
+		if _, _, err := microblog.DecodePostCursor(token); err != nil {
+			return nil, "", err
+		}
+	}
+	if size == 0 {
+		return nil, "", nil
+	}
+	if posts, next, ok := r.timelinePage(ctx, userId, token, size); ok {
+		return posts, next, nil
+	}
+	return r.persistentManager.GetPostsInPage(ctx, userId, token, size)
+}
+
+// timelinePage reads the page from the timeline. It reports false if the timeline
+// is not materialized, fails to be read or does not hold the whole page.
+func (r RedisManager) timelinePage(ctx context.Context, userId string, token string, size uint8) ([]microblog.UserPost, string, bool) {
+	if materialized, err := r.ensureTimeline(ctx, userId); err != nil || !materialized {
+		return nil, "", false
+	}
+	key := cacheKeyForTimeline(userId)
+	var maxScore int64
+	var lastPostId string
+	if token != "" {
+		createdAt, postId, _ := microblog.DecodePostCursor(token)
+		maxScore, lastPostId = createdAt.UnixMicro(), postId
+	}
+	pipe := r.client.Pipeline()
+	sentinel := pipe.ZScore(ctx, key, feedSentinel)
+	truncated := pipe.ZScore(ctx, key, feedTruncated)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, "", false
+	}
+	if sentinel.Err() != nil {
+		// the timeline is not materialized
+		return nil, "", false
+	}
+	// the size+1-th entry tells if there is a next page
+	limit := int64(size) + 1
+	entries, err := r.revRangeAfter(ctx, key, maxScore, lastPostId, limit)
+	if err != nil {
+		return nil, "", false
+	}
+
+	ids := make([]string, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.Member.(string)
+	}
+	hasMore := len(ids) > int(size)
+	if !hasMore {
+		// the rest of the timeline was read, which is all there is only if it was not trimmed
+		if truncated.Err() == nil {
+			return nil, "", false
+		}
+	} else {
+		ids = ids[:size]
+	}
+	if len(ids) == 0 {
+		return nil, "", true
+	}
+
+	posts := r.hydratePosts(ctx, ids)
+	if len(posts) < len(ids) {
+		// the timeline refers to posts deleted behind its back
+		_ = r.client.Del(ctx, key).Err()
+		return nil, "", false
+	}
+	if !hasMore {
+		return posts, "", true
+	}
+	last := posts[len(posts)-1]
+	return posts, microblog.EncodePostCursor(last.CreatedAt, last.PostId), true
+}
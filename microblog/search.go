@@ -0,0 +1,227 @@
+package microblog
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// wordPattern matches a word of the text, the unit of full-text search.
+var wordPattern = regexp.MustCompile(`[\p{L}\p{N}_]+`)
+
+// searchDateLayouts are the accepted formats of the before: and after: filters.
+var searchDateLayouts = []string{time.RFC3339, time.DateOnly}
+
+// SearchQuery is a parsed full-text search query.
+//
+// A post matches the query if it contains every phrase. A query without phrases matches
+// posts containing any of the terms. Terms also contribute to the rank of the matching posts.
+type SearchQuery struct {
+	Terms   []string
+	Phrases [][]string
+	// AuthorId restricts the search to the posts of the user, if not empty.
+	AuthorId string
+	// Before restricts the search to the posts created before the moment, if not zero.
+	Before time.Time
+	// After restricts the search to the posts created at or after the moment, if not zero.
+	After time.Time
+}
+
+// TextFragment is a part of a post text, either matching a search query or not.
+type TextFragment struct {
+	Text  string
+	Match bool
+}
+
+type wordSpan struct {
+	word       string
+	start, end int
+}
+
+// Tokenize splits the text into lowercase words.
+func Tokenize(text string) []string {
+	spans := tokenize(text)
+	words := make([]string, len(spans))
+	for i, span := range spans {
+		words[i] = span.word
+	}
+	return words
+}
+
+func tokenize(text string) []wordSpan {
+	var spans []wordSpan
+	for _, loc := range wordPattern.FindAllStringIndex(text, -1) {
+		spans = append(spans, wordSpan{word: strings.ToLower(text[loc[0]:loc[1]]), start: loc[0], end: loc[1]})
+	}
+	return spans
+}
+
+// ParseSearchQuery parses a query of words, quoted phrases and author:, before: and after: filters,
+// e.g. `"hello world" go author:1a after:2024-01-31`. Dates are given either as RFC 3339 timestamps
+// or as days in UTC. ErrInvalidQuery is returned if a filter is malformed or there is nothing to search for.
+func ParseSearchQuery(query string) (SearchQuery, error) {
+	var q SearchQuery
+	var terms []string
+	rest := strings.TrimSpace(query)
+	for rest != "" {
+		var part string
+		if strings.HasPrefix(rest, `"`) {
+			part, rest, _ = strings.Cut(rest[1:], `"`)
+			if words := Tokenize(part); len(words) > 1 {
+				q.Phrases = append(q.Phrases, words)
+			} else {
+				terms = append(terms, words...)
+			}
+		} else {
+			end := strings.IndexFunc(rest, unicode.IsSpace)
+			if end < 0 {
+				end = len(rest)
+			}
+			part, rest = rest[:end], rest[end:]
+			isFilter, err := q.parseFilter(part)
+			if err != nil {
+				return SearchQuery{}, err
+			}
+			if !isFilter {
+				terms = append(terms, Tokenize(part)...)
+			}
+		}
+		rest = strings.TrimSpace(rest)
+	}
+	for _, term := range terms {
+		if !slices.Contains(q.Terms, term) {
+			q.Terms = append(q.Terms, term)
+		}
+	}
+	if len(q.Terms) == 0 && len(q.Phrases) == 0 {
+		return SearchQuery{}, ErrInvalidQuery
+	}
+	return q, nil
+}
+
+// parseFilter applies the part of the query if it is a filter and reports whether it is.
+func (q *SearchQuery) parseFilter(part string) (bool, error) {
+	key, value, _ := strings.Cut(part, ":")
+	switch key {
+	case "author":
+		if !userIdPattern.MatchString(value) {
+			return true, ErrInvalidQuery
+		}
+		q.AuthorId = value
+	case "before":
+		moment, err := parseSearchDate(value)
+		if err != nil {
+			return true, err
+		}
+		q.Before = moment
+	case "after":
+		moment, err := parseSearchDate(value)
+		if err != nil {
+			return true, err
+		}
+		q.After = moment
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+func parseSearchDate(value string) (time.Time, error) {
+	for _, layout := range searchDateLayouts {
+		if moment, err := time.Parse(layout, value); err == nil {
+			return moment.UTC(), nil
+		}
+	}
+	return time.Time{}, ErrInvalidQuery
+}
+
+// Words returns the distinct words of the terms and phrases.
+func (q SearchQuery) Words() []string {
+	words := slices.Clone(q.Terms)
+	for _, phrase := range q.Phrases {
+		for _, word := range phrase {
+			if !slices.Contains(words, word) {
+				words = append(words, word)
+			}
+		}
+	}
+	return words
+}
+
+// MatchesFilters reports whether the post satisfies the author and creation time restrictions.
+func (q SearchQuery) MatchesFilters(post UserPost) bool {
+	if q.AuthorId != "" && post.AuthorId != q.AuthorId {
+		return false
+	}
+	if !q.Before.IsZero() && !post.CreatedAt.Before(q.Before) {
+		return false
+	}
+	return q.After.IsZero() || !post.CreatedAt.Before(q.After)
+}
+
+// MatchesWords reports whether the tokenized text matches the terms and phrases of the query.
+func (q SearchQuery) MatchesWords(words []string) bool {
+	if len(q.Phrases) == 0 {
+		return slices.ContainsFunc(words, func(word string) bool { return slices.Contains(q.Terms, word) })
+	}
+	for _, phrase := range q.Phrases {
+		if phraseIndex(words, phrase, 0) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// phraseIndex returns the index of the first occurrence of the phrase in words at or after from, or -1.
+func phraseIndex(words []string, phrase []string, from int) int {
+	for i := from; i+len(phrase) <= len(words); i++ {
+		if slices.Equal(words[i:i+len(phrase)], phrase) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Highlight splits the text into fragments, marking the occurrences of the terms and phrases of the query.
+// Overlapping occurrences are merged into a single fragment.
+func (q SearchQuery) Highlight(text string) []TextFragment {
+	spans := tokenize(text)
+	words := make([]string, len(spans))
+	for i, span := range spans {
+		words[i] = span.word
+	}
+
+	var matches [][2]int
+	for _, span := range spans {
+		if slices.Contains(q.Terms, span.word) {
+			matches = append(matches, [2]int{span.start, span.end})
+		}
+	}
+	for _, phrase := range q.Phrases {
+		for i := phraseIndex(words, phrase, 0); i >= 0; i = phraseIndex(words, phrase, i+1) {
+			matches = append(matches, [2]int{spans[i].start, spans[i+len(phrase)-1].end})
+		}
+	}
+	slices.SortFunc(matches, func(a, b [2]int) int { return a[0] - b[0] })
+
+	var fragments []TextFragment
+	pos := 0
+	for i := 0; i < len(matches); i++ {
+		start, end := matches[i][0], matches[i][1]
+		for i+1 < len(matches) && matches[i+1][0] <= end {
+			i++
+			end = max(end, matches[i][1])
+		}
+		if start > pos {
+			fragments = append(fragments, TextFragment{Text: text[pos:start]})
+		}
+		fragments = append(fragments, TextFragment{Text: text[start:end], Match: true})
+		pos = end
+	}
+	if pos < len(text) {
+		fragments = append(fragments, TextFragment{Text: text[pos:]})
+	}
+	return fragments
+}
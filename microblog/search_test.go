@@ -0,0 +1,58 @@
+package microblog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	cases := map[string]SearchQuery{
+		"Go go REDIS":         {Terms: []string{"go", "redis"}},
+		`"Hello, world" go`:   {Terms: []string{"go"}, Phrases: [][]string{{"hello", "world"}}},
+		`"single" "unclosed`:  {Terms: []string{"single", "unclosed"}},
+		"go author:1a":        {Terms: []string{"go"}, AuthorId: "1a"},
+		"go after:2024-01-31": {Terms: []string{"go"}, After: time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)},
+		"go before:2024-01-31T10:00:00+02:00": {
+			Terms:  []string{"go"},
+			Before: time.Date(2024, 1, 31, 8, 0, 0, 0, time.UTC),
+		},
+		"unknown:filter": {Terms: []string{"unknown", "filter"}},
+	}
+	for text, expected := range cases {
+		query, err := ParseSearchQuery(text)
+		require.NoError(t, err, text)
+		require.Equal(t, expected, query, text)
+	}
+
+	for _, text := range []string{"", `  "" `, "author:1a", "go author:Bob", "go before:yesterday"} {
+		_, err := ParseSearchQuery(text)
+		require.ErrorIs(t, err, ErrInvalidQuery, text)
+	}
+}
+
+func TestSearchQuery_MatchesWords(t *testing.T) {
+	terms, _ := ParseSearchQuery("go redis")
+	require.True(t, terms.MatchesWords(Tokenize("Learning Go")))
+	require.False(t, terms.MatchesWords(Tokenize("Learning Golang")))
+
+	phrase, _ := ParseSearchQuery(`"hello world" go`)
+	require.True(t, phrase.MatchesWords(Tokenize("Hello, World!")))
+	require.False(t, phrase.MatchesWords(Tokenize("world hello go")))
+}
+
+func TestSearchQuery_Highlight(t *testing.T) {
+	query, _ := ParseSearchQuery(`go "hello world"`)
+	require.Equal(t, []TextFragment{
+		{Text: "Say "},
+		{Text: "Hello, world", Match: true},
+		{Text: " in "},
+		{Text: "Go", Match: true},
+		{Text: ", not golang"},
+	}, query.Highlight("Say Hello, world in Go, not golang"))
+
+	query, _ = ParseSearchQuery(`"a b" "b c"`)
+	require.Equal(t, []TextFragment{{Text: "a b c", Match: true}, {Text: " d"}}, query.Highlight("a b c d"))
+	require.Equal(t, []TextFragment{{Text: "nothing"}}, query.Highlight("nothing"))
+}
@@ -0,0 +1,685 @@
+package sqliteimpl
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"micro-blog/microblog"
+	"micro-blog/microblog/idgen"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// postColumns are the columns scanned by scanPost, in order.
+const postColumns = `id, author_id, text, created_at, last_modified_at, likes_count,
+	in_reply_to, root_id, kind, repost_of, reposts_count, tags, mentions`
+
+type SQLiteManager struct {
+	db *sql.DB
+}
+
+// NewSQLiteManager opens the database file at path, creating it if needed, and migrates its schema.
+// The database is used in WAL mode, so readers do not block the writer and vice versa.
+func NewSQLiteManager(path string) *SQLiteManager {
+	ctx := context.Background()
+	params := url.Values{
+		"_pragma": {"journal_mode(WAL)", "synchronous(NORMAL)", "foreign_keys(1)", "busy_timeout(5000)"},
+		// take the write lock when a transaction begins, so that transactions reading
+		// before writing wait for each other instead of failing with SQLITE_BUSY
+		"_txlock": {"immediate"},
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		panic(err)
+	}
+	if err := migrate(ctx, db); err != nil {
+		panic(err)
+	}
+	return &SQLiteManager{db: db}
+}
+
+// Close closes the database.
+func (m *SQLiteManager) Close() error {
+	return m.db.Close()
+}
+
+func (m *SQLiteManager) IsReady(ctx context.Context) bool {
+	return m.db.PingContext(ctx) == nil
+}
+
+func storageError() error {
+	return fmt.Errorf("something went wrong - %w", microblog.ErrStorage)
+}
+
+// inTx runs fn in a transaction, committing it if fn succeeds.
+func inTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// querier is implemented by both the database and transactions.
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// scanPost reads a row of postColumns followed by the extra columns.
+func scanPost(row interface{ Scan(dest ...any) error }, extra ...any) (microblog.UserPost, error) {
+	var post microblog.UserPost
+	var id, createdAt int64
+	var lastModifiedAt, inReplyTo, rootId, repostOf sql.NullInt64
+	var tags, mentions string
+	dest := []any{
+		&id, &post.AuthorId, &post.Text, &createdAt, &lastModifiedAt, &post.LikesCount,
+		&inReplyTo, &rootId, &post.Kind, &repostOf, &post.RepostsCount, &tags, &mentions,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return microblog.UserPost{}, err
+	}
+	post.PostId = formatId(id)
+	post.CreatedAt = time.Unix(0, createdAt).UTC()
+	if lastModifiedAt.Valid {
+		post.LastModifiedAt = time.Unix(0, lastModifiedAt.Int64).UTC()
+	}
+	post.InReplyTo = formatNullId(inReplyTo)
+	post.RootId = formatNullId(rootId)
+	post.RepostOf = formatNullId(repostOf)
+	if err := json.Unmarshal([]byte(tags), &post.Tags); err != nil {
+		return microblog.UserPost{}, err
+	}
+	if err := json.Unmarshal([]byte(mentions), &post.Mentions); err != nil {
+		return microblog.UserPost{}, err
+	}
+	if len(post.Tags) == 0 {
+		post.Tags = nil
+	}
+	if len(post.Mentions) == 0 {
+		post.Mentions = nil
+	}
+	return post, nil
+}
+
+// Post IDs are stored as the numbers generated by idgen, so that the rowid keeps the posts in their order.
+// The posts created before that keep their AUTOINCREMENT rowids, which are formatted in decimal like
+// they used to be. The rowids never get close to legacyIdLimit, while idgen generates greater numbers
+// since a few weeks after its epoch, long before it was introduced, so the two kinds of IDs do not overlap.
+const legacyIdLimit = 1 << 53
+
+func formatId(id int64) string {
+	if id < legacyIdLimit {
+		return strconv.FormatInt(id, 10)
+	}
+	return idgen.Format(id)
+}
+
+func formatNullId(id sql.NullInt64) string {
+	if !id.Valid {
+		return ""
+	}
+	return formatId(id.Int64)
+}
+
+// parseId converts a post ID to its key in the posts table. A malformed ID is mapped to 0,
+// which no post has, so that it is not found like any other missing post.
+func parseId(postID string) int64 {
+	if id, err := idgen.Parse(postID); err == nil && id >= legacyIdLimit {
+		return id
+	}
+	if id, err := strconv.ParseInt(postID, 10, 64); err == nil && id > 0 && id < legacyIdLimit && formatId(id) == postID {
+		return id
+	}
+	return 0
+}
+
+// nullableId maps the empty post ID to NULL.
+func nullableId(postID string) any {
+	if postID == "" {
+		return nil
+	}
+	return parseId(postID)
+}
+
+func marshalList(list []string) string {
+	if list == nil {
+		return "[]"
+	}
+	raw, _ := json.Marshal(list)
+	return string(raw)
+}
+
+// queryPost runs a query returning at most one row of postColumns.
+// ErrNotFound is returned if there is no row.
+func queryPost(ctx context.Context, q querier, query string, args ...any) (microblog.UserPost, error) {
+	post, err := scanPost(q.QueryRowContext(ctx, query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return microblog.UserPost{}, microblog.ErrNotFound
+	}
+	if err != nil {
+		return microblog.UserPost{}, storageError()
+	}
+	return post, nil
+}
+
+func (m *SQLiteManager) AddPost(ctx context.Context, userId string, text string) (microblog.UserPost, error) {
+	var post microblog.UserPost
+	err := inTx(ctx, m.db, func(tx *sql.Tx) error {
+		var err error
+		post, err = insertPost(ctx, tx, microblog.UserPost{AuthorId: userId, Text: text})
+		return err
+	})
+	return post, err
+}
+
+func (m *SQLiteManager) AddReply(ctx context.Context, userId string, inReplyTo string, text string) (microblog.UserPost, error) {
+	var post microblog.UserPost
+	err := inTx(ctx, m.db, func(tx *sql.Tx) error {
+		parent, err := queryPost(ctx, tx, "SELECT "+postColumns+" FROM posts WHERE id = ?", parseId(inReplyTo))
+		if err != nil {
+			return err
+		}
+		post, err = insertPost(ctx, tx, microblog.UserPost{
+			AuthorId:  userId,
+			Text:      text,
+			InReplyTo: parent.PostId,
+			RootId:    parent.ThreadRootId(),
+		})
+		return err
+	})
+	return post, err
+}
+
+// insertPost stores the post with a new ID and the current time as its creation time
+// and indexes its hashtags and mentions.
+func insertPost(ctx context.Context, tx *sql.Tx, post microblog.UserPost) (microblog.UserPost, error) {
+	id := idgen.Next()
+	tags := microblog.ExtractHashtags(post.Text)
+	mentions := microblog.ExtractMentions(post.Text)
+	inserted, err := queryPost(ctx, tx, `
+		INSERT INTO posts (id, author_id, text, created_at, in_reply_to, root_id, kind, repost_of, tags, mentions)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING `+postColumns,
+		id, post.AuthorId, post.Text, time.Now().UTC().UnixNano(),
+		nullableId(post.InReplyTo), nullableId(post.RootId), string(post.Kind), nullableId(post.RepostOf),
+		marshalList(tags), marshalList(mentions),
+	)
+	if err != nil {
+		return microblog.UserPost{}, err
+	}
+	if err := indexText(ctx, tx, id, tags, mentions); err != nil {
+		return microblog.UserPost{}, err
+	}
+	return inserted, nil
+}
+
+// indexText adds the post to the index tables of hashtags and mentions.
+func indexText(ctx context.Context, tx *sql.Tx, postID int64, tags []string, mentions []string) error {
+	for _, tag := range tags {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO post_tags (tag, post_id) VALUES (?, ?)", tag, postID); err != nil {
+			return storageError()
+		}
+	}
+	for _, userId := range mentions {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO post_mentions (user_id, post_id) VALUES (?, ?)", userId, postID); err != nil {
+			return storageError()
+		}
+	}
+	return nil
+}
+
+func (m *SQLiteManager) GetPost(ctx context.Context, postID string) (microblog.UserPost, error) {
+	return queryPost(ctx, m.db, "SELECT "+postColumns+" FROM posts WHERE id = ?", parseId(postID))
+}
+
+func (m *SQLiteManager) GetPostsInPage(ctx context.Context, userId string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	return m.findPostsInPage(ctx, "author_id = ?", []any{userId}, token, size)
+}
+
+func (m *SQLiteManager) GetFeedInPage(ctx context.Context, userId string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	return m.findPostsInPage(ctx, "author_id IN (SELECT followee_id FROM subscriptions WHERE follower_id = ?)", []any{userId}, token, size)
+}
+
+func (m *SQLiteManager) GetRepliesInPage(ctx context.Context, postID string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	if _, err := m.GetPost(ctx, postID); err != nil {
+		return nil, "", err
+	}
+	return m.findPostsInPage(ctx, "in_reply_to = ?", []any{parseId(postID)}, token, size)
+}
+
+func (m *SQLiteManager) GetTagPostsInPage(ctx context.Context, tag string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	return m.findPostsInPage(ctx, "id IN (SELECT post_id FROM post_tags WHERE tag = ?)", []any{microblog.NormalizeHashtag(tag)}, token, size)
+}
+
+func (m *SQLiteManager) GetMentionsInPage(ctx context.Context, userId string, token string, size uint8) ([]microblog.UserPost, string, error) {
+	return m.findPostsInPage(ctx, "id IN (SELECT post_id FROM post_mentions WHERE user_id = ?)", []any{userId}, token, size)
+}
+
+// findPostsInPage returns a page of the posts satisfying the condition in reverse-chronological order.
+// The token holds the creation time and ID of the last post of the previous page, so the keyset
+// (created_at, id) is used to continue. Posts created at the same time are ordered by ID.
+func (m *SQLiteManager) findPostsInPage(ctx context.Context, condition string, args []any, token string, size uint8) ([]microblog.UserPost, string, error) {
+	if token != "" {
+		createdAt, lastPostId, err := decodeCursor(token)
+		if err != nil {
+			return nil, "", err
+		}
+		condition += " AND (created_at, id) < (?, ?)"
+		args = append(args, createdAt, lastPostId)
+	}
+	args = append(args, int(size)+1)
+	rows, err := m.db.QueryContext(ctx,
+		"SELECT "+postColumns+" FROM posts WHERE "+condition+" ORDER BY created_at DESC, id DESC LIMIT ?",
+		args...,
+	)
+	if err != nil {
+		return nil, "", storageError()
+	}
+	posts, err := collectPosts(rows)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(posts) <= int(size) {
+		return posts, "", nil
+	}
+	posts = posts[:size]
+	if size == 0 {
+		return posts, "", nil
+	}
+	return posts, microblog.EncodePostCursor(posts[len(posts)-1].CreatedAt, posts[len(posts)-1].PostId), nil
+}
+
+func collectPosts(rows *sql.Rows) ([]microblog.UserPost, error) {
+	defer rows.Close()
+	var posts []microblog.UserPost
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, storageError()
+		}
+		posts = append(posts, post)
+	}
+	if rows.Err() != nil {
+		return nil, storageError()
+	}
+	return posts, nil
+}
+
+// decodeCursor returns the creation time in Unix nanoseconds and the ID of the post the token points to.
+func decodeCursor(token string) (int64, int64, error) {
+	createdAt, rawId, err := microblog.DecodePostCursor(token)
+	if err != nil {
+		return 0, 0, err
+	}
+	id := parseId(rawId)
+	if id == 0 {
+		return 0, 0, microblog.ErrInvalidToken
+	}
+	return createdAt.UnixNano(), id, nil
+}
+
+func (m *SQLiteManager) GetThread(ctx context.Context, postID string) ([]microblog.UserPost, error) {
+	rows, err := m.db.QueryContext(ctx, `
+		WITH RECURSIVE thread (id, depth) AS (
+			SELECT id, 0 FROM posts WHERE id = ?
+			UNION ALL
+			SELECT posts.in_reply_to, thread.depth + 1
+			FROM posts JOIN thread ON posts.id = thread.id
+			WHERE posts.in_reply_to IS NOT NULL
+		)
+		SELECT `+postColumns+` FROM posts JOIN thread USING (id) ORDER BY thread.depth DESC`,
+		parseId(postID),
+	)
+	if err != nil {
+		return nil, storageError()
+	}
+	// the walk stops at the ID of a deleted ancestor, which is not joined, so the thread is cut there
+	thread, err := collectPosts(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(thread) == 0 {
+		return nil, microblog.ErrNotFound
+	}
+	return thread, nil
+}
+
+func (m *SQLiteManager) DeletePost(ctx context.Context, postID string) error {
+	return inTx(ctx, m.db, func(tx *sql.Tx) error {
+		var repostOf sql.NullInt64
+		err := tx.QueryRowContext(ctx, "DELETE FROM posts WHERE id = ? RETURNING repost_of", parseId(postID)).Scan(&repostOf)
+		if errors.Is(err, sql.ErrNoRows) {
+			return microblog.ErrNotFound
+		}
+		if err != nil {
+			return storageError()
+		}
+		// revisions, likes, hashtags and mentions are removed by the cascade
+		if repostOf.Valid {
+			if _, err := tx.ExecContext(ctx, "UPDATE posts SET reposts_count = reposts_count - 1 WHERE id = ?", repostOf.Int64); err != nil {
+				return storageError()
+			}
+		}
+		return nil
+	})
+}
+
+func (m *SQLiteManager) ModifyPost(ctx context.Context, postID string, editorId string, text string) (microblog.UserPost, error) {
+	var updated microblog.UserPost
+	id := parseId(postID)
+	err := inTx(ctx, m.db, func(tx *sql.Tx) error {
+		modifyTime := time.Now().UTC().UnixNano()
+		var previous string
+		err := tx.QueryRowContext(ctx, "SELECT text FROM posts WHERE id = ?", id).Scan(&previous)
+		if errors.Is(err, sql.ErrNoRows) {
+			return microblog.ErrNotFound
+		}
+		if err != nil {
+			return storageError()
+		}
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO post_revisions (post_id, text, editor_id, edited_at) VALUES (?, ?, ?, ?)",
+			id, previous, editorId, modifyTime,
+		)
+		if err != nil {
+			return storageError()
+		}
+
+		tags := microblog.ExtractHashtags(text)
+		mentions := microblog.ExtractMentions(text)
+		updated, err = queryPost(ctx, tx, `
+			UPDATE posts SET text = ?, tags = ?, mentions = ?, last_modified_at = ?
+			WHERE id = ?
+			RETURNING `+postColumns,
+			text, marshalList(tags), marshalList(mentions), modifyTime, id,
+		)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM post_tags WHERE post_id = ?", id); err != nil {
+			return storageError()
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM post_mentions WHERE post_id = ?", id); err != nil {
+			return storageError()
+		}
+		return indexText(ctx, tx, id, tags, mentions)
+	})
+	return updated, err
+}
+
+func (m *SQLiteManager) GetPostRevisions(ctx context.Context, postID string) ([]microblog.PostRevision, error) {
+	if _, err := m.GetPost(ctx, postID); err != nil {
+		return nil, err
+	}
+	rows, err := m.db.QueryContext(ctx,
+		"SELECT post_id, text, editor_id, edited_at FROM post_revisions WHERE post_id = ? ORDER BY id DESC",
+		parseId(postID),
+	)
+	if err != nil {
+		return nil, storageError()
+	}
+	defer rows.Close()
+	var revisions []microblog.PostRevision
+	for rows.Next() {
+		var revision microblog.PostRevision
+		var id, editedAt int64
+		if err := rows.Scan(&id, &revision.Text, &revision.EditorId, &editedAt); err != nil {
+			return nil, storageError()
+		}
+		revision.PostId = formatId(id)
+		revision.EditedAt = time.Unix(0, editedAt).UTC()
+		revisions = append(revisions, revision)
+	}
+	if rows.Err() != nil {
+		return nil, storageError()
+	}
+	return revisions, nil
+}
+
+func (m *SQLiteManager) Repost(ctx context.Context, userId string, postID string, quote string) (microblog.UserPost, error) {
+	var repost microblog.UserPost
+	err := inTx(ctx, m.db, func(tx *sql.Tx) error {
+		original, err := queryPost(ctx, tx, "SELECT "+postColumns+" FROM posts WHERE id = ?", parseId(postID))
+		if err != nil {
+			return err
+		}
+		if original.Kind == microblog.Repost {
+			if original, err = queryPost(ctx, tx, "SELECT "+postColumns+" FROM posts WHERE id = ?", parseId(original.RepostOf)); err != nil {
+				return err
+			}
+		}
+
+		kind := microblog.QuotePost
+		if quote == "" {
+			kind = microblog.Repost
+			repost, err = queryPost(ctx, tx,
+				"SELECT "+postColumns+" FROM posts WHERE repost_of = ? AND author_id = ? AND kind = ?",
+				parseId(original.PostId), userId, string(microblog.Repost),
+			)
+			if err == nil || !errors.Is(err, microblog.ErrNotFound) {
+				// the post has already been reposted by the user
+				return err
+			}
+		}
+		repost, err = insertPost(ctx, tx, microblog.UserPost{AuthorId: userId, Text: quote, Kind: kind, RepostOf: original.PostId})
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE posts SET reposts_count = reposts_count + 1 WHERE id = ?", parseId(original.PostId)); err != nil {
+			return storageError()
+		}
+		return nil
+	})
+	return repost, err
+}
+
+func (m *SQLiteManager) LikePost(ctx context.Context, postID string, userId string) (microblog.UserPost, error) {
+	return m.changeLike(ctx, postID,
+		"INSERT OR IGNORE INTO likes (post_id, user_id) SELECT id, ? FROM posts WHERE id = ?",
+		"UPDATE posts SET likes_count = likes_count + 1 WHERE id = ?",
+		userId,
+	)
+}
+
+func (m *SQLiteManager) UnlikePost(ctx context.Context, postID string, userId string) (microblog.UserPost, error) {
+	return m.changeLike(ctx, postID,
+		"DELETE FROM likes WHERE user_id = ? AND post_id = ?",
+		"UPDATE posts SET likes_count = likes_count - 1 WHERE id = ?",
+		userId,
+	)
+}
+
+// changeLike runs the statement changing the like of userId and, if it changed anything,
+// the statement updating the counter, in a single transaction.
+func (m *SQLiteManager) changeLike(ctx context.Context, postID string, change string, count string, userId string) (microblog.UserPost, error) {
+	var post microblog.UserPost
+	id := parseId(postID)
+	err := inTx(ctx, m.db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, change, userId, id)
+		if err != nil {
+			return storageError()
+		}
+		if changed, _ := res.RowsAffected(); changed > 0 {
+			if _, err := tx.ExecContext(ctx, count, id); err != nil {
+				return storageError()
+			}
+		}
+		post, err = queryPost(ctx, tx, "SELECT "+postColumns+" FROM posts WHERE id = ?", id)
+		return err
+	})
+	return post, err
+}
+
+func (m *SQLiteManager) Subscribe(ctx context.Context, userId string, targetId string) error {
+	if userId == targetId {
+		return microblog.ErrSelfSubscription
+	}
+	_, err := m.db.ExecContext(ctx,
+		"INSERT OR IGNORE INTO subscriptions (follower_id, followee_id) VALUES (?, ?)",
+		userId, targetId,
+	)
+	if err != nil {
+		return storageError()
+	}
+	return nil
+}
+
+func (m *SQLiteManager) Unsubscribe(ctx context.Context, userId string, targetId string) error {
+	if userId == targetId {
+		return microblog.ErrSelfSubscription
+	}
+	_, err := m.db.ExecContext(ctx, "DELETE FROM subscriptions WHERE follower_id = ? AND followee_id = ?", userId, targetId)
+	if err != nil {
+		return storageError()
+	}
+	return nil
+}
+
+func (m *SQLiteManager) GetFollowers(ctx context.Context, userId string, token string, size uint8) ([]string, string, error) {
+	return m.usersInPage(ctx, "SELECT follower_id FROM subscriptions WHERE followee_id = ? AND follower_id > ? ORDER BY follower_id LIMIT ?", userId, token, size)
+}
+
+func (m *SQLiteManager) GetFollowees(ctx context.Context, userId string, token string, size uint8) ([]string, string, error) {
+	return m.usersInPage(ctx, "SELECT followee_id FROM subscriptions WHERE follower_id = ? AND followee_id > ? ORDER BY followee_id LIMIT ?", userId, token, size)
+}
+
+// usersInPage runs a query listing user IDs in ascending order after the user the token points to.
+// The token of the next page points to the last returned user ID, or is empty if there are no more users.
+func (m *SQLiteManager) usersInPage(ctx context.Context, query string, userId string, token string, size uint8) ([]string, string, error) {
+	var lastUserId string
+	if token != "" {
+		var err error
+		if lastUserId, err = microblog.DecodeUserCursor(token); err != nil {
+			return nil, "", err
+		}
+	}
+	rows, err := m.db.QueryContext(ctx, query, userId, lastUserId, int(size)+1)
+	if err != nil {
+		return nil, "", storageError()
+	}
+	defer rows.Close()
+	var users []string
+	for rows.Next() {
+		var user string
+		if err := rows.Scan(&user); err != nil {
+			return nil, "", storageError()
+		}
+		users = append(users, user)
+	}
+	if rows.Err() != nil {
+		return nil, "", storageError()
+	}
+	if len(users) <= int(size) {
+		return users, "", nil
+	}
+	users = users[:size]
+	if size == 0 {
+		return users, "", nil
+	}
+	return users, microblog.EncodeUserCursor(users[len(users)-1]), nil
+}
+
+// SearchPosts ranks the posts with the bm25 function of the FTS5 index.
+// Words are split by the unicode61 tokenizer, which may differ slightly from microblog.Tokenize.
+func (m *SQLiteManager) SearchPosts(ctx context.Context, query microblog.SearchQuery, token string, size uint8) ([]microblog.UserPost, string, error) {
+	args := []any{ftsQuery(query)}
+	conditions := []string{"posts_fts MATCH ?"}
+	if query.AuthorId != "" {
+		conditions = append(conditions, "author_id = ?")
+		args = append(args, query.AuthorId)
+	}
+	if !query.Before.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, query.Before.UnixNano())
+	}
+	if !query.After.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, query.After.UnixNano())
+	}
+	after := "TRUE"
+	if token != "" {
+		score, rawId, err := microblog.DecodeSearchCursor(token)
+		if err != nil {
+			return nil, "", err
+		}
+		id, err := idgen.Parse(rawId)
+		if err != nil {
+			return nil, "", microblog.ErrInvalidToken
+		}
+		after = "(score, id) < (?, ?)"
+		args = append(args, score, id)
+	}
+	args = append(args, int(size)+1)
+
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT `+postColumns+`, score FROM (
+			SELECT posts.*, -bm25(posts_fts) AS score
+			FROM posts_fts JOIN posts ON posts.id = posts_fts.rowid
+			WHERE `+strings.Join(conditions, " AND ")+`
+		)
+		WHERE `+after+`
+		ORDER BY score DESC, id DESC
+		LIMIT ?`,
+		args...,
+	)
+	if err != nil {
+		return nil, "", storageError()
+	}
+	defer rows.Close()
+
+	var posts []microblog.UserPost
+	var scores []float64
+	for rows.Next() {
+		var score float64
+		post, err := scanPost(rows, &score)
+		if err != nil {
+			return nil, "", storageError()
+		}
+		posts = append(posts, post)
+		scores = append(scores, score)
+	}
+	if rows.Err() != nil {
+		return nil, "", storageError()
+	}
+	if len(posts) <= int(size) {
+		return posts, "", nil
+	}
+	posts = posts[:size]
+	if size == 0 {
+		return posts, "", nil
+	}
+	return posts, microblog.EncodeSearchCursor(scores[size-1], posts[size-1].PostId), nil
+}
+
+// ftsQuery builds the FTS5 query selecting the posts that contain every phrase, or any of the terms
+// if there are no phrases. With phrases, the terms are OR-ed with the first phrase, which always
+// matches, so that they only contribute to the rank.
+func ftsQuery(query microblog.SearchQuery) string {
+	quote := func(words ...string) string { return `"` + strings.Join(words, " ") + `"` }
+	terms := make([]string, len(query.Terms))
+	for i, term := range query.Terms {
+		terms[i] = quote(term)
+	}
+	if len(query.Phrases) == 0 {
+		return strings.Join(terms, " OR ")
+	}
+	phrases := make([]string, len(query.Phrases))
+	for i, phrase := range query.Phrases {
+		phrases[i] = quote(phrase...)
+	}
+	match := strings.Join(phrases, " AND ")
+	if len(terms) > 0 {
+		match += " AND (" + strings.Join(append(terms, phrases[0]), " OR ") + ")"
+	}
+	return match
+}
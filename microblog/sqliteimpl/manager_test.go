@@ -0,0 +1,137 @@
+package sqliteimpl
+
+import (
+	"context"
+	"database/sql"
+	"micro-blog/microblog"
+	"micro-blog/microblog/idgen"
+	"micro-blog/microblog/microblogtest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+var ctx = context.Background()
+
+func TestManager(t *testing.T) {
+	suite.Run(t, new(ManagerSuite))
+}
+
+func TestManagerConformance(t *testing.T) {
+	suite.Run(t, &microblogtest.ManagerSuite{NewManager: func(t *testing.T) microblog.Manager {
+		manager := NewSQLiteManager(filepath.Join(t.TempDir(), "microblog.db"))
+		t.Cleanup(func() { _ = manager.Close() })
+		return manager
+	}})
+}
+
+type ManagerSuite struct {
+	suite.Suite
+
+	path    string
+	manager *SQLiteManager
+}
+
+func (s *ManagerSuite) SetupTest() {
+	s.path = filepath.Join(s.T().TempDir(), "microblog.db")
+	s.manager = NewSQLiteManager(s.path)
+}
+
+func (s *ManagerSuite) TearDownTest() {
+	s.Require().NoError(s.manager.Close())
+}
+
+func (s *ManagerSuite) TestMigrateTwice() {
+	s.Require().NoError(migrate(ctx, s.manager.db))
+}
+
+func (s *ManagerSuite) TestWALMode() {
+	var mode string
+	s.Require().NoError(s.manager.db.QueryRowContext(ctx, "PRAGMA journal_mode").Scan(&mode))
+	s.Require().Equal("wal", mode)
+}
+
+func (s *ManagerSuite) TestDataSurvivesRestart() {
+	p, err := s.manager.AddPost(ctx, "alice", "#persistent post")
+	s.Require().NoError(err)
+	_, err = s.manager.ModifyPost(ctx, p.PostId, "alice", "#durable post")
+	s.Require().NoError(err)
+	s.Require().NoError(s.manager.Subscribe(ctx, "bob", "alice"))
+
+	s.Require().NoError(s.manager.Close())
+	s.manager = NewSQLiteManager(s.path)
+
+	fetched, err := s.manager.GetPost(ctx, p.PostId)
+	s.Require().NoError(err)
+	s.Require().Equal("#durable post", fetched.Text)
+	s.Require().Equal([]string{"durable"}, fetched.Tags)
+	revisions, err := s.manager.GetPostRevisions(ctx, p.PostId)
+	s.Require().NoError(err)
+	s.Require().Len(revisions, 1)
+	feed, _, err := s.manager.GetFeedInPage(ctx, "bob", "", 10)
+	s.Require().NoError(err)
+	s.Require().Equal([]microblog.UserPost{fetched}, feed)
+}
+
+func (s *ManagerSuite) TestKeepsLegacyPostIds() {
+	// a database created before the post IDs were generated by idgen
+	path := filepath.Join(s.T().TempDir(), "legacy.db")
+	db, err := sql.Open("sqlite", "file:"+path)
+	s.Require().NoError(err)
+	script, err := migrations.ReadFile("migrations/0001_init.sql")
+	s.Require().NoError(err)
+	_, err = db.ExecContext(ctx, string(script)+"; PRAGMA user_version = 1")
+	s.Require().NoError(err)
+	createdAt := time.Now().Add(-time.Hour).UnixNano()
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO posts (author_id, text, created_at, likes_count, tags) VALUES ('alice', '#legacy post', ?, 1, '["legacy"]');
+		INSERT INTO post_tags (tag, post_id) VALUES ('legacy', 1);
+		INSERT INTO likes (post_id, user_id) VALUES (1, 'bob');
+		INSERT INTO posts (author_id, text, created_at, in_reply_to, root_id) VALUES ('bob', 'legacy reply', ?, 1, 1)`,
+		createdAt, createdAt+1,
+	)
+	s.Require().NoError(err)
+	s.Require().NoError(db.Close())
+
+	manager := NewSQLiteManager(path)
+	defer manager.Close()
+	root, err := manager.GetPost(ctx, "1")
+	s.Require().NoError(err)
+	s.Require().Equal("#legacy post", root.Text)
+	reply, err := manager.GetPost(ctx, "2")
+	s.Require().NoError(err)
+	s.Require().Equal("1", reply.InReplyTo)
+	s.Require().Equal("1", reply.RootId)
+	tagged, _, err := manager.GetTagPostsInPage(ctx, "legacy", "", 10)
+	s.Require().NoError(err)
+	s.Require().Equal([]microblog.UserPost{root}, tagged)
+
+	added, err := manager.AddReply(ctx, "carol", "1", "new reply")
+	s.Require().NoError(err)
+	s.Require().Len(added.PostId, idgen.Length)
+	s.Require().Equal("1", added.RootId)
+	// the page tokens point to both kinds of IDs
+	var replies []microblog.UserPost
+	token := ""
+	for {
+		page, next, err := manager.GetRepliesInPage(ctx, "1", token, 1)
+		s.Require().NoError(err)
+		replies = append(replies, page...)
+		if next == "" {
+			break
+		}
+		token = next
+	}
+	s.Require().Equal([]microblog.UserPost{added, reply}, replies)
+	thread, err := manager.GetThread(ctx, added.PostId)
+	s.Require().NoError(err)
+	s.Require().Equal([]microblog.UserPost{root, added}, thread)
+
+	unliked, err := manager.UnlikePost(ctx, "1", "bob")
+	s.Require().NoError(err)
+	s.Require().Zero(unliked.LikesCount)
+	_, err = manager.GetPost(ctx, "01")
+	s.Require().ErrorIs(err, microblog.ErrNotFound)
+}
@@ -0,0 +1,58 @@
+package sqliteimpl
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migrations are applied in the order of the numeric prefix of their file names, e.g. 0001_init.sql.
+// The version of the last applied migration is kept in PRAGMA user_version.
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// migrate applies the migrations newer than the user_version of the database.
+// Each migration runs in its own transaction together with the version bump.
+func migrate(ctx context.Context, db *sql.DB) error {
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	var current int
+	if err := db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&current); err != nil {
+		return err
+	}
+	for _, name := range names {
+		prefix, _, _ := strings.Cut(strings.TrimPrefix(name, "migrations/"), "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return fmt.Errorf("malformed migration name %s", name)
+		}
+		if version <= current {
+			continue
+		}
+		script, err := migrations.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		if err := inTx(ctx, db, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+				return err
+			}
+			// PRAGMA does not accept bound parameters
+			_, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", version))
+			return err
+		}); err != nil {
+			return fmt.Errorf("failed to apply migration %s: %w", name, err)
+		}
+	}
+	return nil
+}
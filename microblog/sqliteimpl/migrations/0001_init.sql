@@ -0,0 +1,82 @@
+CREATE TABLE posts (
+    id               INTEGER PRIMARY KEY AUTOINCREMENT,
+    author_id        TEXT    NOT NULL,
+    text             TEXT    NOT NULL,
+    -- timestamps are stored as Unix time in nanoseconds
+    created_at       INTEGER NOT NULL,
+    last_modified_at INTEGER,
+    likes_count      INTEGER NOT NULL DEFAULT 0,
+    in_reply_to      INTEGER,
+    root_id          INTEGER,
+    kind             TEXT    NOT NULL DEFAULT '',
+    repost_of        INTEGER,
+    reposts_count    INTEGER NOT NULL DEFAULT 0,
+    -- JSON arrays, indexed by post_tags and post_mentions
+    tags             TEXT    NOT NULL DEFAULT '[]',
+    mentions         TEXT    NOT NULL DEFAULT '[]'
+);
+
+CREATE INDEX posts_author_id_created_at_id ON posts (author_id, created_at DESC, id DESC);
+CREATE INDEX posts_in_reply_to_created_at_id ON posts (in_reply_to, created_at DESC, id DESC)
+    WHERE in_reply_to IS NOT NULL;
+-- a user can repost a post without a quote only once
+CREATE UNIQUE INDEX posts_repost_of_author_id ON posts (repost_of, author_id) WHERE kind = 'repost';
+
+CREATE TABLE post_tags (
+    tag     TEXT    NOT NULL,
+    post_id INTEGER NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    PRIMARY KEY (tag, post_id)
+) WITHOUT ROWID;
+
+CREATE TABLE post_mentions (
+    user_id TEXT    NOT NULL,
+    post_id INTEGER NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, post_id)
+) WITHOUT ROWID;
+
+CREATE INDEX post_tags_post_id ON post_tags (post_id);
+CREATE INDEX post_mentions_post_id ON post_mentions (post_id);
+
+CREATE VIRTUAL TABLE posts_fts USING fts5(
+    text,
+    content = 'posts',
+    content_rowid = 'id',
+    tokenize = 'unicode61 remove_diacritics 0'
+);
+
+CREATE TRIGGER posts_fts_insert AFTER INSERT ON posts BEGIN
+    INSERT INTO posts_fts (rowid, text) VALUES (new.id, new.text);
+END;
+
+CREATE TRIGGER posts_fts_delete AFTER DELETE ON posts BEGIN
+    INSERT INTO posts_fts (posts_fts, rowid, text) VALUES ('delete', old.id, old.text);
+END;
+
+CREATE TRIGGER posts_fts_update AFTER UPDATE OF text ON posts BEGIN
+    INSERT INTO posts_fts (posts_fts, rowid, text) VALUES ('delete', old.id, old.text);
+    INSERT INTO posts_fts (rowid, text) VALUES (new.id, new.text);
+END;
+
+CREATE TABLE subscriptions (
+    follower_id TEXT NOT NULL,
+    followee_id TEXT NOT NULL,
+    PRIMARY KEY (follower_id, followee_id)
+) WITHOUT ROWID;
+
+CREATE INDEX subscriptions_followee_id_follower_id ON subscriptions (followee_id, follower_id);
+
+CREATE TABLE post_revisions (
+    id        INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id   INTEGER NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    text      TEXT    NOT NULL,
+    editor_id TEXT    NOT NULL,
+    edited_at INTEGER NOT NULL
+);
+
+CREATE INDEX post_revisions_post_id_id ON post_revisions (post_id, id);
+
+CREATE TABLE likes (
+    post_id INTEGER NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    user_id TEXT    NOT NULL,
+    PRIMARY KEY (post_id, user_id)
+) WITHOUT ROWID;
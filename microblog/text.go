@@ -0,0 +1,50 @@
+package microblog
+
+import (
+	"regexp"
+	"strings"
+)
+
+// hashtagPattern matches a hashtag that is not glued to a preceding word, e.g. "#go" but not "c#".
+var hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_])#([\p{L}\p{N}_]+)`)
+
+// mentionPattern matches a word prefixed with '@' that is not glued to a preceding word, e.g. "@1a" but not "mail@1a".
+// The word is a mention only if it is a valid user ID, see userIdPattern.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_])@([\p{L}\p{N}_]+)`)
+
+// userIdPattern is the UserId pattern of the API specification.
+var userIdPattern = regexp.MustCompile(`^[0-9a-f]+$`)
+
+// NormalizeHashtag brings a hashtag to the form it is stored in: lowercase and without the leading '#'.
+func NormalizeHashtag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(tag, "#"))
+}
+
+// ExtractHashtags returns the normalized hashtags of the text in order of their first occurrence.
+func ExtractHashtags(text string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, match := range hashtagPattern.FindAllStringSubmatch(text, -1) {
+		tag := NormalizeHashtag(match[1])
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// ExtractMentions returns the IDs of the users mentioned in the text in order of their first occurrence.
+// Words that are not valid user IDs, such as "@Bob", are not mentions.
+func ExtractMentions(text string) []string {
+	var mentions []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		userId := match[1]
+		if userIdPattern.MatchString(userId) && !seen[userId] {
+			seen[userId] = true
+			mentions = append(mentions, userId)
+		}
+	}
+	return mentions
+}
@@ -0,0 +1,41 @@
+package microblog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractHashtags(t *testing.T) {
+	cases := map[string][]string{
+		"no tags here":                   nil,
+		"#Go is #fun":                    {"go", "fun"},
+		"#go #GO #Go":                    {"go"},
+		"c# and mail@host#anchor":        nil,
+		"(#tag1),#tag_2!":                {"tag1", "tag_2"},
+		"#Привет мир":                    {"привет"},
+		"#a#b":                           {"a"},
+		"trailing hash # and #":          nil,
+		"line\n#start of the second one": {"start"},
+	}
+	for text, expected := range cases {
+		require.Equal(t, expected, ExtractHashtags(text), text)
+	}
+}
+
+func TestExtractMentions(t *testing.T) {
+	cases := map[string][]string{
+		"no mentions here":            nil,
+		"@1a and @b2 said hi":         {"1a", "b2"},
+		"@1a @1a":                     {"1a"},
+		"@Bob and @1az are not ids":   nil,
+		"mail@1a is not a mention":    nil,
+		"(@ff),@0!":                   {"ff", "0"},
+		"@a@b":                        {"a"},
+		"trailing @ and @":            nil,
+		"#1a is a tag, @1a is a user": {"1a"},
+	}
+	for text, expected := range cases {
+		require.Equal(t, expected, ExtractMentions(text), text)
+	}
+}